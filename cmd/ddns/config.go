@@ -25,7 +25,7 @@ func buildService(cfg *config.Config) (services []service.IDDNSService) {
 		}
 		if svc != nil {
 			if err = app.Runtime.DDNSRegistry().Register(svcCfg.Name, svc); err != nil {
-				log.Fatal(err)
+				log.Fatalf("service %s: %s", svcCfg.Name, err)
 			}
 			services = append(services, svc)
 		}
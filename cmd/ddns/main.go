@@ -65,6 +65,7 @@ func init() {
 	var printVersion bool
 	flag.StringVar(&cfgFile, "C", "", "configuration file")
 	flag.BoolVar(&printVersion, "V", false, "print version")
+	flag.Usage = usage
 	flag.Parse()
 	if printVersion {
 		fmt.Fprintf(os.Stdout, "ddns %s (%s %s/%s)\n",
@@ -75,6 +76,16 @@ func init() {
 }
 
 func main() {
+	switch flag.Arg(0) {
+	case "run":
+		parseRunCmd(flag.Args()[1:])
+		if runOnce {
+			os.Exit(runServicesOnce())
+		}
+	case "plan":
+		parsePlanCmd(flag.Args()[1:])
+		os.Exit(planServicesOnce())
+	}
 	p := &program{}
 	if err := svc.Run(p); err != nil {
 		log.Fatal(err)
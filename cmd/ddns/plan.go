@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/jxo-me/ddns/consts"
+	"github.com/jxo-me/ddns/core/service"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+	"io"
+	"os"
+)
+
+var (
+	planServices stringList
+	planFormat   string
+)
+
+// parsePlanCmd 解析 plan 子命令
+// ddns plan [--service name]... [--format text|json] [-C file]
+func parsePlanCmd(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fs.StringVar(&cfgFile, "C", cfgFile, "configuration file")
+	fs.Var(&planServices, "service", "only plan the named service, can be repeated")
+	fs.StringVar(&planFormat, "format", "text", "output format, text or json")
+	_ = fs.Parse(args)
+}
+
+// planServicesOnce 预览每个服务将要执行的修改, 返回退出码
+func planServicesOnce() int {
+	type servicePlan struct {
+		Service string                `json:"service"`
+		Status  string                `json:"status"`
+		Results []*xddns.UpdateResult `json:"results"`
+	}
+	var plans []servicePlan
+	code := runServicesWith(planServices, func(ctx context.Context, svc service.IDDNSService) xddns.Domains {
+		return svc.Plan(ctx)
+	}, func(svc service.IDDNSService, domains xddns.Domains) {
+		plans = append(plans, servicePlan{
+			Service: svc.String(),
+			Status:  domains.Status().String(),
+			Results: domains.Results(),
+		})
+	})
+
+	if planFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(plans)
+		return code
+	}
+	for _, plan := range plans {
+		fmt.Fprintf(os.Stdout, "service %s:\n", plan.Service)
+		for _, result := range plan.Results {
+			printPlanResult(os.Stdout, result)
+		}
+	}
+	return code
+}
+
+// printPlanResult 输出单个域名的预览结果
+func printPlanResult(w io.Writer, r *xddns.UpdateResult) {
+	switch {
+	case r.Status == consts.UpdatedFailed:
+		fmt.Fprintf(w, "  ! %-6s %s %s: %s\n", r.Action, r.RecordType, r.Domain, r.ErrorMessage)
+	case r.Action == xddns.ActionCreate:
+		fmt.Fprintf(w, "  + create %s %s: %s\n", r.RecordType, r.Domain, r.NewValue)
+	case r.Action == xddns.ActionUpdate:
+		previous := r.PreviousValue
+		if previous == "" {
+			previous = "(unknown)"
+		}
+		fmt.Fprintf(w, "  ~ update %s %s: %s -> %s\n", r.RecordType, r.Domain, previous, r.NewValue)
+	case r.Action == xddns.ActionNoop:
+		fmt.Fprintf(w, "  = noop   %s %s: %s\n", r.RecordType, r.Domain, r.NewValue)
+	default:
+		fmt.Fprintf(w, "  - skip   %s %s: %s\n", r.RecordType, r.Domain, r.Reason)
+	}
+}
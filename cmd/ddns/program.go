@@ -5,16 +5,37 @@ import (
 	"github.com/jxo-me/ddns/config"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/sdk/app"
+	"github.com/jxo-me/ddns/sdk/service"
 	"os"
 )
 
-type program struct{}
+type program struct {
+	supervisor *service.Supervisor
+}
 
 func (p *program) Init(env svc.Environment) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	// set default output format
+	if outputFormat != "" {
+		if err := cfg.Write(os.Stdout, outputFormat); err != nil {
+			return err
+		}
+		os.Exit(0)
+	}
+	// load config
+	config.Set(cfg)
+	return nil
+}
+
+// loadConfig 读取配置文件并设置默认日志
+func loadConfig() (*config.Config, error) {
 	cfg := &config.Config{}
 	if cfgFile != "" {
 		if err := cfg.ReadFile(cfgFile); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	// build config from command line
@@ -26,36 +47,26 @@ func (p *program) Init(env svc.Environment) error {
 	//cfg = p.mergeConfig(cfg, cmdCfg)
 	// set default logger
 	logger.SetDefault(logFromConfig(cfg.Log))
-	// set default output format
-	if outputFormat != "" {
-		if err := cfg.Write(os.Stdout, outputFormat); err != nil {
-			return err
-		}
-		os.Exit(0)
-	}
-	// load config
-	config.Set(cfg)
-	return nil
+	return cfg, nil
 }
 
 func (p *program) Start() error {
 	cfg := config.Global()
-	for _, ddns := range buildService(cfg) {
-		srv := ddns
-		go func() {
-			logger.Default().Info("service " + srv.String() + " start")
-			_ = srv.Start()
-		}()
+	p.supervisor = service.NewSupervisor(logger.Default())
+	for _, srv := range buildService(cfg) {
+		if err := p.supervisor.Start(srv); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (p *program) Stop() error {
-	log := logger.Default()
-	for name, srv := range app.Runtime.DDNSRegistry().GetAll() {
-		_ = srv.Stop()
-		log.Debugf("service %s shutdown", name)
+	if p.supervisor != nil {
+		p.supervisor.Stop()
+		logger.Default().Debug("all services shutdown")
 	}
+	app.Runtime.EventBus().Close()
 	return nil
 }
 
@@ -0,0 +1,28 @@
+package main
+
+import (
+	// Register DNS providers
+	_ "github.com/jxo-me/ddns/sdk/ddns/alidns"
+	_ "github.com/jxo-me/ddns/sdk/ddns/baidu"
+	_ "github.com/jxo-me/ddns/sdk/ddns/callback"
+	_ "github.com/jxo-me/ddns/sdk/ddns/cloudflare"
+	_ "github.com/jxo-me/ddns/sdk/ddns/dnspod"
+	_ "github.com/jxo-me/ddns/sdk/ddns/exec"
+	_ "github.com/jxo-me/ddns/sdk/ddns/godaddy"
+	_ "github.com/jxo-me/ddns/sdk/ddns/google"
+	_ "github.com/jxo-me/ddns/sdk/ddns/huawei"
+	_ "github.com/jxo-me/ddns/sdk/ddns/namecheap"
+	_ "github.com/jxo-me/ddns/sdk/ddns/namesilo"
+	_ "github.com/jxo-me/ddns/sdk/ddns/porkbun"
+	_ "github.com/jxo-me/ddns/sdk/ddns/tencent"
+
+	// Register IP sources
+	_ "github.com/jxo-me/ddns/sdk/ipsource/cmd"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/dns"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/natpmp"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/netinterface"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/pcp"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/stun"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/upnp"
+	_ "github.com/jxo-me/ddns/sdk/ipsource/url"
+)
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/core/service"
+	"github.com/jxo-me/ddns/sdk/app"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// run --once 的退出码
+const (
+	ExitUnchanged       = 0 // 所有记录都未改变
+	ExitError           = 1 // 配置错误等
+	ExitUpdated         = 2 // 至少新增或更新了一条记录
+	ExitDetectionFailed = 3 // 获取IP失败
+	ExitProviderFailed  = 4 // 服务商更新失败
+)
+
+var exitCodes = map[xddns.RunStatus]int{
+	xddns.RunUnchanged:       ExitUnchanged,
+	xddns.RunUpdated:         ExitUpdated,
+	xddns.RunDetectionFailed: ExitDetectionFailed,
+	xddns.RunProviderFailed:  ExitProviderFailed,
+}
+
+var (
+	runOnce     bool
+	runServices stringList
+)
+
+// parseRunCmd 解析 run 子命令
+// ddns run [--once] [--service name]... [-C file]
+func parseRunCmd(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.StringVar(&cfgFile, "C", cfgFile, "configuration file")
+	fs.BoolVar(&runOnce, "once", false, "run detection and updates for every service once and exit")
+	fs.Var(&runServices, "service", "only run the named service, can be repeated")
+	_ = fs.Parse(args)
+	// 作为服务运行时总是运行所有服务
+	if len(runServices) > 0 && !runOnce {
+		fmt.Fprintln(fs.Output(), "--service can only be used with --once")
+		fs.Usage()
+		os.Exit(ExitError)
+	}
+}
+
+// runServicesOnce 每个服务获取IP并更新一次, 返回退出码
+func runServicesOnce() int {
+	log := logger.Default()
+	return runServicesWith(runServices, func(ctx context.Context, svc service.IDDNSService) xddns.Domains {
+		domains := svc.Run(ctx)
+		log.Infof("service %s: %s", svc, domains.Status())
+		return domains
+	}, nil)
+}
+
+// runServicesWith 读取配置, 对 names 中的服务(为空时为所有服务)并发执行 fn, 按服务顺序调用 report, 返回退出码
+func runServicesWith(names stringList, fn func(ctx context.Context, svc service.IDDNSService) xddns.Domains,
+	report func(svc service.IDDNSService, domains xddns.Domains)) int {
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Default().Error(err)
+		return ExitError
+	}
+	log := logger.Default()
+
+	var services []service.IDDNSService
+	for _, svc := range buildService(cfg) {
+		if len(names) == 0 || names.contains(svc.String()) {
+			services = append(services, svc)
+		}
+	}
+	for _, name := range names {
+		found := false
+		for _, svc := range services {
+			found = found || svc.String() == name
+		}
+		if !found {
+			log.Errorf("service %s not found", name)
+			return ExitError
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]*xddns.Domains, len(services))
+	)
+	for i, svc := range services {
+		wg.Add(1)
+		go func(i int, svc service.IDDNSService) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("service %s panic: %v", svc, r)
+				}
+			}()
+			domains := fn(ctx, svc)
+			results[i] = &domains
+		}(i, svc)
+	}
+	wg.Wait()
+	// 等待 webhook 等订阅者处理完事件
+	app.Runtime.EventBus().Close()
+
+	var status xddns.RunStatus
+	failed := ctx.Err() != nil
+	for i, domains := range results {
+		if domains == nil {
+			failed = true
+			continue
+		}
+		if report != nil {
+			report(services[i], *domains)
+		}
+		if s := domains.Status(); s > status {
+			status = s
+		}
+	}
+	if failed {
+		return ExitError
+	}
+	return exitCodes[status]
+}
+
+func (l *stringList) contains(value string) bool {
+	for _, v := range *l {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// usage 打印用法
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  ddns [-C file]                         run as a service
+  ddns run [--once [--service name]...]  run every service, with --once run a single round and exit
+  ddns plan [--service name]...          show pending DNS changes without writing anything
+
+Exit codes of run --once and plan: 0 unchanged, 1 error, 2 updated (plan: changes pending),
+3 detection failed, 4 provider failed
+
+`)
+	flag.PrintDefaults()
+}
@@ -1,260 +1,158 @@
 package config
 
-import (
-	"github.com/jxo-me/ddns/core/logger"
-	"github.com/jxo-me/ddns/internal/util"
-	"io"
-	"os/exec"
-	"regexp"
-	"runtime"
-	"strconv"
-	"strings"
-)
-
-// Ipv4Reg IPv4正则
-var Ipv4Reg = regexp.MustCompile(`((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])`)
-
-// Ipv6Reg IPv6正则
-var Ipv6Reg = regexp.MustCompile(`((([0-9A-Fa-f]{1,4}:){7}([0-9A-Fa-f]{1,4}|:))|(([0-9A-Fa-f]{1,4}:){6}(:[0-9A-Fa-f]{1,4}|((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3})|:))|(([0-9A-Fa-f]{1,4}:){5}(((:[0-9A-Fa-f]{1,4}){1,2})|:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3})|:))|(([0-9A-Fa-f]{1,4}:){4}(((:[0-9A-Fa-f]{1,4}){1,3})|((:[0-9A-Fa-f]{1,4})?:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){3}(((:[0-9A-Fa-f]{1,4}){1,4})|((:[0-9A-Fa-f]{1,4}){0,2}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){2}(((:[0-9A-Fa-f]{1,4}){1,5})|((:[0-9A-Fa-f]{1,4}){0,3}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){1}(((:[0-9A-Fa-f]{1,4}){1,6})|((:[0-9A-Fa-f]{1,4}){0,4}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(:(((:[0-9A-Fa-f]{1,4}){1,7})|((:[0-9A-Fa-f]{1,4}){0,5}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:)))`)
-
 // DNS DNS配置
 type DNS struct {
 	// 名称。如：alidns,webhook
 	Name   string `json:"name"`
 	ID     string `json:"ID"`
 	Secret string `json:"secret"`
+	// exec 服务商的程序参数和环境变量, 环境变量格式为 KEY=VALUE
+	Args []string `yaml:",omitempty" json:"args,omitempty"`
+	Env  []string `yaml:",omitempty" json:"env,omitempty"`
 }
 
-type Ipv4 struct {
-	Enable bool `json:"enable"`
-	// 获取IP类型 url/netInterface
-	GetType      string   `yaml:",omitempty" json:"getType"` // url/netInterface/cmd
-	URL          string   `yaml:",omitempty" json:"url"`
-	NetInterface string   `yaml:",omitempty" json:"netInterface"`
-	Cmd          string   `yaml:",omitempty" json:"cmd"`
-	Domains      []string `yaml:",omitempty" json:"domains"`
+// IPSource 获取IP的方式
+type IPSource struct {
+	// 获取IP类型 url/netInterface/cmd/stun/dns/upnp/natpmp/pcp
+	// 多个以逗号分隔时按顺序尝试, 第一个得到有效地址的为结果, 如 netInterface,stun,url
+	// 类型:秒数 为该类型单独的超时, 如 netInterface,stun:5,url:15
+	GetType string `yaml:",omitempty" json:"getType"`
+	URL     string `yaml:",omitempty" json:"url"`
+	// url 方式可以单独设置响应格式、请求方法和请求头的URL, 与 URL 一起使用
+	URLs         []*URLSource `yaml:"urls,omitempty" json:"urls,omitempty"`
+	NetInterface string       `yaml:",omitempty" json:"netInterface"`
+	Cmd          string       `yaml:",omitempty" json:"cmd"`
+	// 多个获取IP类型时每个类型的超时秒数, 类型没有单独设置时使用, 默认 30
+	Timeout int `yaml:",omitempty" json:"timeout,omitempty"`
+	// url 方式的策略 first/majority/数字N(至少N个URL返回相同地址), 默认 first
+	URLPolicy string `yaml:",omitempty" json:"urlPolicy,omitempty"`
+	// url 方式单个请求的超时秒数, 默认 10
+	URLTimeout int `yaml:",omitempty" json:"urlTimeout,omitempty"`
+	// STUN 服务器, 多个以逗号分隔, 如 stun.cloudflare.com:3478
+	STUN string `yaml:",omitempty" json:"stun,omitempty"`
+	// upnp/natpmp/pcp 方式的路由器地址, 为空时自动检测默认网关; upnp 也可为设备描述的URL
+	Gateway string `yaml:",omitempty" json:"gateway,omitempty"`
+	// cmd 方式的执行选项
+	CmdOptions *CmdOptions `yaml:"cmdOptions,omitempty" json:"cmdOptions,omitempty"`
+	// url/stun/dns 方式发起连接的网卡, 仅支持 Linux, 用于策略路由下分别检测每条线路的地址
+	BindInterface string `yaml:",omitempty" json:"bindInterface,omitempty"`
+	// url/stun/dns 方式发起连接的源地址, 须与地址类型相同
+	BindAddr string `yaml:",omitempty" json:"bindAddr,omitempty"`
+	// dns 方式的查询, 为空时使用 opendns
+	DNSQuery *DNSQuery `yaml:"dnsQuery,omitempty" json:"dnsQuery,omitempty"`
+	// netInterface 方式的地址选择策略, 以逗号分隔, 如 exclude-temporary,prefer-eui64,match-prefix=2001:db8::/48
+	// 可用 exclude-temporary/exclude-deprecated/prefer-stable/prefer-eui64/prefer-longest-preferred-lifetime/match-prefix
+	AddrPolicy string `yaml:",omitempty" json:"addrPolicy,omitempty"`
+	// netInterface 方式写入网卡上按策略选出的所有地址, 服务商需支持多值记录, 此时忽略 IPv6Reg
+	MultiAddr bool `yaml:",omitempty" json:"multiAddr,omitempty"`
+	// 网卡有多个地址时的匹配规则, 正则表达式或 @n 表示按策略排序后的第n个地址
+	IPv6Reg string `yaml:",omitempty" json:"IPv6Reg,omitempty"`
 }
 
-type Ipv6 struct {
-	Enable bool `json:"enable"`
-	// 获取IP类型 url/netInterface
-	GetType      string `yaml:",omitempty" json:"getType"`
-	URL          string `yaml:",omitempty" json:"url"`
-	NetInterface string `yaml:",omitempty" json:"netInterface"`
-	Cmd          string `yaml:",omitempty" json:"cmd"`
-	// ipv6匹配正则表达式
-	IPv6Reg string   `yaml:",omitempty" json:"IPv6Reg"`
-	Domains []string `yaml:",omitempty" json:"domains"`
-}
-
-// DDnsConfig 配置
-type DDnsConfig struct {
-	Name    string   `json:"name"`
-	Delay   int64    `yaml:",omitempty" json:"delay"`
-	Ipv4    *Ipv4    `yaml:",omitempty"  json:"ipv4"`
-	Ipv6    *Ipv6    `yaml:",omitempty" json:"ipv6"`
-	DNS     *DNS     `yaml:",omitempty" json:"dns"`
-	TTL     string   `yaml:",omitempty" json:"ttl"`
-	Webhook *Webhook `yaml:",omitempty" json:"webhook"`
+// URLSource 单个获取IP的URL
+type URLSource struct {
+	URL string `json:"url"`
+	// 请求方法, 默认 GET
+	Method string `yaml:",omitempty" json:"method,omitempty"`
+	// 请求头, 一个一行, 如 Accept: application/json
+	Headers []string `yaml:",omitempty" json:"headers,omitempty"`
+	// 请求体
+	Body string `yaml:",omitempty" json:"body,omitempty"`
+	// 响应格式, 为空时查找第一个地址
+	// plain 整个响应为地址; json:路径 如 json:ip; kv:键 key=value 格式中的键, 如 kv:ip; regex:表达式 使用名为 ip 的分组
+	Format string `yaml:",omitempty" json:"format,omitempty"`
 }
 
-func (conf *DDnsConfig) getIpv4AddrFromInterface() string {
-	log := logger.Default()
-	ipv4, _, err := util.GetNetInterface()
-	if err != nil {
-		log.Debugf("Failed to get IPv4 from network interface! error: %s\n", err.Error())
-		return ""
-	}
-
-	for _, netInterface := range ipv4 {
-		if netInterface.Name == conf.Ipv4.NetInterface && len(netInterface.Address) > 0 {
-			return netInterface.Address[0]
-		}
-	}
-
-	log.Debug("Failed to get IPv4 from network interface! Interface name: ", conf.Ipv4.NetInterface)
-	return ""
+// CmdOptions 执行命令获取IP的选项
+type CmdOptions struct {
+	// 超时秒数, 默认 30
+	Timeout int `yaml:",omitempty" json:"timeout,omitempty"`
+	// 不经过 shell 直接执行的程序及参数, 设置后忽略 cmd
+	Args []string `yaml:",omitempty" json:"args,omitempty"`
+	// 执行 cmd 的 shell, 如 bash/sh/powershell/pwsh/cmd, 默认 bash, 没有时为 sh, Windows 为 powershell
+	Shell string `yaml:",omitempty" json:"shell,omitempty"`
+	// 额外的环境变量, 格式为 KEY=VALUE
+	Env []string `yaml:",omitempty" json:"env,omitempty"`
+	// 工作目录
+	Dir string `yaml:",omitempty" json:"dir,omitempty"`
+	// 从标准输出中获取地址的方式, 为空时查找第一个地址
+	// regex:表达式 有分组时使用第一个分组; line:n 第n行, 负数从末尾算起; json:路径 如 json:data.ips.0
+	Parse string `yaml:",omitempty" json:"parse,omitempty"`
 }
 
-func (conf *DDnsConfig) getIpv4AddrFromUrl() string {
-	log := logger.Default()
-	client := util.CreateNoProxyHTTPClient("tcp4")
-	urls := strings.Split(conf.Ipv4.URL, ",")
-	for _, url := range urls {
-		url = strings.TrimSpace(url)
-		resp, err := client.Get(url)
-		if err != nil {
-			log.Debugf("Error message: %s\n", err)
-			continue
-		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Debugf("Failed to read IPv4 result! Interface:", url)
-			continue
-		}
-		result := Ipv4Reg.FindString(string(body))
-		if result == "" {
-			log.Debugf("Failed to get IPv4 result! Interface: %s, return value: %s\n", url, result)
-		}
-		return result
-	}
-	return ""
+// DNSQuery 通过查询特殊的域名获取IP
+type DNSQuery struct {
+	// 预设 opendns/google/cloudflare, 其它字段覆盖预设
+	Preset string `yaml:",omitempty" json:"preset,omitempty"`
+	// 服务器地址, 默认端口 53
+	Server string `yaml:",omitempty" json:"server,omitempty"`
+	// 查询的域名、类型 A/AAAA/TXT 和类别 IN/CH
+	Name  string `yaml:",omitempty" json:"name,omitempty"`
+	Type  string `yaml:",omitempty" json:"type,omitempty"`
+	Class string `yaml:",omitempty" json:"class,omitempty"`
+	// 从回答中匹配地址的正则表达式, 有分组时使用第一个分组
+	Match string `yaml:",omitempty" json:"match,omitempty"`
 }
 
-func (conf *DDnsConfig) getAddrFromCmd(addrType string) string {
-	log := logger.Default()
-	var cmd string
-	var comp *regexp.Regexp
-	if addrType == "IPv4" {
-		cmd = conf.Ipv4.Cmd
-		comp = Ipv4Reg
-	} else {
-		cmd = conf.Ipv6.Cmd
-		comp = Ipv6Reg
-	}
-	// cmd is empty
-	if cmd == "" {
-		return ""
-	}
-	// run cmd with proper shell
-	var execCmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		execCmd = exec.Command("powershell", "-Command", cmd)
-	} else {
-		// If Bash does not exist, use sh
-		_, err := exec.LookPath("bash")
-		if err != nil {
-			execCmd = exec.Command("sh", "-c", cmd)
-		} else {
-			execCmd = exec.Command("bash", "-c", cmd)
-		}
-	}
-	// run cmd
-	out, err := execCmd.CombinedOutput()
-	if err != nil {
-		log.Debugf("Failed to get %s result! Failed to execute command: %s, error: %q, exit status code: %s\n", addrType, execCmd.String(), out, err)
-		return ""
-	}
-	str := string(out)
-	// get result
-	result := comp.FindString(str)
-	if result == "" {
-		log.Debugf("Failed to get %s result! Command: %s, standard output: %q\n", addrType, execCmd.String(), str)
-	}
-	return result
+type Ipv4 struct {
+	Enable   bool `json:"enable"`
+	IPSource `yaml:",inline" mapstructure:",squash"`
+	Domains  []string `yaml:",omitempty" json:"domains"`
+	// 允许和拒绝的地址范围, CIDR 或单个IP, 被拒绝的地址视为获取失败
+	// 匹配 Allow 的地址总是允许; Deny 中也可以使用预设 public-only/no-cgnat
+	Allow []string `yaml:",omitempty" json:"allow,omitempty"`
+	Deny  []string `yaml:",omitempty" json:"deny,omitempty"`
 }
 
-// GetIpv4Addr 获得IPv4地址
-func (conf *DDnsConfig) GetIpv4Addr() string {
-	log := logger.Default()
-	// 判断从哪里获取IP
-	switch conf.Ipv4.GetType {
-	case "netInterface":
-		// 从网卡获取 IP
-		return conf.getIpv4AddrFromInterface()
-	case "url":
-		// 从 URL 获取 IP
-		return conf.getIpv4AddrFromUrl()
-	case "cmd":
-		// 从命令行获取 IP
-		return conf.getAddrFromCmd("IPv4")
-	default:
-		log.Debugf("Unknown IPv4 way to get IP!")
-		return "" // unknown type
-	}
+type Ipv6 struct {
+	Enable   bool `json:"enable"`
+	IPSource `yaml:",inline" mapstructure:",squash"`
+	Domains  []string `yaml:",omitempty" json:"domains"`
+	// 允许和拒绝的地址范围, CIDR 或单个IP, 被拒绝的地址视为获取失败
+	// 匹配 Allow 的地址总是允许; Deny 中也可以使用预设 public-only/no-cgnat
+	Allow []string `yaml:",omitempty" json:"allow,omitempty"`
+	Deny  []string `yaml:",omitempty" json:"deny,omitempty"`
+	// 域名的接口标识, 与获取到的地址的前缀组合成该域名的地址, 如 nas.example.com: ::1a2b:3c4d
+	// 也可以在域名后指定, 如 nas.example.com?ipv6suffix=::1a2b:3c4d
+	HostIDs map[string]string `yaml:"hostIDs,omitempty" json:"hostIDs,omitempty"`
+	// 与接口标识组合时的前缀长度, 默认 64
+	PrefixLength int `yaml:"prefixLength,omitempty" json:"prefixLength,omitempty"`
 }
 
-func (conf *DDnsConfig) getIpv6AddrFromInterface() string {
-	log := logger.Default()
-	_, ipv6, err := util.GetNetInterface()
-	if err != nil {
-		log.Debug("Failed to get IPv6 from network interface!")
-		return ""
-	}
-
-	for _, netInterface := range ipv6 {
-		if netInterface.Name == conf.Ipv6.NetInterface && len(netInterface.Address) > 0 {
-			if conf.Ipv6.IPv6Reg != "" {
-				// 匹配第几个IPv6
-				if match, err := regexp.MatchString("@\\d", conf.Ipv6.IPv6Reg); err == nil && match {
-					num, err := strconv.Atoi(conf.Ipv6.IPv6Reg[1:])
-					if err == nil {
-						if num > 0 {
-							log.Debugf("IPv6 will use IPv6 address %d\n", num)
-							if num <= len(netInterface.Address) {
-								return netInterface.Address[num-1]
-							}
-							log.Debug("IPv6 address %d not found! First IPv6 address will be used\n", num)
-							return netInterface.Address[0]
-						}
-						log.Debugf("IPv6 matching expression %s is incorrect! Minimum starts from 1\n", conf.Ipv6.IPv6Reg)
-						return ""
-					}
-				}
-				// 正则表达式匹配
-				log.Infof("IPv6 will use the regular expression %s for matching\n", conf.Ipv6.IPv6Reg)
-				for i := 0; i < len(netInterface.Address); i++ {
-					matched, err := regexp.MatchString(conf.Ipv6.IPv6Reg, netInterface.Address[i])
-					if matched && err == nil {
-						log.Debugf("The match is successful! Matched to the address: ", netInterface.Address[i])
-						return netInterface.Address[i]
-					}
-					log.Debugf("%d address %s does not match, will match next address\n", i+1, netInterface.Address[i])
-				}
-				log.Infof("Does not match any IPv6 address, the first address will be used")
-			}
-			return netInterface.Address[0]
-		}
-	}
-
-	log.Infof("Failed to get IPv6 from network interface! Network interface name: ", conf.Ipv6.NetInterface)
-	return ""
+// Schedule 运行间隔和失败后的重试策略, 获取IP失败和服务商更新失败分别计算
+type Schedule struct {
+	// 正常运行的间隔秒数, 默认为 delay
+	Interval int64 `yaml:",omitempty" json:"interval,omitempty"`
+	// 获取IP失败时的重试策略
+	Detection *Backoff `yaml:",omitempty" json:"detection,omitempty"`
+	// 服务商更新失败时的重试策略
+	Provider *Backoff `yaml:",omitempty" json:"provider,omitempty"`
 }
 
-func (conf *DDnsConfig) getIpv6AddrFromUrl() string {
-	log := logger.Default()
-	client := util.CreateNoProxyHTTPClient("tcp6")
-	urls := strings.Split(conf.Ipv6.URL, ",")
-	for _, url := range urls {
-		url = strings.TrimSpace(url)
-		resp, err := client.Get(url)
-		if err != nil {
-			log.Infof("Error message: %s\n", err)
-			continue
-		}
-
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Infof("Failed to read IPv6 result! Interface:", url)
-			continue
-		}
-		result := Ipv6Reg.FindString(string(body))
-		if result == "" {
-			log.Infof("Failed to get IPv6 result! Interface: %s, return value: %s\n", url, result)
-		}
-		return result
-	}
-	return ""
+// Backoff 重试策略, 连续失败未达到 threshold 次时按 retry 重试, 之后按指数退避, 间隔为 0 到上限之间的随机值
+type Backoff struct {
+	// 重试间隔秒数, 默认 30, 不超过正常运行的间隔
+	Retry int64 `yaml:",omitempty" json:"retry,omitempty"`
+	// 退避的最长间隔秒数, 默认 3600, 可以超过正常运行的间隔, 以便服务商限流时放慢请求
+	Max int64 `yaml:",omitempty" json:"max,omitempty"`
+	// 每次退避间隔的倍数, 默认 2
+	Multiplier float64 `yaml:",omitempty" json:"multiplier,omitempty"`
+	// 连续失败多少次后进入退避, 默认 3; 获取IP的策略同时为将域名标记为失败的次数
+	Threshold int `yaml:",omitempty" json:"threshold,omitempty"`
 }
 
-// GetIpv6Addr 获得IPv6地址
-func (conf *DDnsConfig) GetIpv6Addr() (result string) {
-	log := logger.Default()
-	// 判断从哪里获取IP
-	switch conf.Ipv6.GetType {
-	case "netInterface":
-		// 从网卡获取 IP
-		return conf.getIpv6AddrFromInterface()
-	case "url":
-		// 从 URL 获取 IP
-		return conf.getIpv6AddrFromUrl()
-	case "cmd":
-		// 从命令行获取 IP
-		return conf.getAddrFromCmd("IPv6")
-	default:
-		log.Infof("Unknown way to get IP for IPv6!")
-		return "" // unknown type
-	}
+// DDnsConfig 配置
+type DDnsConfig struct {
+	Name  string `json:"name"`
+	Delay int64  `yaml:",omitempty" json:"delay"`
+	Ipv4  *Ipv4  `yaml:",omitempty"  json:"ipv4"`
+	Ipv6  *Ipv6  `yaml:",omitempty" json:"ipv6"`
+	// 按名称引用的获取IP的方式, 域名后用 ?source=名称 指定, 如 wan2.example.com?source=ppp1
+	// 同时用于 IPv4 和 IPv6, 名称不区分大小写
+	Sources map[string]*IPSource `yaml:",omitempty" json:"sources,omitempty"`
+	DNS     *DNS                 `yaml:",omitempty" json:"dns"`
+	TTL     string               `yaml:",omitempty" json:"ttl"`
+	Webhook *Webhook             `yaml:",omitempty" json:"webhook"`
+	// 失败后的重试策略, 未设置时使用默认值
+	Schedule *Schedule `yaml:",omitempty" json:"schedule,omitempty"`
 }
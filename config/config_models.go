@@ -37,7 +37,11 @@ type Webhook struct {
 	// #{ipv4Domains}=IPv4的域名，多个以,分割,
 	// #{ipv6Addr}=新的IPv6地址,
 	// #{ipv6Result}=IPv6地址更新结果: 未改变 失败 成功,
-	// #{ipv6Domains}=IPv6的域名，多个以,分割
+	// #{ipv6Domains}=IPv6的域名，多个以,分割,
+	// #{ipv4Results}/#{ipv6Results}=每个域名的更新结果, JSON数组,
+	// #{ipv4Source}/#{ipv6Source}=获得地址的方式, 如 stun:stun.cloudflare.com:3478,
+	// #{event}=触发的事件: RunCompleted 运行完成, BackoffEntered 连续失败进入退避, Recovered 退避后恢复,
+	// #{policy}=进入退避或恢复的失败类型 detection/provider, #{failures}=连续失败的次数, #{retry}=下次重试的间隔
 	WebhookURL string `json:"webhookURL"`
 	// 如 RequestBody 为空则为 GET 请求，否则为 POST 请求。支持的变量同上
 	WebhookRequestBody string `json:"webhookRequestBody"`
@@ -2,53 +2,182 @@ package parsing
 
 import (
 	"errors"
+	"fmt"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/core/ddns"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/core/service"
-	"github.com/jxo-me/ddns/sdk/ddns/alidns"
-	"github.com/jxo-me/ddns/sdk/ddns/baidu"
-	"github.com/jxo-me/ddns/sdk/ddns/callback"
-	"github.com/jxo-me/ddns/sdk/ddns/cloudflare"
-	"github.com/jxo-me/ddns/sdk/ddns/dnspod"
-	"github.com/jxo-me/ddns/sdk/ddns/godaddy"
-	"github.com/jxo-me/ddns/sdk/ddns/google"
-	"github.com/jxo-me/ddns/sdk/ddns/huawei"
-	"github.com/jxo-me/ddns/sdk/ddns/namecheap"
-	"github.com/jxo-me/ddns/sdk/ddns/namesilo"
-	"github.com/jxo-me/ddns/sdk/ddns/porkbun"
-	"github.com/jxo-me/ddns/sdk/ddns/tencent"
+	"github.com/jxo-me/ddns/sdk/app"
+	"github.com/jxo-me/ddns/sdk/cache"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/hook"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/registry"
 	xservice "github.com/jxo-me/ddns/sdk/service"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	ErrDnsNotSupported = errors.New("dns not supported")
-	DDNS               = map[string]ddns.IDDNS{
-		alidns.Code:     &alidns.Alidns{},
-		baidu.Code:      &baidu.BaiduCloud{},
-		callback.Code:   &callback.Callback{},
-		cloudflare.Code: &cloudflare.Cloudflare{},
-		dnspod.Code:     &dnspod.Dnspod{},
-		godaddy.Code:    &godaddy.GoDaddyDNS{},
-		google.Code:     &google.GoogleDomain{},
-		huawei.Code:     &huawei.Huaweicloud{},
-		namecheap.Code:  &namecheap.NameCheap{},
-		namesilo.Code:   &namesilo.NameSilo{},
-		porkbun.Code:    &porkbun.Porkbun{},
-		tencent.Code:    &tencent.TencentCloud{},
-	}
+	ErrDnsNotSupported  = errors.New("dns not supported")
+	ErrDnsNotConfigured = errors.New("dns not configured")
 )
 
+// ParseService 根据 dns.name 从服务商注册表中选择服务商, name 为自定义的唯一服务名称, 为空时使用 dns.name
 func ParseService(cfg *config.DDnsConfig, log logger.ILogger) (service.IDDNSService, error) {
-	var dns ddns.IDDNS
-	for name, iddns := range DDNS {
-		if cfg.Name == name {
-			dns = iddns
+	if cfg.DNS == nil || cfg.DNS.Name == "" {
+		return nil, fmt.Errorf("service %s: %w", cfg.Name, ErrDnsNotConfigured)
+	}
+	provider := registry.Providers().Get(cfg.DNS.Name)
+	if provider == nil {
+		return nil, fmt.Errorf("service %s: %w: %s", cfg.Name, ErrDnsNotSupported, cfg.DNS.Name)
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.DNS.Name
+	}
+	serviceLogger := log.WithFields(map[string]any{
+		"service": cfg.Name,
+		"dns":     cfg.DNS.Name,
+	})
+	if cfg.Ipv4 != nil && cfg.Ipv4.Enable && !provider.Capabilities.IPv4 {
+		serviceLogger.Warnf("%s does not support IPv4 records, IPv4 domains will be skipped", provider.Code)
+	}
+	if cfg.Ipv6 != nil && cfg.Ipv6.Enable && !provider.Capabilities.IPv6 {
+		serviceLogger.Warnf("%s does not support IPv6 records, IPv6 domains will be skipped", provider.Code)
+	}
+	if !provider.Capabilities.MultiValue && multiAddr(cfg) {
+		serviceLogger.Warnf("%s does not support multi-value records, only the first address will be written", provider.Code)
+	}
+	sources, err := parseIPSources(cfg, serviceLogger)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", cfg.Name, err)
+	}
+	bus := app.Runtime.EventBus()
+	if cfg.Webhook != nil {
+		webhook := hook.NewHook(cfg.Webhook.WebhookURL, cfg.Webhook.WebhookRequestBody, cfg.Webhook.WebhookHeaders, serviceLogger)
+		if err = webhook.Subscribe(bus, cfg.Name); err != nil {
+			return nil, fmt.Errorf("service %s: %w", cfg.Name, err)
 		}
 	}
-	if dns == nil {
-		return nil, ErrDnsNotSupported
+	s := xservice.NewDDNSService(provider.New(), sources, bus, serviceLogger, cfg)
+	s.Capabilities = &provider.Capabilities
+	if s.NamedSources, err = parseNamedSources(cfg, serviceLogger); err != nil {
+		return nil, fmt.Errorf("service %s: %w", cfg.Name, err)
 	}
-	s := xservice.NewDDNSService(dns, log, cfg)
 	return s, nil
 }
+
+// multiAddr 是否有启用的获取IP的方式为多地址模式
+func multiAddr(cfg *config.DDnsConfig) bool {
+	if (cfg.Ipv4 != nil && cfg.Ipv4.Enable && cfg.Ipv4.MultiAddr) || (cfg.Ipv6 != nil && cfg.Ipv6.Enable && cfg.Ipv6.MultiAddr) {
+		return true
+	}
+	for _, source := range cfg.Sources {
+		if source != nil && source.MultiAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPSources 根据 getType 创建 IPv4/IPv6 获取IP的方式, 未启用时为 nil
+func parseIPSources(cfg *config.DDnsConfig, log logger.ILogger) (sources [2]iIPSource.IIPSource, err error) {
+	if cfg.Ipv4 != nil && cfg.Ipv4.Enable {
+		if sources[0], err = newIPSource(iIPSource.IPv4, &cfg.Ipv4.IPSource, cfg.Ipv4.Allow, cfg.Ipv4.Deny, log); err != nil {
+			return
+		}
+	}
+	if cfg.Ipv6 != nil && cfg.Ipv6.Enable {
+		if sources[1], err = newIPSource(iIPSource.IPv6, &cfg.Ipv6.IPSource, cfg.Ipv6.Allow, cfg.Ipv6.Deny, log); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// newIPSource 创建获取IP的方式并按 allow/deny 过滤地址
+// getType 有多个时依次尝试, 每个方式的地址单独过滤, 被拒绝时尝试下一个; 不支持该地址类型的方式被跳过
+// 类型:秒数 为该方式单独的超时, 没有时使用 conf.Timeout
+func newIPSource(family iIPSource.Family, conf *config.IPSource, allow, deny []string, log logger.ILogger) (iIPSource.IIPSource, error) {
+	types := strings.Split(conf.GetType, ",")
+	if len(types) == 1 && !strings.Contains(conf.GetType, ":") {
+		source, err := ipsource.New(family, conf, log)
+		if err != nil {
+			return nil, err
+		}
+		return ipsource.NewFilter(source, family, allow, deny)
+	}
+	var sources []ipsource.ChainSource
+	for _, typ := range types {
+		c := *conf
+		typ, timeout, err := chainEntry(typ)
+		if err != nil {
+			return nil, err
+		}
+		c.GetType = typ
+		source, err := ipsource.New(family, &c, log)
+		if errors.Is(err, ipsource.ErrFamilyNotSupported) {
+			log.Debugf("Skipping %s: %s", c.GetType, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if source, err = ipsource.NewFilter(source, family, allow, deny); err != nil {
+			return nil, err
+		}
+		sources = append(sources, ipsource.ChainSource{IIPSource: source, Timeout: timeout})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: %s %q", ipsource.ErrFamilyNotSupported, family, conf.GetType)
+	}
+	return ipsource.NewChain(sources, time.Duration(conf.Timeout)*time.Second, log), nil
+}
+
+// chainEntry 解析 getType 中的一项, 类型:秒数 为该方式单独的超时, 如 stun:5
+func chainEntry(entry string) (string, time.Duration, error) {
+	typ, seconds, ok := strings.Cut(strings.TrimSpace(entry), ":")
+	if !ok {
+		return typ, 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(seconds))
+	if err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("invalid timeout of ip source %q", entry)
+	}
+	return strings.TrimSpace(typ), time.Duration(n) * time.Second, nil
+}
+
+// parseNamedSources 为启用的 IPv4/IPv6 创建按名称引用的获取IP的方式, 不支持该地址类型的方式被跳过
+func parseNamedSources(cfg *config.DDnsConfig, log logger.ILogger) (sources [2]map[string]*xddns.Source, err error) {
+	if len(cfg.Sources) == 0 {
+		return
+	}
+	for i, family := range []iIPSource.Family{iIPSource.IPv4, iIPSource.IPv6} {
+		var allow, deny []string
+		switch {
+		case family == iIPSource.IPv4 && cfg.Ipv4 != nil && cfg.Ipv4.Enable:
+			allow, deny = cfg.Ipv4.Allow, cfg.Ipv4.Deny
+		case family == iIPSource.IPv6 && cfg.Ipv6 != nil && cfg.Ipv6.Enable:
+			allow, deny = cfg.Ipv6.Allow, cfg.Ipv6.Deny
+		default:
+			continue
+		}
+		sources[i] = make(map[string]*xddns.Source, len(cfg.Sources))
+		for name, conf := range cfg.Sources {
+			if conf == nil {
+				continue
+			}
+			source, err := newIPSource(family, conf, allow, deny, log.WithFields(map[string]any{"source": name}))
+			if errors.Is(err, ipsource.ErrFamilyNotSupported) {
+				log.Debugf("Source %s does not support %s: %s", name, family, err)
+				continue
+			}
+			if err != nil {
+				return sources, fmt.Errorf("source %s: %w", name, err)
+			}
+			sources[i][strings.ToLower(name)] = &xddns.Source{IPSource: source, Cache: &cache.IpCache{}}
+		}
+	}
+	return
+}
@@ -10,6 +10,8 @@ const (
 	UpdatedFailed = "Failure"
 	// UpdatedSuccess 更新成功
 	UpdatedSuccess = "Success"
+	// UpdatedPlanned 预览模式下将要新增或更新
+	UpdatedPlanned = "Planned"
 )
 
 const (
@@ -17,10 +19,3 @@ const (
 	DefaultDDNSName         = "default"
 	NetworkConnectedTimeout = 5
 )
-
-const (
-	StatusReady   int32 = 0  // Job or Timer is ready for running.
-	StatusRunning int32 = 1  // Job or Timer is already running.
-	StatusStopped int32 = 2  // Job or Timer is stopped.
-	StatusClosed  int32 = -1 // Job or Timer is closed and waiting to be deleted.
-)
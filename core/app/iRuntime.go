@@ -1,10 +1,12 @@
 package app
 
 import (
+	"github.com/jxo-me/ddns/core/event"
 	reg "github.com/jxo-me/ddns/core/registry"
 	"github.com/jxo-me/ddns/core/service"
 )
 
 type IRuntime interface {
 	DDNSRegistry() reg.IRegistry[service.IDDNSService]
+	EventBus() event.IBus
 }
@@ -1,18 +1,41 @@
 package ddns
 
 import (
+	"context"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/core/cache"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/sdk/ddns"
 )
 
 // IDDNS interface
+// AddUpdateDomainRecords 已加入 ctx 参数, 之前实现的服务商须修改签名, 或通过 FromLegacy 转换
 type IDDNS interface {
 	String() string
 	// Endpoint GetEndpoint
 	Endpoint() string
-	Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger)
-	// AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
+	// Init 初始化, domains 为已获取新IP的域名
+	Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger)
+	// AddUpdateDomainRecords 添加或更新IPv4/IPv6记录, ctx 取消时中止进行中的请求
+	AddUpdateDomainRecords(ctx context.Context) (domains ddns.Domains)
+}
+
+// ILegacyDDNS AddUpdateDomainRecords 没有 ctx 参数的服务商, 通过 FromLegacy 转换为 IDDNS
+type ILegacyDDNS interface {
+	String() string
+	Endpoint() string
+	Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger)
 	AddUpdateDomainRecords() (domains ddns.Domains)
 }
+
+// FromLegacy 将 ILegacyDDNS 转换为 IDDNS, ctx 被忽略, 停止服务时不会中止进行中的请求
+func FromLegacy(d ILegacyDDNS) IDDNS {
+	return legacyDDNS{d}
+}
+
+type legacyDDNS struct {
+	ILegacyDDNS
+}
+
+func (l legacyDDNS) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	return l.ILegacyDDNS.AddUpdateDomainRecords()
+}
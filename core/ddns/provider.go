@@ -0,0 +1,25 @@
+package ddns
+
+// NewDDNS 创建一个新的服务商实例, 每个服务都会得到独立的实例
+type NewDDNS func() IDDNS
+
+// Capabilities 服务商支持的能力
+type Capabilities struct {
+	// IPv4/IPv6 是否支持A/AAAA记录
+	IPv4 bool `json:"ipv4"`
+	IPv6 bool `json:"ipv6"`
+	// ReadRecords 是否可以查询现有的解析记录, 否则只能直接提交新的IP
+	ReadRecords bool `json:"readRecords"`
+	// CustomParams 是否支持域名后的自定义参数, 如 ?RecordId=123
+	CustomParams bool `json:"customParams"`
+	// MultiValue 是否支持多值记录, 获取IP的方式为多地址模式时同步所有地址
+	MultiValue bool `json:"multiValue"`
+}
+
+// Provider 服务商注册信息
+type Provider struct {
+	// Code 服务商代码, 与配置中的 dns.name 对应
+	Code         string
+	New          NewDDNS
+	Capabilities Capabilities
+}
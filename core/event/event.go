@@ -0,0 +1,72 @@
+package event
+
+import (
+	"context"
+	"github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/sdk/ddns"
+	"time"
+)
+
+// Type 事件类型
+type Type string
+
+const (
+	// IPDetected 获取到IP, Family/Detection 有值
+	IPDetected Type = "IPDetected"
+	// IPDetectionFailed 获取IP失败, Family/Detection/Err 有值
+	IPDetectionFailed Type = "IPDetectionFailed"
+	// RecordCreated 新增了记录, Result 有值, 以下同
+	RecordCreated Type = "RecordCreated"
+	// RecordUpdated 更新了记录
+	RecordUpdated Type = "RecordUpdated"
+	// RecordUnchanged 记录未改变或未请求服务商
+	RecordUnchanged Type = "RecordUnchanged"
+	// UpdateFailed 更新失败
+	UpdateFailed Type = "UpdateFailed"
+	// RunCompleted 一次获取IP和更新完成, Domains 有值
+	RunCompleted Type = "RunCompleted"
+	// ServiceStarted 服务启动
+	ServiceStarted Type = "ServiceStarted"
+	// ServiceStopped 服务停止
+	ServiceStopped Type = "ServiceStopped"
+	// BackoffEntered 连续失败达到阈值, 开始退避, Policy/Failures/Retry 有值
+	BackoffEntered Type = "BackoffEntered"
+	// Recovered 退避后恢复正常, Policy/Failures 有值
+	Recovered Type = "Recovered"
+)
+
+// Event 事件
+type Event struct {
+	Type Type
+	// Service 产生事件的服务名称
+	Service string
+	Time    time.Time
+	// Family 地址类型, 获取IP的事件
+	Family    ipsource.Family
+	Detection *ipsource.Result
+	// Result 单个域名的更新结果, 记录相关的事件
+	Result *ddns.UpdateResult
+	// Domains 一次运行的所有结果
+	Domains *ddns.Domains
+	Err     error
+	// Policy 失败的类型 detection/provider, 退避相关的事件
+	Policy string
+	// Failures 连续失败的次数
+	Failures int
+	// Retry 下次重试的间隔
+	Retry time.Duration
+}
+
+// Handler 处理事件, ctx 在总线关闭时取消
+type Handler func(ctx context.Context, e *Event)
+
+// IBus 事件总线, 每个订阅者独立处理事件, 慢的订阅者不会阻塞发布者和其它订阅者
+type IBus interface {
+	// Publish 发布事件, 不会阻塞
+	Publish(e *Event)
+	// Subscribe 订阅事件, types 为空时订阅所有类型
+	Subscribe(name string, handler Handler, types ...Type) error
+	Unsubscribe(name string)
+	// Close 不再接收新事件, 等待订阅者处理完已发布的事件
+	Close()
+}
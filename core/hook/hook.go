@@ -1,11 +1,12 @@
 package hook
 
 import (
+	"context"
 	"github.com/jxo-me/ddns/consts"
 	"github.com/jxo-me/ddns/sdk/ddns"
 )
 
 type IHook interface {
 	String() string
-	ExecHook(domains *ddns.Domains) (consts.UpdateStatusType, consts.UpdateStatusType)
+	ExecHook(ctx context.Context, domains *ddns.Domains) (consts.UpdateStatusType, consts.UpdateStatusType)
 }
@@ -0,0 +1,44 @@
+package ipsource
+
+import (
+	"context"
+	"github.com/jxo-me/ddns/config"
+	"github.com/jxo-me/ddns/core/logger"
+)
+
+// Family 地址类型
+type Family string
+
+const (
+	IPv4 Family = "IPv4"
+	IPv6 Family = "IPv6"
+)
+
+// Result 获取IP的结果
+type Result struct {
+	Addr string `json:"addr"`
+	// Addrs 多地址模式下获取到的所有地址, Addr 为其中第一个
+	Addrs []string `json:"addrs,omitempty"`
+	// Source 获得地址的来源, 如 url:https://4.ipw.cn
+	Source string `json:"source"`
+	// Details 诊断信息, 如每个URL的错误、命令的输出
+	Details map[string]string `json:"details,omitempty"`
+	// Error 获取失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// IIPSource 获取IP的方式
+type IIPSource interface {
+	String() string
+	// GetAddr 获取地址, 失败时返回的 Result 仍可能包含诊断信息
+	GetAddr(ctx context.Context) (*Result, error)
+}
+
+// IWatcher 可以通知地址变化的 IIPSource, 收到通知后立即获取地址, 不必等待下次定时更新
+type IWatcher interface {
+	// Watch 地址可能变化时向返回的 channel 发送, 多次变化可能只通知一次, ctx 结束后不再发送
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// NewIPSource 根据配置创建获取指定类型地址的 IIPSource
+type NewIPSource func(family Family, conf *config.IPSource, log logger.ILogger) (IIPSource, error)
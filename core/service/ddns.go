@@ -1,7 +1,22 @@
 package service
 
+import (
+	"context"
+	"github.com/jxo-me/ddns/sdk/ddns"
+)
+
 type IDDNSService interface {
 	String() string
+	// Start 等待网络连接后定时获取IP并更新, 阻塞直到 Stop
 	Start() error
+	// Stop 停止服务并中止进行中的请求, 停止后不可再启动
 	Stop() error
+	// Pause 暂停定时更新, 可通过 Resume 恢复
+	Pause() error
+	Resume() error
+	State() State
+	// Run 获取IP并更新一次, 返回每个域名的更新结果
+	Run(ctx context.Context) ddns.Domains
+	// Plan 预览模式, 只查询服务商现有记录, 返回每个域名将要执行的动作
+	Plan(ctx context.Context) ddns.Domains
 }
@@ -0,0 +1,27 @@
+package service
+
+// State 服务状态
+type State int32
+
+const (
+	StateReady      State = iota // 已创建, 尚未启动
+	StateStarting                // 等待网络连接
+	StateRunning                 // 定时获取IP并更新
+	StatePaused                  // 已暂停, 不获取IP也不更新, 可恢复
+	StateRestarting              // 崩溃后等待重启
+	StateStopped                 // 已停止, 不可恢复
+)
+
+var stateNames = [...]string{"ready", "starting", "running", "paused", "restarting", "stopped"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// MarshalText 序列化为状态名称, 如 running
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -13,6 +13,15 @@ var dialer = &net.Dialer{
 	KeepAlive: 30 * time.Second,
 }
 
+// NewDialer 返回与所有 HTTP Client 相同的超时、KeepAlive 和 DNS 解析器(-dns 设置)的 Dialer, 可再设置源地址等
+func NewDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   dialer.Timeout,
+		KeepAlive: dialer.KeepAlive,
+		Resolver:  dialer.Resolver,
+	}
+}
+
 var defaultTransport = &http.Transport{
 	// from http.DefaultTransport
 	Proxy: http.ProxyFromEnvironment,
@@ -81,6 +90,18 @@ func CreateNoProxyHTTPClient(network string) *http.Client {
 	}
 }
 
+// CreateNoProxyDialHTTPClient 不使用代理, 通过 dial 以 network 建立连接的 HTTP Client, 如指定出口网卡或源地址
+func CreateNoProxyDialHTTPClient(network string, dial func(ctx context.Context, network, address string) (net.Conn, error)) *http.Client {
+	transport := noProxyTcp4Transport.Clone()
+	transport.DialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+		return dial(ctx, network, address)
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+}
+
 // SetInsecureSkipVerify 将所有 http.Transport 的 InsecureSkipVerify 设置为 true
 func SetInsecureSkipVerify() {
 	transports := []*http.Transport{defaultTransport, noProxyTcp4Transport, noProxyTcp6Transport}
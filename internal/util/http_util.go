@@ -2,22 +2,36 @@ package util
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 )
 
+// HTTPError 服务商返回的异常状态码
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("request %s failed! status code: %d, response: %s", e.URL, e.StatusCode, string(e.Body))
+}
+
 // GetHTTPResponse 处理HTTP结果，返回序列化的json
+// 状态码异常时仍会尝试解析返回内容，以便获取服务商的错误码
 func GetHTTPResponse(resp *http.Response, url string, err error, result interface{}) error {
 	body, err := GetHTTPResponseOrg(resp, url, err)
 
-	if err == nil {
+	var httpErr *HTTPError
+	if err == nil || errors.As(err, &httpErr) {
 		// log.Println(string(body))
 		if len(body) != 0 {
-			err = json.Unmarshal(body, &result)
-			if err != nil {
-				log.Printf("请求接口%s解析json结果失败! ERROR: %s\n", url, err)
+			if jsonErr := json.Unmarshal(body, &result); jsonErr != nil && err == nil {
+				err = jsonErr
+				log.Printf("Failed to parse JSON response from %s! ERROR: %s\n", url, err)
 			}
 		}
 	}
@@ -29,7 +43,7 @@ func GetHTTPResponse(resp *http.Response, url string, err error, result interfac
 // GetHTTPResponseOrg 处理HTTP结果，返回byte
 func GetHTTPResponseOrg(resp *http.Response, url string, err error) ([]byte, error) {
 	if err != nil {
-		log.Printf("请求接口%s失败! ERROR: %s\n", url, err)
+		log.Printf("Request %s failed! ERROR: %s\n", url, err)
 		return nil, err
 	}
 
@@ -37,14 +51,17 @@ func GetHTTPResponseOrg(resp *http.Response, url string, err error) ([]byte, err
 	body, err := io.ReadAll(resp.Body)
 
 	if err != nil {
-		log.Printf("请求接口%s失败! ERROR: %s\n", url, err)
+		log.Printf("Request %s failed! ERROR: %s\n", url, err)
 	}
 
 	// 300及以上状态码都算异常
 	if resp.StatusCode >= 300 {
-		errMsg := fmt.Sprintf("请求接口 %s 失败! 返回内容: %s ,返回状态码: %d\n", url, string(body), resp.StatusCode)
-		log.Println(errMsg)
-		err = fmt.Errorf(errMsg)
+		err = &HTTPError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Body:       body,
+		}
+		log.Println(err)
 	}
 
 	return body, err
@@ -12,3 +12,11 @@ func WriteString(strs ...string) string {
 
 	return b.String()
 }
+
+// Truncate 截断过长的字符串, 用于日志和诊断信息
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
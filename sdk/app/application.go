@@ -2,8 +2,10 @@ package app
 
 import (
 	"github.com/jxo-me/ddns/core/app"
+	iEvent "github.com/jxo-me/ddns/core/event"
 	reg "github.com/jxo-me/ddns/core/registry"
 	"github.com/jxo-me/ddns/core/service"
+	"github.com/jxo-me/ddns/sdk/event"
 	"github.com/jxo-me/ddns/sdk/registry"
 )
 
@@ -13,11 +15,13 @@ var (
 
 type Application struct {
 	ddnsReg reg.IRegistry[service.IDDNSService]
+	bus     iEvent.IBus
 }
 
 func NewConfig() *Application {
 	a := Application{
 		ddnsReg: new(registry.DDNSRegistry),
+		bus:     event.NewBus(event.DefaultQueueSize, nil),
 	}
 
 	return &a
@@ -26,3 +30,8 @@ func NewConfig() *Application {
 func (a *Application) DDNSRegistry() reg.IRegistry[service.IDDNSService] {
 	return a.ddnsReg
 }
+
+// EventBus 全局的事件总线
+func (a *Application) EventBus() iEvent.IBus {
+	return a.bus
+}
@@ -2,12 +2,13 @@ package alidns
 
 import (
 	"bytes"
+	"context"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 	"net/url"
 )
@@ -17,6 +18,15 @@ const (
 	Code     string = "alidns"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Alidns{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: true,
+	})
+}
+
 type Config struct {
 	AccessKeyID     string `json:"accessKeyId"`
 	AccessKeySecret string `json:"accessKeySecret"`
@@ -40,6 +50,7 @@ type AlidnsRecord struct {
 
 // AlidnsSubDomainRecords 记录
 type AlidnsSubDomainRecords struct {
+	AlidnsStatus
 	TotalCount    int
 	DomainRecords struct {
 		Record []AlidnsRecord
@@ -48,8 +59,15 @@ type AlidnsSubDomainRecords struct {
 
 // AlidnsResp 修改/添加返回结果
 type AlidnsResp struct {
-	RecordID  string
+	AlidnsStatus
+	RecordID string
+}
+
+// AlidnsStatus 公共返回结果, 失败时 Code/Message 不为空
+type AlidnsStatus struct {
 	RequestID string
+	Code      string
+	Message   string
 }
 
 func (ali *Alidns) String() string {
@@ -61,12 +79,9 @@ func (ali *Alidns) Endpoint() string {
 }
 
 // Init 初始化
-func (ali *Alidns) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	ali.Domains.Ipv4Cache = ipv4cache
-	ali.Domains.Ipv6Cache = ipv6cache
-	ali.Domains.Logger = log
+func (ali *Alidns) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	ali.Domains = domains
 	ali.DNS = dnsConf.DNS
-	ali.Domains.GetNewIp(dnsConf)
 	ali.logger = log
 	if dnsConf.TTL == "" {
 		// 默认600s
@@ -77,13 +92,13 @@ func (ali *Alidns) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ip
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (ali *Alidns) AddUpdateDomainRecords() ddns.Domains {
-	ali.addUpdateDomainRecords("A")
-	ali.addUpdateDomainRecords("AAAA")
+func (ali *Alidns) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	ali.addUpdateDomainRecords(ctx, "A")
+	ali.addUpdateDomainRecords(ctx, "AAAA")
 	return ali.Domains
 }
 
-func (ali *Alidns) addUpdateDomainRecords(recordType string) {
+func (ali *Alidns) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := ali.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -91,6 +106,8 @@ func (ali *Alidns) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
 		var records AlidnsSubDomainRecords
 		// 获取当前域名信息
 		params := domain.GetCustomParams()
@@ -98,11 +115,12 @@ func (ali *Alidns) addUpdateDomainRecords(recordType string) {
 		params.Set("DomainName", domain.DomainName)
 		params.Set("SubDomain", domain.GetFullDomain())
 		params.Set("Type", recordType)
-		err := ali.request(params, &records)
+		err := ali.request(ctx, params, &records)
 
 		if err != nil {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			ali.logger.Infof("Failed to query records of %s! Code: %s, Message: %s", domain, records.Code, records.Message)
+			domain.Fail(ddns.ActionSkip, err, records.Code, records.Message)
+			continue
 		}
 
 		if records.TotalCount > 0 {
@@ -116,17 +134,22 @@ func (ali *Alidns) addUpdateDomainRecords(recordType string) {
 				}
 			}
 			// 存在，更新
-			ali.modify(recordSelected, domain, recordType, ipAddr)
+			ali.modify(ctx, recordSelected, domain, recordType, ipAddr)
 		} else {
 			// 不存在，创建
-			ali.create(domain, recordType, ipAddr)
+			ali.create(ctx, domain, recordType, ipAddr)
 		}
 
 	}
 }
 
 // 创建
-func (ali *Alidns) create(domain *ddns.Domain, recordType string, ipAddr string) {
+func (ali *Alidns) create(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
+	if ali.Domains.DryRun {
+		ali.logger.Infof("Will create record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
 	params := domain.GetCustomParams()
 	params.Set("Action", "AddDomainRecord")
 	params.Set("DomainName", domain.DomainName)
@@ -136,23 +159,29 @@ func (ali *Alidns) create(domain *ddns.Domain, recordType string, ipAddr string)
 	params.Set("TTL", ali.TTL)
 
 	var result AlidnsResp
-	err := ali.request(params, &result)
+	err := ali.request(ctx, params, &result)
 
 	if err == nil && result.RecordID != "" {
-		ali.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		ali.logger.Infof("Created record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", result.RecordID)
 	} else {
-		ali.logger.Infof("新增域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		ali.logger.Infof("Failed to create record %s! Code: %s, Message: %s", domain, result.Code, result.Message)
+		domain.Fail(ddns.ActionCreate, err, result.Code, result.Message)
 	}
 }
 
 // 修改
-func (ali *Alidns) modify(recordSelected AlidnsRecord, domain *ddns.Domain, recordType string, ipAddr string) {
+func (ali *Alidns) modify(ctx context.Context, recordSelected AlidnsRecord, domain *ddns.Domain, recordType string, ipAddr string) {
 
 	// 相同不修改
 	if recordSelected.Value == ipAddr {
-		ali.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+		ali.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+		domain.Noop(recordSelected.RecordID)
+		return
+	}
+	if ali.Domains.DryRun {
+		ali.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionUpdate, recordSelected.Value, recordSelected.RecordID)
 		return
 	}
 
@@ -165,23 +194,24 @@ func (ali *Alidns) modify(recordSelected AlidnsRecord, domain *ddns.Domain, reco
 	params.Set("TTL", ali.TTL)
 
 	var result AlidnsResp
-	err := ali.request(params, &result)
+	err := ali.request(ctx, params, &result)
 
 	if err == nil && result.RecordID != "" {
-		ali.logger.Infof("更新域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		ali.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionUpdate, recordSelected.Value, result.RecordID)
 	} else {
-		ali.logger.Infof("更新域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		ali.logger.Infof("Failed to update record %s! Code: %s, Message: %s", domain, result.Code, result.Message)
+		domain.Fail(ddns.ActionUpdate, err, result.Code, result.Message)
 	}
 }
 
 // request 统一请求接口
-func (ali *Alidns) request(params url.Values, result interface{}) (err error) {
+func (ali *Alidns) request(ctx context.Context, params url.Values, result interface{}) (err error) {
 
 	AliyunSigner(ali.DNS.ID, ali.DNS.Secret, &params)
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"GET",
 		Endpoint,
 		bytes.NewBuffer(nil),
@@ -189,7 +219,7 @@ func (ali *Alidns) request(params url.Values, result interface{}) (err error) {
 	req.URL.RawQuery = params.Encode()
 
 	if err != nil {
-		ali.logger.Infof("http.NewRequest失败. Error: ", err)
+		ali.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
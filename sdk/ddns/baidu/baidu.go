@@ -2,13 +2,14 @@ package baidu
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 	"strconv"
 )
@@ -20,6 +21,15 @@ const (
 	Code     = "baidu"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &BaiduCloud{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: false,
+	})
+}
+
 type BaiduCloud struct {
 	DNS     *config.DNS
 	Domains ddns.Domains
@@ -41,10 +51,18 @@ type BaiduRecord struct {
 
 // BaiduRecordsResp 获取解析列表拿到的结果
 type BaiduRecordsResp struct {
+	BaiduStatus
 	TotalCount int           `json:"totalCount"`
 	Result     []BaiduRecord `json:"result"`
 }
 
+// BaiduStatus 失败时返回的错误码和错误信息
+type BaiduStatus struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestId string `json:"requestId"`
+}
+
 // BaiduListRequest 获取解析列表请求的body json
 type BaiduListRequest struct {
 	Domain   string `json:"domain"`
@@ -80,12 +98,9 @@ func (baidu *BaiduCloud) Endpoint() string {
 	return Endpoint
 }
 
-func (baidu *BaiduCloud) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	baidu.Domains.Ipv4Cache = ipv4cache
-	baidu.Domains.Ipv6Cache = ipv6cache
-	baidu.Domains.Logger = log
+func (baidu *BaiduCloud) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	baidu.Domains = domains
 	baidu.DNS = dnsConf.DNS
-	baidu.Domains.GetNewIp(dnsConf)
 	baidu.logger = log
 	if dnsConf.TTL == "" {
 		// 默认300s
@@ -101,19 +116,21 @@ func (baidu *BaiduCloud) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCac
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (baidu *BaiduCloud) AddUpdateDomainRecords() ddns.Domains {
-	baidu.addUpdateDomainRecords("A")
-	baidu.addUpdateDomainRecords("AAAA")
+func (baidu *BaiduCloud) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	baidu.addUpdateDomainRecords(ctx, "A")
+	baidu.addUpdateDomainRecords(ctx, "AAAA")
 	return baidu.Domains
 }
 
-func (baidu *BaiduCloud) addUpdateDomainRecords(recordType string) {
+func (baidu *BaiduCloud) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := baidu.Domains.GetNewIpResult(recordType)
 	if ipAddr == "" {
 		return
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
 		var records BaiduRecordsResp
 
 		requestBody := BaiduListRequest{
@@ -122,30 +139,36 @@ func (baidu *BaiduCloud) addUpdateDomainRecords(recordType string) {
 			PageSize: 1000,
 		}
 
-		err := baidu.request("POST", Endpoint+"/v1/domain/resolve/list", requestBody, &records)
+		err := baidu.request(ctx, "POST", Endpoint+"/v1/domain/resolve/list", requestBody, &records)
 		if err != nil {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			baidu.logger.Infof("Failed to list records of %s! Code: %s, Message: %s", domain, records.Code, records.Message)
+			domain.Fail(ddns.ActionSkip, err, records.Code, records.Message)
+			continue
 		}
 
 		find := false
 		for _, record := range records.Result {
 			if record.Domain == domain.GetSubDomain() {
 				//存在就去更新
-				baidu.modify(record, domain, recordType, ipAddr)
+				baidu.modify(ctx, record, domain, recordType, ipAddr)
 				find = true
 				break
 			}
 		}
 		if !find {
 			//没找到，去创建
-			baidu.create(domain, recordType, ipAddr)
+			baidu.create(ctx, domain, recordType, ipAddr)
 		}
 	}
 }
 
 // create 创建新的解析
-func (baidu *BaiduCloud) create(domain *ddns.Domain, recordType string, ipAddr string) {
+func (baidu *BaiduCloud) create(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
+	if baidu.Domains.DryRun {
+		baidu.logger.Infof("Will create record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
 	var baiduCreateRequest = BaiduCreateRequest{
 		Domain:   domain.GetSubDomain(), //处理一下@
 		RdType:   recordType,
@@ -155,21 +178,27 @@ func (baidu *BaiduCloud) create(domain *ddns.Domain, recordType string, ipAddr s
 	}
 	var result BaiduRecordsResp
 
-	err := baidu.request("POST", Endpoint+"/v1/domain/resolve/add", baiduCreateRequest, &result)
+	err := baidu.request(ctx, "POST", Endpoint+"/v1/domain/resolve/add", baiduCreateRequest, &result)
 	if err == nil {
-		baidu.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		baidu.logger.Infof("Created record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", "")
 	} else {
-		baidu.logger.Infof("新增域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		baidu.logger.Infof("Failed to create record %s! Code: %s, Message: %s", domain, result.Code, result.Message)
+		domain.Fail(ddns.ActionCreate, err, result.Code, result.Message)
 	}
 }
 
 // modify 更新解析
-func (baidu *BaiduCloud) modify(record BaiduRecord, domain *ddns.Domain, rdType string, ipAddr string) {
+func (baidu *BaiduCloud) modify(ctx context.Context, record BaiduRecord, domain *ddns.Domain, rdType string, ipAddr string) {
 	//没有变化直接跳过
 	if record.Rdata == ipAddr {
-		baidu.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+		baidu.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+		domain.Noop(strconv.FormatUint(uint64(record.RecordId), 10))
+		return
+	}
+	if baidu.Domains.DryRun {
+		baidu.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionUpdate, record.Rdata, strconv.FormatUint(uint64(record.RecordId), 10))
 		return
 	}
 	var baiduModifyRequest = BaiduModifyRequest{
@@ -183,31 +212,33 @@ func (baidu *BaiduCloud) modify(record BaiduRecord, domain *ddns.Domain, rdType
 	}
 	var result BaiduRecordsResp
 
-	err := baidu.request("POST", Endpoint+"/v1/domain/resolve/edit", baiduModifyRequest, &result)
+	err := baidu.request(ctx, "POST", Endpoint+"/v1/domain/resolve/edit", baiduModifyRequest, &result)
+	recordID := strconv.FormatUint(uint64(record.RecordId), 10)
 	if err == nil {
-		baidu.logger.Infof("更新域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		baidu.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionUpdate, record.Rdata, recordID)
 	} else {
-		baidu.logger.Infof("更新域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		baidu.logger.Infof("Failed to update record %s! Code: %s, Message: %s", domain, result.Code, result.Message)
+		domain.Fail(ddns.ActionUpdate, err, result.Code, result.Message)
 	}
 }
 
 // request 统一请求接口
-func (baidu *BaiduCloud) request(method string, url string, data interface{}, result interface{}) (err error) {
+func (baidu *BaiduCloud) request(ctx context.Context, method string, url string, data interface{}, result interface{}) (err error) {
 	jsonStr := make([]byte, 0)
 	if data != nil {
 		jsonStr, _ = json.Marshal(data)
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		method,
 		url,
 		bytes.NewBuffer(jsonStr),
 	)
 
 	if err != nil {
-		baidu.logger.Infof("http.NewRequest失败. Error: ", err)
+		baidu.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
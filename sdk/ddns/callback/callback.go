@@ -1,13 +1,14 @@
 package callback
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 	"net/url"
 	"strings"
@@ -17,6 +18,15 @@ const (
 	Code = "callback"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Callback{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  false,
+		CustomParams: true,
+	})
+}
+
 type Callback struct {
 	DNS      *config.DNS
 	Domains  ddns.Domains
@@ -35,15 +45,12 @@ func (cb *Callback) Endpoint() string {
 }
 
 // Init 初始化
-func (cb *Callback) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	cb.Domains.Ipv4Cache = ipv4cache
-	cb.Domains.Ipv6Cache = ipv6cache
-	cb.Domains.Logger = log
-	cb.lastIpv4 = ipv4cache.GetAddr()
-	cb.lastIpv6 = ipv6cache.GetAddr()
+func (cb *Callback) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	cb.Domains = domains
+	cb.lastIpv4 = domains.Ipv4Cache.GetAddr()
+	cb.lastIpv6 = domains.Ipv6Cache.GetAddr()
 
 	cb.DNS = dnsConf.DNS
-	cb.Domains.GetNewIp(dnsConf)
 	cb.logger = log
 	if dnsConf.TTL == "" {
 		// 默认600
@@ -54,13 +61,13 @@ func (cb *Callback) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, i
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (cb *Callback) AddUpdateDomainRecords() ddns.Domains {
-	cb.addUpdateDomainRecords("A")
-	cb.addUpdateDomainRecords("AAAA")
+func (cb *Callback) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	cb.addUpdateDomainRecords(ctx, "A")
+	cb.addUpdateDomainRecords(ctx, "AAAA")
 	return cb.Domains
 }
 
-func (cb *Callback) addUpdateDomainRecords(recordType string) {
+func (cb *Callback) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := cb.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -70,17 +77,27 @@ func (cb *Callback) addUpdateDomainRecords(recordType string) {
 	// 防止多次发送Webhook通知
 	if recordType == "A" {
 		if cb.lastIpv4 == ipAddr {
-			cb.logger.Infof("你的IPv4未变化, 未触发Callback")
+			cb.logger.Infof("Your IPv4 has not changed, callback not triggered")
+			ddns.SkipDomains(domains, "IPv4 address unchanged")
 			return
 		}
 	} else {
 		if cb.lastIpv6 == ipAddr {
-			cb.logger.Infof("你的IPv6未变化, 未触发Callback")
+			cb.logger.Infof("Your IPv6 has not changed, callback not triggered")
+			ddns.SkipDomains(domains, "IPv6 address unchanged")
 			return
 		}
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		if cb.Domains.DryRun {
+			// 无法查询现有记录, 只能提交新的IP
+			cb.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+			domain.Plan(ddns.ActionUpdate, "", "")
+			continue
+		}
 		method := "GET"
 		postPara := ""
 		contentType := "application/x-www-form-urlencoded"
@@ -94,12 +111,14 @@ func (cb *Callback) addUpdateDomainRecords(recordType string) {
 		requestURL := replacePara(cb.DNS.ID, ipAddr, domain, recordType, cb.TTL)
 		u, err := url.Parse(requestURL)
 		if err != nil {
-			cb.logger.Infof("Callback的URL不正确")
+			cb.logger.Infof("Invalid callback URL! Err: %s", err)
+			domain.Fail(ddns.ActionUpdate, err, "", "invalid callback URL")
 			return
 		}
-		req, err := http.NewRequest(method, u.String(), strings.NewReader(postPara))
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(postPara))
 		if err != nil {
-			cb.logger.Infof("创建Callback请求异常, Err:", err)
+			cb.logger.Infof("Failed to create callback request! Err: %s", err)
+			domain.Fail(ddns.ActionUpdate, err, "", "")
 			return
 		}
 		req.Header.Add("content-type", contentType)
@@ -108,11 +127,11 @@ func (cb *Callback) addUpdateDomainRecords(recordType string) {
 		resp, err := clt.Do(req)
 		body, err := util.GetHTTPResponseOrg(resp, requestURL, err)
 		if err == nil {
-			cb.logger.Infof("Callback调用成功, 域名: %s, IP: %s, 返回数据: %s, \n", domain, ipAddr, string(body))
-			domain.UpdateStatus = consts.UpdatedSuccess
+			cb.logger.Infof("Callback succeeded, domain: %s, IP: %s, response: %s", domain, ipAddr, string(body))
+			domain.Succeed(ddns.ActionUpdate, "", "")
 		} else {
-			cb.logger.Infof("Callback调用失败，Err：%s\n", err)
-			domain.UpdateStatus = consts.UpdatedFailed
+			cb.logger.Infof("Callback failed! Err: %s", err)
+			domain.Fail(ddns.ActionUpdate, err, "", "")
 		}
 	}
 }
@@ -2,16 +2,19 @@ package cloudflare
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -19,6 +22,16 @@ const (
 	Code     string = "cloudflare"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Cloudflare{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: true,
+		MultiValue:   true,
+	})
+}
+
 // Cloudflare Cloudflare实现
 type Cloudflare struct {
 	DNS     *config.DNS
@@ -44,6 +57,12 @@ type CloudflareRecordsResp struct {
 	Result []CloudflareRecord
 }
 
+// CloudflareRecordResp 新增记录返回结果
+type CloudflareRecordResp struct {
+	CloudflareStatus
+	Result CloudflareRecord
+}
+
 // CloudflareRecord 记录实体
 type CloudflareRecord struct {
 	ID      string `json:"id"`
@@ -57,9 +76,24 @@ type CloudflareRecord struct {
 // CloudflareStatus 公共状态
 type CloudflareStatus struct {
 	Success  bool
+	Errors   []CloudflareError
 	Messages []string
 }
 
+// CloudflareError 错误信息
+type CloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorCode 返回第一个错误的错误码和错误信息
+func (s CloudflareStatus) errorCode() (code string, message string) {
+	if len(s.Errors) > 0 {
+		return strconv.Itoa(s.Errors[0].Code), s.Errors[0].Message
+	}
+	return "", strings.Join(s.Messages, "; ")
+}
+
 func (cf *Cloudflare) String() string {
 	return Code
 }
@@ -69,12 +103,9 @@ func (cf *Cloudflare) Endpoint() string {
 }
 
 // Init 初始化
-func (cf *Cloudflare) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	cf.Domains.Ipv4Cache = ipv4cache
-	cf.Domains.Ipv6Cache = ipv6cache
-	cf.Domains.Logger = log
+func (cf *Cloudflare) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	cf.Domains = domains
 	cf.DNS = dnsConf.DNS
-	cf.Domains.GetNewIp(dnsConf)
 	cf.logger = log
 	if dnsConf.TTL == "" {
 		// 默认1 auto ttl
@@ -90,13 +121,13 @@ func (cf *Cloudflare) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache,
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (cf *Cloudflare) AddUpdateDomainRecords() ddns.Domains {
-	cf.addUpdateDomainRecords("A")
-	cf.addUpdateDomainRecords("AAAA")
+func (cf *Cloudflare) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	cf.addUpdateDomainRecords(ctx, "A")
+	cf.addUpdateDomainRecords(ctx, "AAAA")
 	return cf.Domains
 }
 
-func (cf *Cloudflare) addUpdateDomainRecords(recordType string) {
+func (cf *Cloudflare) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := cf.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -104,17 +135,26 @@ func (cf *Cloudflare) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		values := domain.Values(ipAddr)
+		domain.Begin(recordType, strings.Join(values, ","))
 		// get zone
-		result, err := cf.getZones(domain)
+		result, err := cf.getZones(ctx, domain)
 		if err != nil || len(result.Result) != 1 {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			code, message := result.errorCode()
+			if err == nil {
+				message = fmt.Sprintf("expected 1 zone named %s, found %d", domain.DomainName, len(result.Result))
+			}
+			cf.logger.Infof("Failed to get zone of %s! %s", domain, message)
+			domain.Fail(ddns.ActionSkip, err, code, message)
+			continue
 		}
 		zoneID := result.Result[0].ID
 
 		var records CloudflareRecordsResp
 		// getDomains 最多更新前50条
 		err = cf.request(
+			ctx,
 			"GET",
 			fmt.Sprintf(Endpoint+"/%s/dns_records?type=%s&name=%s&per_page=50", zoneID, recordType, domain),
 			nil,
@@ -122,21 +162,45 @@ func (cf *Cloudflare) addUpdateDomainRecords(recordType string) {
 		)
 
 		if err != nil || !records.Success {
-			return
+			code, message := records.errorCode()
+			cf.logger.Infof("Failed to list records of %s! Messages: %s", domain, message)
+			domain.Fail(ddns.ActionSkip, err, code, message)
+			continue
 		}
 
-		if len(records.Result) > 0 {
+		if domain.MultiValue() {
+			// 同步记录集
+			cf.reconcile(ctx, records.Result, zoneID, domain, recordType, values)
+		} else if len(records.Result) > 0 {
 			// 更新
-			cf.modify(records, zoneID, domain, recordType, ipAddr)
+			cf.modify(ctx, records, zoneID, domain, recordType, ipAddr)
 		} else {
 			// 新增
-			cf.create(zoneID, domain, recordType, ipAddr)
+			cf.create(ctx, zoneID, domain, recordType, ipAddr)
 		}
 	}
 }
 
 // 创建
-func (cf *Cloudflare) create(zoneID string, domain *ddns.Domain, recordType string, ipAddr string) {
+func (cf *Cloudflare) create(ctx context.Context, zoneID string, domain *ddns.Domain, recordType string, ipAddr string) {
+	if cf.Domains.DryRun {
+		cf.logger.Infof("Will create record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
+	status, err := cf.createRecord(ctx, zoneID, domain, recordType, ipAddr)
+	if err == nil && status.Success {
+		cf.logger.Infof("Created record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", status.Result.ID)
+	} else {
+		code, message := status.errorCode()
+		cf.logger.Infof("Failed to create record %s! Messages: %s", domain, message)
+		domain.Fail(ddns.ActionCreate, err, code, message)
+	}
+}
+
+// createRecord 新增一条记录
+func (cf *Cloudflare) createRecord(ctx context.Context, zoneID string, domain *ddns.Domain, recordType string, ipAddr string) (status CloudflareRecordResp, err error) {
 	record := &CloudflareRecord{
 		Type:    recordType,
 		Name:    domain.String(),
@@ -145,31 +209,96 @@ func (cf *Cloudflare) create(zoneID string, domain *ddns.Domain, recordType stri
 		TTL:     cf.TTL,
 	}
 	record.Proxied = domain.GetCustomParams().Get("proxied") == "true"
-	var status CloudflareStatus
-	err := cf.request(
+	err = cf.request(
+		ctx,
 		"POST",
 		fmt.Sprintf(Endpoint+"/%s/dns_records", zoneID),
 		record,
 		&status,
 	)
-	if err == nil && status.Success {
-		cf.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
-	} else {
-		cf.logger.Infof("新增域名解析 %s 失败！Messages: %s", domain, status.Messages)
-		domain.UpdateStatus = consts.UpdatedFailed
+	return
+}
+
+// reconcile 多地址模式下同步记录集, 新增缺少的地址, 删除多余的记录, 不区分顺序
+// 先新增再删除, 避免记录集短暂为空
+func (cf *Cloudflare) reconcile(ctx context.Context, records []CloudflareRecord, zoneID string, domain *ddns.Domain, recordType string, values []string) {
+	var existing, ids []string
+	for _, record := range records {
+		existing = append(existing, record.Content)
+	}
+	add, remove := ddns.Reconcile(existing, values)
+	removed := make(map[int]bool, len(remove))
+	for _, i := range remove {
+		removed[i] = true
+	}
+	for i, record := range records {
+		if !removed[i] {
+			ids = append(ids, record.ID)
+		}
+	}
+	previous := append([]string(nil), existing...)
+	sort.Strings(previous)
+	action := ddns.ActionUpdate
+	if len(records) == 0 {
+		action = ddns.ActionCreate
+	}
+
+	if len(add) == 0 && len(remove) == 0 {
+		cf.logger.Infof("Your IPs %s have not changed, domain %s", strings.Join(values, ","), domain)
+		domain.Noop(strings.Join(ids, ","))
+		return
+	}
+	if cf.Domains.DryRun {
+		cf.logger.Infof("Will add %v and remove %d records of %s, IPs: %s", add, len(remove), domain, strings.Join(values, ","))
+		domain.Plan(action, strings.Join(previous, ","), strings.Join(ids, ","))
+		return
+	}
+	for _, value := range add {
+		status, err := cf.createRecord(ctx, zoneID, domain, recordType, value)
+		if err != nil || !status.Success {
+			code, message := status.errorCode()
+			cf.logger.Infof("Failed to add %s to record set %s! Messages: %s", value, domain, message)
+			domain.Fail(action, err, code, message)
+			return
+		}
+		ids = append(ids, status.Result.ID)
+	}
+	for _, i := range remove {
+		var status CloudflareStatus
+		err := cf.request(
+			ctx,
+			"DELETE",
+			fmt.Sprintf(Endpoint+"/%s/dns_records/%s", zoneID, records[i].ID),
+			nil,
+			&status,
+		)
+		if err != nil || !status.Success {
+			code, message := status.errorCode()
+			cf.logger.Infof("Failed to remove %s from record set %s! Messages: %s", records[i].Content, domain, message)
+			domain.Fail(ddns.ActionUpdate, err, code, message)
+			return
+		}
 	}
+	cf.logger.Infof("Updated record set %s successfully! IPs: %s", domain, strings.Join(values, ","))
+	domain.Succeed(action, strings.Join(previous, ","), strings.Join(ids, ","))
 }
 
 // 修改
-func (cf *Cloudflare) modify(result CloudflareRecordsResp, zoneID string, domain *ddns.Domain, recordType string, ipAddr string) {
+func (cf *Cloudflare) modify(ctx context.Context, result CloudflareRecordsResp, zoneID string, domain *ddns.Domain, recordType string, ipAddr string) {
 	for _, record := range result.Result {
 		// 相同不修改
 		if record.Content == ipAddr {
-			cf.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+			cf.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+			domain.Noop(record.ID)
+			continue
+		}
+		if cf.Domains.DryRun {
+			cf.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+			domain.Plan(ddns.ActionUpdate, record.Content, record.ID)
 			continue
 		}
 		var status CloudflareStatus
+		previous := record.Content
 		record.Content = ipAddr
 		record.TTL = cf.TTL
 		// 存在参数才修改proxied
@@ -177,24 +306,27 @@ func (cf *Cloudflare) modify(result CloudflareRecordsResp, zoneID string, domain
 			record.Proxied = domain.GetCustomParams().Get("proxied") == "true"
 		}
 		err := cf.request(
+			ctx,
 			"PUT",
 			fmt.Sprintf(Endpoint+"/%s/dns_records/%s", zoneID, record.ID),
 			record,
 			&status,
 		)
 		if err == nil && status.Success {
-			cf.logger.Infof("更新域名解析 %s 成功！IP: %s", domain, ipAddr)
-			domain.UpdateStatus = consts.UpdatedSuccess
+			cf.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+			domain.Succeed(ddns.ActionUpdate, previous, record.ID)
 		} else {
-			cf.logger.Infof("更新域名解析 %s 失败！Messages: %s", domain, status.Messages)
-			domain.UpdateStatus = consts.UpdatedFailed
+			code, message := status.errorCode()
+			cf.logger.Infof("Failed to update record %s! Messages: %s", domain, message)
+			domain.Fail(ddns.ActionUpdate, err, code, message)
 		}
 	}
 }
 
 // 获得域名记录列表
-func (cf *Cloudflare) getZones(domain *ddns.Domain) (result CloudflareZonesResp, err error) {
+func (cf *Cloudflare) getZones(ctx context.Context, domain *ddns.Domain) (result CloudflareZonesResp, err error) {
 	err = cf.request(
+		ctx,
 		"GET",
 		fmt.Sprintf(Endpoint+"?name=%s&status=%s&per_page=%s", domain.DomainName, "active", "50"),
 		nil,
@@ -205,18 +337,19 @@ func (cf *Cloudflare) getZones(domain *ddns.Domain) (result CloudflareZonesResp,
 }
 
 // request 统一请求接口
-func (cf *Cloudflare) request(method string, url string, data interface{}, result interface{}) (err error) {
+func (cf *Cloudflare) request(ctx context.Context, method string, url string, data interface{}, result interface{}) (err error) {
 	jsonStr := make([]byte, 0)
 	if data != nil {
 		jsonStr, _ = json.Marshal(data)
 	}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		method,
 		url,
 		bytes.NewBuffer(jsonStr),
 	)
 	if err != nil {
-		cf.logger.Infof("http.NewRequest失败. Error: ", err)
+		cf.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 	req.Header.Set("Authorization", "Bearer "+cf.DNS.Secret)
@@ -2,7 +2,10 @@ package ddns
 
 import (
 	"github.com/jxo-me/ddns/consts"
+	"net"
 	"net/url"
+	"sort"
+	"strings"
 )
 
 // Domain 域名实体
@@ -11,6 +14,16 @@ type Domain struct {
 	SubDomain    string
 	CustomParams string
 	UpdateStatus consts.UpdateStatusType // 更新状态
+	Result       *UpdateResult           // 更新结果
+	// Ipv6Suffix 接口标识, 不为空时与获取到的地址的前 Ipv6PrefixLength 位组合成该域名的地址
+	Ipv6Suffix       net.IP
+	Ipv6PrefixLength int
+	// Source 域名后 ?source= 指定的获取IP的方式的名称, 为空时使用默认的方式
+	Source string
+	// sourceAddr 该域名的获取IP的方式本次获取到的地址
+	sourceAddr string
+	// sourceAddrs 多地址模式下获取到的所有地址
+	sourceAddrs []string
 }
 
 func (d Domain) String() string {
@@ -47,3 +60,84 @@ func (d Domain) GetCustomParams() url.Values {
 	}
 	return url.Values{}
 }
+
+// Addr 该域名要写入的地址, 优先使用该域名的获取IP的方式得到的地址
+// 设置了 Ipv6Suffix 时为地址的前缀与接口标识的组合
+func (d *Domain) Addr(ipAddr string) string {
+	if d.sourceAddr != "" {
+		ipAddr = d.sourceAddr
+	}
+	return d.compose(ipAddr)
+}
+
+// MultiValue 获取IP的方式是否为多地址模式, 此时应同步整个记录集
+func (d *Domain) MultiValue() bool {
+	return d.sourceAddrs != nil
+}
+
+// Values 该域名的记录集要包含的所有地址, 已排序并去重; 不是多地址模式时只有 Addr
+func (d *Domain) Values(ipAddr string) []string {
+	if d.sourceAddrs == nil {
+		return []string{d.Addr(ipAddr)}
+	}
+	var values []string
+	seen := make(map[string]bool, len(d.sourceAddrs))
+	for _, addr := range d.sourceAddrs {
+		if value := normalize(d.compose(addr)); !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// compose 设置了 Ipv6Suffix 时组合前缀与接口标识
+func (d *Domain) compose(ipAddr string) string {
+	if d.Ipv6Suffix == nil {
+		return ipAddr
+	}
+	prefix := net.ParseIP(ipAddr)
+	if prefix == nil || prefix.To4() != nil {
+		return ipAddr
+	}
+	mask := net.CIDRMask(d.Ipv6PrefixLength, 8*net.IPv6len)
+	addr := make(net.IP, net.IPv6len)
+	for i := range addr {
+		addr[i] = prefix[i]&mask[i] | d.Ipv6Suffix[i]&^mask[i]
+	}
+	return addr.String()
+}
+
+// Reconcile 不区分顺序比较记录集现有的值和要写入的值, 返回需要新增的值和需要删除的现有值的下标
+// 重复的现有值只保留一个
+func Reconcile(existing []string, values []string) (add []string, remove []int) {
+	want := make(map[string]bool, len(values))
+	for _, value := range values {
+		want[normalize(value)] = true
+	}
+	kept := make(map[string]bool, len(existing))
+	for i, value := range existing {
+		key := normalize(value)
+		if !want[key] || kept[key] {
+			remove = append(remove, i)
+			continue
+		}
+		kept[key] = true
+	}
+	for _, value := range values {
+		if key := normalize(value); !kept[key] {
+			kept[key] = true
+			add = append(add, value)
+		}
+	}
+	return
+}
+
+// normalize 地址使用统一的格式, 如 2001:db8:0::1 与 2001:db8::1 相同
+func normalize(value string) string {
+	if ip := net.ParseIP(strings.TrimSpace(value)); ip != nil {
+		return ip.String()
+	}
+	return value
+}
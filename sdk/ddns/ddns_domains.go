@@ -1,14 +1,27 @@
 package ddns
 
 import (
+	"context"
+	"fmt"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
 	"github.com/jxo-me/ddns/core/cache"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
 	"github.com/jxo-me/ddns/core/logger"
+	"net"
 	"net/url"
+	"sort"
 	"strings"
 )
 
+// Ipv6SuffixParam 域名后指定接口标识的参数, 如 nas.example.com?ipv6suffix=::1a2b:3c4d
+const Ipv6SuffixParam = "ipv6suffix"
+
+// SourceParam 域名后指定获取IP的方式的参数, 如 wan2.example.com?source=ppp1
+const SourceParam = "source"
+
+// DefaultFailThreshold 获取IP连续失败的次数达到后将第一个域名标记为失败
+const DefaultFailThreshold = 3
+
 // 固定的主域名
 var staticMainDomains = []string{"com.cn", "org.cn", "net.cn", "ac.cn", "eu.org"}
 
@@ -20,46 +33,126 @@ type Domains struct {
 	Ipv6Addr    string
 	Ipv6Cache   cache.IIpCache
 	Ipv6Domains []*Domain
-	Logger      logger.ILogger
+	// Ipv4Detection/Ipv6Detection 本次默认的方式获取IP的结果
+	Ipv4Detection *iIPSource.Result
+	Ipv6Detection *iIPSource.Result
+	// Ipv4Sources/Ipv6Sources 按名称引用的获取IP的方式
+	Ipv4Sources map[string]*Source
+	Ipv6Sources map[string]*Source
+	// Ipv4Detections/Ipv6Detections 本次按名称引用的方式获取IP的结果
+	Ipv4Detections map[string]*iIPSource.Result
+	Ipv6Detections map[string]*iIPSource.Result
+	// DryRun 预览模式, 服务商只查询现有记录, 不新增或修改
+	DryRun bool
+	// FailThreshold 获取IP连续失败多少次后将第一个域名标记为失败, 为 0 时为 DefaultFailThreshold
+	FailThreshold int
+	Logger        logger.ILogger
+}
+
+// Source 按名称引用的获取IP的方式, Cache 记录其获取失败的次数
+type Source struct {
+	IPSource iIPSource.IIPSource
+	Cache    cache.IIpCache
 }
 
-// GetNewIp 接口/网卡/命令获得 ip 并校验用户输入的域名
-func (domains *Domains) GetNewIp(dnsConf *config.DDnsConfig) {
-	domains.Ipv4Domains = checkParseDomains(dnsConf.Ipv4.Domains, domains.Logger)
-	domains.Ipv6Domains = checkParseDomains(dnsConf.Ipv6.Domains, domains.Logger)
+// GetNewIp 通过 ipv4Source/ipv6Source 获得 ip 并校验用户输入的域名, 未启用时 source 为 nil
+// 域名按获取IP的方式分组, 每种方式只获取一次
+func (domains *Domains) GetNewIp(ctx context.Context, dnsConf *config.DDnsConfig, ipv4Source, ipv6Source iIPSource.IIPSource) {
+	if dnsConf.Ipv4 != nil {
+		domains.Ipv4Domains = parseSources(checkParseDomains(dnsConf.Ipv4.Domains, domains.Logger), domains.Ipv4Sources, domains.Logger)
+	}
+	if dnsConf.Ipv6 != nil {
+		domains.Ipv6Domains = parseSources(parseIpv6Suffixes(checkParseDomains(dnsConf.Ipv6.Domains, domains.Logger), dnsConf.Ipv6, domains.Logger), domains.Ipv6Sources, domains.Logger)
+	}
 
 	// IPv4
-	if dnsConf.Ipv4.Enable && len(domains.Ipv4Domains) > 0 {
-		ipv4Addr := dnsConf.GetIpv4Addr()
-		if ipv4Addr != "" {
-			domains.Ipv4Addr = ipv4Addr
-			domains.Ipv4Cache.ResetFailedTimes()
-		} else {
-			// 启用IPv4 & 未获取到IP & 填写了域名 & 失败刚好3次，防止偶尔的网络连接失败，并且只发一次
-			domains.Ipv4Cache.IncreaseFailedTimes()
-			if domains.Ipv4Cache.GetFailedTimes() == 3 {
-				domains.Ipv4Domains[0].UpdateStatus = consts.UpdatedFailed
-			}
-			domains.Logger.Info("Failed to obtain IPv4 address, will not update")
+	if ipv4Source != nil && len(domains.Ipv4Domains) > 0 {
+		domains.Ipv4Detection, domains.Ipv4Detections = domains.detect(ctx, iIPSource.IPv4, ipv4Source, domains.Ipv4Cache, domains.Ipv4Sources, domains.Ipv4Domains)
+		if domains.Ipv4Detection != nil {
+			domains.Ipv4Addr = detectedAddr(domains.Ipv4Detection)
 		}
 	}
 
 	// IPv6
-	if dnsConf.Ipv6.Enable && len(domains.Ipv6Domains) > 0 {
-		ipv6Addr := dnsConf.GetIpv6Addr()
-		if ipv6Addr != "" {
-			domains.Ipv6Addr = ipv6Addr
-			domains.Ipv6Cache.ResetFailedTimes()
+	if ipv6Source != nil && len(domains.Ipv6Domains) > 0 {
+		domains.Ipv6Detection, domains.Ipv6Detections = domains.detect(ctx, iIPSource.IPv6, ipv6Source, domains.Ipv6Cache, domains.Ipv6Sources, domains.Ipv6Domains)
+		if domains.Ipv6Detection != nil {
+			domains.Ipv6Addr = detectedAddr(domains.Ipv6Detection)
+		}
+	}
+}
+
+// detect 按获取IP的方式分组获取地址, 返回默认方式和按名称引用的方式的结果, 没有域名使用的方式不获取
+func (domains *Domains) detect(ctx context.Context, family iIPSource.Family, source iIPSource.IIPSource, ipCache cache.IIpCache, sources map[string]*Source, domainArr []*Domain) (detection *iIPSource.Result, detections map[string]*iIPSource.Result) {
+	var (
+		names  []string
+		groups = make(map[string][]*Domain)
+	)
+	for _, domain := range domainArr {
+		if _, ok := groups[domain.Source]; !ok {
+			names = append(names, domain.Source)
+		}
+		groups[domain.Source] = append(groups[domain.Source], domain)
+	}
+	for _, name := range names {
+		var result *iIPSource.Result
+		if name == "" {
+			detection = domains.getAddr(ctx, family, source, ipCache, groups[name])
+			result = detection
 		} else {
-			// 启用IPv6 & 未获取到IP & 填写了域名 & 失败刚好3次，防止偶尔的网络连接失败，并且只发一次
-			domains.Ipv6Cache.IncreaseFailedTimes()
-			if domains.Ipv6Cache.GetFailedTimes() == 3 {
-				domains.Ipv6Domains[0].UpdateStatus = consts.UpdatedFailed
+			result = domains.getAddr(ctx, family, sources[name].IPSource, sources[name].Cache, groups[name])
+			if detections == nil {
+				detections = make(map[string]*iIPSource.Result)
 			}
-			domains.Logger.Info("Failed to obtain IPv6 address, will not update")
+			detections[name] = result
+		}
+		for _, domain := range groups[name] {
+			domain.sourceAddr = result.Addr
+			domain.sourceAddrs = result.Addrs
 		}
 	}
+	return
+}
 
+// getAddr 获取地址, 失败时跳过所有域名
+func (domains *Domains) getAddr(ctx context.Context, family iIPSource.Family, source iIPSource.IIPSource, ipCache cache.IIpCache, domainArr []*Domain) *iIPSource.Result {
+	result, err := source.GetAddr(ctx)
+	if result == nil {
+		result = &iIPSource.Result{Source: source.String()}
+	}
+	if err == nil && result.Addr != "" {
+		domains.Logger.Debugf("Got %s %s from %s", family, result.Addr, result.Source)
+		ipCache.ResetFailedTimes()
+		return result
+	}
+
+	result.Addr, result.Addrs = "", nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	reason := fmt.Sprintf("failed to obtain %s address", family)
+	for _, domain := range domainArr {
+		// 记录失败原因, 如地址被 allow/deny 拒绝
+		if err != nil {
+			domain.Skip(reason + ": " + err.Error())
+		} else {
+			domain.Skip(reason)
+		}
+	}
+	// 启用 & 未获取到IP & 填写了域名 & 失败次数达到阈值，防止偶尔的网络连接失败，之后每次失败都标记
+	threshold := domains.FailThreshold
+	if threshold <= 0 {
+		threshold = DefaultFailThreshold
+	}
+	ipCache.IncreaseFailedTimes()
+	if failed := ipCache.GetFailedTimes(); failed >= threshold {
+		domainArr[0].Fail(ActionSkip, err, "", fmt.Sprintf("%s %d times in a row", reason, failed))
+	}
+	domains.Logger.WithFields(map[string]any{
+		"source":  source.String(),
+		"details": result.Details,
+	}).Infof("Failed to obtain %s address, will not update: %v", family, err)
+	return result
 }
 
 // checkParseDomains 校验并解析用户输入的域名
@@ -69,10 +162,12 @@ func checkParseDomains(domainArr []string, log logger.ILogger) (domains []*Domai
 		if domainStr != "" {
 			domain := &Domain{}
 
-			dp := strings.Split(domainStr, ":")
+			// 参数中可能有冒号, 如 ?ipv6suffix=::1
+			name, params, hasParams := strings.Cut(domainStr, "?")
+			dp := strings.Split(name, ":")
 			dplen := len(dp)
 			if dplen == 1 { // 自动识别域名
-				sp := strings.Split(domainStr, ".")
+				sp := strings.Split(name, ".")
 				length := len(sp)
 				if length <= 1 {
 					log.Info(domainStr, "Incorrect domain name")
@@ -82,21 +177,20 @@ func checkParseDomains(domainArr []string, log logger.ILogger) (domains []*Domai
 				domain.DomainName = sp[length-2] + "." + sp[length-1]
 				// 如包含在org.cn等顶级域名下，后三个才为用户主域名
 				for _, staticMainDomain := range staticMainDomains {
-					// 移除 domain.DomainName 的查询字符串以便与 staticMainDomain 进行比较。
-					// 查询字符串是 URL ? 后面的部分。
-					// 查询字符串的存在会导致顶级域名无法与 staticMainDomain 精确匹配，从而被误认为二级域名。
-					// 示例："com.cn?param=value" 将被替换为 "com.cn"。
-					if staticMainDomain == strings.Split(domain.DomainName, "?")[0] {
+					if staticMainDomain == domain.DomainName {
 						domain.DomainName = sp[length-3] + "." + domain.DomainName
 						break
 					}
 				}
 
-				domainLen := len(domainStr) - len(domain.DomainName)
+				domainLen := len(name) - len(domain.DomainName)
 				if domainLen > 0 {
-					domain.SubDomain = domainStr[:domainLen-1]
+					domain.SubDomain = name[:domainLen-1]
 				} else {
-					domain.SubDomain = domainStr[:domainLen]
+					domain.SubDomain = name[:domainLen]
+				}
+				if hasParams {
+					domain.DomainName += "?" + params
 				}
 
 			} else if dplen == 2 { // 主机记录:域名 格式
@@ -108,6 +202,9 @@ func checkParseDomains(domainArr []string, log logger.ILogger) (domains []*Domai
 				}
 				domain.DomainName = dp[1]
 				domain.SubDomain = dp[0]
+				if hasParams {
+					domain.DomainName += "?" + params
+				}
 			} else {
 				log.Info(domainStr, "Incorrect domain name")
 				continue
@@ -129,21 +226,158 @@ func checkParseDomains(domainArr []string, log logger.ILogger) (domains []*Domai
 	return
 }
 
+// parseIpv6Suffixes 设置域名的接口标识, 来自域名后的 ipv6suffix 参数或 HostIDs, 接口标识无效的域名被忽略
+func parseIpv6Suffixes(domainArr []*Domain, conf *config.Ipv6, log logger.ILogger) (domains []*Domain) {
+	prefixLength := conf.PrefixLength
+	if prefixLength <= 0 || prefixLength >= 128 {
+		if prefixLength != 0 {
+			log.Infof("Invalid IPv6 prefix length %d, 64 will be used", prefixLength)
+		}
+		prefixLength = 64
+	}
+	// 读取配置时键会被转为小写
+	hostIDs := make(map[string]string, len(conf.HostIDs))
+	for name, suffix := range conf.HostIDs {
+		hostIDs[strings.ToLower(name)] = suffix
+	}
+	for _, domain := range domainArr {
+		suffix := hostIDs[strings.ToLower(domain.String())]
+		if domain.CustomParams != "" {
+			params := domain.GetCustomParams()
+			if params.Has(Ipv6SuffixParam) {
+				suffix = params.Get(Ipv6SuffixParam)
+				// 不传给服务商
+				params.Del(Ipv6SuffixParam)
+				domain.CustomParams = params.Encode()
+			}
+		}
+		if suffix != "" {
+			ip := net.ParseIP(suffix)
+			if ip == nil || ip.To4() != nil {
+				log.Info(domain, " Incorrect IPv6 suffix ", suffix)
+				continue
+			}
+			domain.Ipv6Suffix = ip
+			domain.Ipv6PrefixLength = prefixLength
+		}
+		domains = append(domains, domain)
+	}
+	return
+}
+
 // GetNewIpResult 获得GetNewIp结果
+// 使用了按名称引用的获取IP的方式或多地址模式时, ipAddr 为多个地址的组合, 只用于判断是否改变
+// 域名的地址需通过 Domain.Addr 或 Domain.Values 获得
+// 返回的域名不包括获取IP失败的
 func (domains *Domains) GetNewIpResult(recordType string) (ipAddr string, retDomains []*Domain) {
 	if recordType == "AAAA" {
-		if domains.Ipv6Cache.Check(domains.Ipv6Addr) {
-			return domains.Ipv6Addr, domains.Ipv6Domains
+		ipAddr, retDomains = newIpResult(domains.Ipv6Addr, domains.Ipv6Detections, domains.Ipv6Domains)
+		if domains.Ipv6Cache.Check(ipAddr) {
+			return ipAddr, retDomains
 		} else {
 			domains.Logger.Infof("IPv6 has not changed, will wait %d times before comparing with DNS service provider\n", domains.Ipv6Cache.GetTimes())
+			SkipDomains(domains.Ipv6Domains, "IPv6 address unchanged")
 			return "", domains.Ipv6Domains
 		}
 	}
 	// IPv4
-	if domains.Ipv4Cache.Check(domains.Ipv4Addr) {
-		return domains.Ipv4Addr, domains.Ipv4Domains
+	ipAddr, retDomains = newIpResult(domains.Ipv4Addr, domains.Ipv4Detections, domains.Ipv4Domains)
+	if domains.Ipv4Cache.Check(ipAddr) {
+		return ipAddr, retDomains
 	} else {
 		domains.Logger.Infof("IPv4 has not changed, will wait %d times before comparing with DNS service provider\n", domains.Ipv4Cache.GetTimes())
+		SkipDomains(domains.Ipv4Domains, "IPv4 address unchanged")
 		return "", domains.Ipv4Domains
 	}
 }
+
+// newIpResult 组合默认方式和按名称引用的方式的地址, 返回获取到地址的域名
+func newIpResult(ipAddr string, detections map[string]*iIPSource.Result, domainArr []*Domain) (string, []*Domain) {
+	if len(detections) == 0 {
+		return ipAddr, domainArr
+	}
+	var ready []*Domain
+	for _, domain := range domainArr {
+		if domain.sourceAddr != "" {
+			ready = append(ready, domain)
+		}
+	}
+	if len(ready) == 0 {
+		return "", domainArr
+	}
+	names := make([]string, 0, len(detections))
+	for name := range detections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := []string{ipAddr}
+	for _, name := range names {
+		parts = append(parts, name+"="+detectedAddr(detections[name]))
+	}
+	return strings.Join(parts, ","), ready
+}
+
+// detectedAddr 获取到的地址, 多地址模式下为排序后以逗号分隔的所有地址, 以便发现其中任一地址的变化
+func detectedAddr(result *iIPSource.Result) string {
+	if result.Addr == "" || len(result.Addrs) == 0 {
+		return result.Addr
+	}
+	addrs := append([]string(nil), result.Addrs...)
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
+
+// parseSources 设置域名的获取IP的方式, 来自域名后的 source 参数, 方式不存在的域名被忽略
+func parseSources(domainArr []*Domain, sources map[string]*Source, log logger.ILogger) (domains []*Domain) {
+	for _, domain := range domainArr {
+		if domain.CustomParams != "" {
+			params := domain.GetCustomParams()
+			if params.Has(SourceParam) {
+				// 读取配置时名称会被转为小写
+				domain.Source = strings.ToLower(params.Get(SourceParam))
+				// 不传给服务商
+				params.Del(SourceParam)
+				domain.CustomParams = params.Encode()
+			}
+		}
+		if _, ok := sources[domain.Source]; domain.Source != "" && !ok {
+			log.Info(domain, " Unknown ip source ", domain.Source)
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return
+}
+
+// Detection 域名的获取IP的方式本次的结果
+func (domains *Domains) Detection(family iIPSource.Family, domain *Domain) *iIPSource.Result {
+	detection, detections := domains.Ipv4Detection, domains.Ipv4Detections
+	if family == iIPSource.IPv6 {
+		detection, detections = domains.Ipv6Detection, domains.Ipv6Detections
+	}
+	if domain.Source != "" {
+		return detections[domain.Source]
+	}
+	return detection
+}
+
+// Results 获得所有域名的更新结果, 未处理的域名不包含在内
+func (domains *Domains) Results() (results []*UpdateResult) {
+	for _, group := range [][]*Domain{domains.Ipv4Domains, domains.Ipv6Domains} {
+		for _, domain := range group {
+			if domain.Result != nil {
+				results = append(results, domain.Result)
+			}
+		}
+	}
+	return
+}
+
+// SkipDomains 将尚未处理的域名标记为跳过
+func SkipDomains(domains []*Domain, reason string) {
+	for _, domain := range domains {
+		if domain.Result == nil {
+			domain.Skip(reason)
+		}
+	}
+}
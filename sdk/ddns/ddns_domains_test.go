@@ -1,7 +1,15 @@
 package ddns
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/sdk/cache"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
 )
 
 // TestParseDomainArr 测试 parseDomainArr
@@ -22,7 +30,7 @@ func TestParseDomainArr(t *testing.T) {
 		{DomainName: "test.mydomain.com", SubDomain: "test2", CustomParams: "Line=oversea&RecordId=123"},
 	}
 
-	parsedDomains := checkParseDomains(domains)
+	parsedDomains := checkParseDomains(domains, xlogger.Nop())
 	for i := 0; i < len(parsedDomains); i++ {
 		if parsedDomains[i].DomainName != result[i].DomainName ||
 			parsedDomains[i].SubDomain != result[i].SubDomain ||
@@ -36,3 +44,144 @@ func TestParseDomainArr(t *testing.T) {
 	}
 
 }
+
+// TestParseIpv6Suffixes 测试前缀与接口标识的组合
+func TestParseIpv6Suffixes(t *testing.T) {
+	conf := &config.Ipv6{
+		PrefixLength: 56,
+		HostIDs:      map[string]string{"pc.mydomain.com": "::10"},
+	}
+	domains := parseIpv6Suffixes(checkParseDomains([]string{
+		"mydomain.com",
+		"nas.mydomain.com?ipv6suffix=::1a2b:3c4d&RecordId=123",
+		"pc.mydomain.com",
+		"bad.mydomain.com?ipv6suffix=1.2.3.4",
+	}, xlogger.Nop()), conf, xlogger.Nop())
+	if len(domains) != 3 {
+		t.Fatalf("接口标识无效的域名应被忽略，得到 %d 个域名", len(domains))
+	}
+
+	tests := []struct {
+		prefix, self, nas, pc string
+	}{
+		{"2001:db8:0:1200::1", "2001:db8:0:1200::1", "2001:db8:0:1200::1a2b:3c4d", "2001:db8:0:1200::10"},
+		// 前缀变化后所有域名都跟随
+		{"2001:db8:0:3456:aaaa::1", "2001:db8:0:3456:aaaa::1", "2001:db8:0:3400::1a2b:3c4d", "2001:db8:0:3400::10"},
+	}
+	for _, tt := range tests {
+		for i, want := range []string{tt.self, tt.nas, tt.pc} {
+			if got := domains[i].Addr(tt.prefix); got != want {
+				t.Errorf("%s 的地址应为 %s，得到 %s", domains[i], want, got)
+			}
+		}
+	}
+	if domains[1].CustomParams != "RecordId=123" {
+		t.Errorf("ipv6suffix 参数不应传给服务商，得到 %s", domains[1].CustomParams)
+	}
+}
+
+// countingSource 记录获取次数, addr 为空时获取失败
+type countingSource struct {
+	addr  string
+	calls int
+}
+
+func (c *countingSource) String() string { return "counting" }
+func (c *countingSource) GetAddr(context.Context) (*iIPSource.Result, error) {
+	c.calls++
+	if c.addr == "" {
+		return nil, errors.New("no address")
+	}
+	return &iIPSource.Result{Addr: c.addr, Source: "counting:" + c.addr}, nil
+}
+
+// TestGetNewIpSources 测试按获取IP的方式分组, 每种方式只获取一次
+func TestGetNewIpSources(t *testing.T) {
+	var (
+		wan1 = &countingSource{addr: "198.51.100.1"}
+		ppp1 = &countingSource{addr: "203.0.113.2"}
+		down = &countingSource{}
+	)
+	domains := Domains{
+		Ipv4Cache: &cache.IpCache{},
+		Ipv4Sources: map[string]*Source{
+			"ppp1": {IPSource: ppp1, Cache: &cache.IpCache{}},
+			"down": {IPSource: down, Cache: &cache.IpCache{}},
+		},
+		Logger: xlogger.Nop(),
+	}
+	domains.GetNewIp(context.Background(), &config.DDnsConfig{Ipv4: &config.Ipv4{Domains: []string{
+		"wan1.example.com",
+		"wan2.example.com?source=PPP1&RecordId=123",
+		"nas.example.com?source=ppp1",
+		"backup.example.com?source=down",
+		"bad.example.com?source=none",
+	}}}, wan1, nil)
+
+	if len(domains.Ipv4Domains) != 4 {
+		t.Fatalf("方式不存在的域名应被忽略，得到 %d 个域名", len(domains.Ipv4Domains))
+	}
+	if wan1.calls != 1 || ppp1.calls != 1 || down.calls != 1 {
+		t.Errorf("每种方式应只获取一次，得到 %d %d %d", wan1.calls, ppp1.calls, down.calls)
+	}
+	if domains.Ipv4Addr != "198.51.100.1" || domains.Ipv4Detections["ppp1"].Addr != "203.0.113.2" || domains.Ipv4Detections["down"].Addr != "" {
+		t.Errorf("获取结果不正确：%s %+v", domains.Ipv4Addr, domains.Ipv4Detections)
+	}
+	if domains.Ipv4Domains[1].CustomParams != "RecordId=123" {
+		t.Errorf("source 参数不应传给服务商，得到 %s", domains.Ipv4Domains[1].CustomParams)
+	}
+
+	ipAddr, ready := domains.GetNewIpResult("A")
+	if ipAddr != "198.51.100.1,down=,ppp1=203.0.113.2" || len(ready) != 3 {
+		t.Fatalf("结果不正确：%s %d", ipAddr, len(ready))
+	}
+	for i, want := range []string{"198.51.100.1", "203.0.113.2", "203.0.113.2"} {
+		if got := ready[i].Addr(ipAddr); got != want {
+			t.Errorf("%s 的地址应为 %s，得到 %s", ready[i], want, got)
+		}
+	}
+	if r := domains.Ipv4Domains[3].Result; r == nil || r.Action != ActionSkip {
+		t.Errorf("获取失败的域名应被跳过，得到 %+v", r)
+	}
+	if status := domains.Status(); status != RunDetectionFailed {
+		t.Errorf("期待 %s，得到 %s", RunDetectionFailed, status)
+	}
+}
+
+// TestGetNewIpFailThreshold 测试获取IP连续失败达到阈值后每次都标记为失败
+func TestGetNewIpFailThreshold(t *testing.T) {
+	ipCache := &cache.IpCache{}
+	conf := &config.DDnsConfig{Ipv4: &config.Ipv4{Domains: []string{"wan1.example.com"}}}
+	for i, failed := range []bool{false, true, true, true} {
+		domains := Domains{Ipv4Cache: ipCache, FailThreshold: 2, Logger: xlogger.Nop()}
+		domains.GetNewIp(context.Background(), conf, &countingSource{}, nil)
+		if got := domains.Ipv4Domains[0].Result.Failed(); got != failed {
+			t.Errorf("第 %d 次失败后期待标记为失败 %v，得到 %v", i+1, failed, got)
+		}
+	}
+}
+
+// TestReconcile 测试多值记录集的同步
+func TestReconcile(t *testing.T) {
+	domain := &Domain{DomainName: "mydomain.com", sourceAddrs: []string{"2001:db8::2", "2001:db8::1", "2001:db8:0::2"}}
+	values := domain.Values("2001:db8::2")
+	if len(values) != 2 || values[0] != "2001:db8::1" || values[1] != "2001:db8::2" {
+		t.Fatalf("记录集应排序并去重，得到 %v", values)
+	}
+
+	tests := []struct {
+		existing []string
+		add      []string
+		remove   []int
+	}{
+		{nil, []string{"2001:db8::1", "2001:db8::2"}, nil},
+		{[]string{"2001:db8::2", "2001:db8:0::1"}, nil, nil},
+		{[]string{"2001:db8::3", "2001:db8::1", "2001:db8::1"}, []string{"2001:db8::2"}, []int{0, 2}},
+	}
+	for _, tt := range tests {
+		add, remove := Reconcile(tt.existing, values)
+		if fmt.Sprint(add) != fmt.Sprint(tt.add) || fmt.Sprint(remove) != fmt.Sprint(tt.remove) {
+			t.Errorf("同步 %v 应新增 %v 删除 %v，得到 %v %v", tt.existing, tt.add, tt.remove, add, remove)
+		}
+	}
+}
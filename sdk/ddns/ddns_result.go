@@ -0,0 +1,204 @@
+package ddns
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jxo-me/ddns/consts"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/internal/util"
+)
+
+// UpdateAction 对域名执行的动作
+type UpdateAction string
+
+const (
+	// ActionCreate 新增记录
+	ActionCreate UpdateAction = "create"
+	// ActionUpdate 更新记录
+	ActionUpdate UpdateAction = "update"
+	// ActionNoop 记录已是最新, 无需修改
+	ActionNoop UpdateAction = "noop"
+	// ActionSkip 未请求服务商, 如IP未变化或获取IP失败
+	ActionSkip UpdateAction = "skip"
+)
+
+// UpdateResult 单个域名的更新结果
+type UpdateResult struct {
+	Domain        string                  `json:"domain"`
+	RecordType    string                  `json:"recordType"`
+	Action        UpdateAction            `json:"action"`
+	Status        consts.UpdateStatusType `json:"status"`
+	PreviousValue string                  `json:"previousValue,omitempty"`
+	NewValue      string                  `json:"newValue,omitempty"`
+	RecordID      string                  `json:"recordId,omitempty"`
+	// Reason 跳过的原因
+	Reason string `json:"reason,omitempty"`
+	// ErrorCode/ErrorMessage 服务商返回的错误码和错误信息
+	ErrorCode    string        `json:"errorCode,omitempty"`
+	ErrorMessage string        `json:"errorMessage,omitempty"`
+	HTTPStatus   int           `json:"httpStatus,omitempty"`
+	StartedAt    time.Time     `json:"startedAt"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// Failed 是否失败
+func (r *UpdateResult) Failed() bool {
+	return r != nil && r.Status == consts.UpdatedFailed
+}
+
+// Begin 开始处理域名, 记录类型、待写入的值和开始时间
+func (d *Domain) Begin(recordType string, value string) {
+	d.Result = &UpdateResult{
+		Domain:     d.String(),
+		RecordType: recordType,
+		NewValue:   value,
+		StartedAt:  time.Now(),
+	}
+}
+
+// Succeed 新增或更新成功
+func (d *Domain) Succeed(action UpdateAction, previous string, recordID string) {
+	r := d.result()
+	r.Action = action
+	r.PreviousValue = previous
+	r.RecordID = recordID
+	d.finish(consts.UpdatedSuccess)
+}
+
+// Plan 预览模式下将要新增或更新, 未写入服务商
+func (d *Domain) Plan(action UpdateAction, previous string, recordID string) {
+	r := d.result()
+	r.Action = action
+	r.PreviousValue = previous
+	r.RecordID = recordID
+	d.finish(consts.UpdatedPlanned)
+}
+
+// Noop 服务商的记录与新值相同
+func (d *Domain) Noop(recordID string) {
+	r := d.result()
+	r.Action = ActionNoop
+	r.PreviousValue = r.NewValue
+	r.RecordID = recordID
+	d.finish(consts.UpdatedNothing)
+}
+
+// Skip 未请求服务商
+func (d *Domain) Skip(reason string) {
+	r := d.result()
+	r.Action = ActionSkip
+	r.Reason = reason
+	d.finish(consts.UpdatedNothing)
+}
+
+// Fail 失败, code/message 为服务商返回的错误码和错误信息, err 中的HTTP状态码会被记录
+func (d *Domain) Fail(action UpdateAction, err error, code string, message string) {
+	r := d.result()
+	r.Action = action
+	r.ErrorCode = code
+	r.ErrorMessage = message
+	var httpErr *util.HTTPError
+	if errors.As(err, &httpErr) {
+		r.HTTPStatus = httpErr.StatusCode
+	}
+	if r.ErrorMessage == "" && err != nil {
+		r.ErrorMessage = err.Error()
+	}
+	d.finish(consts.UpdatedFailed)
+}
+
+func (d *Domain) result() *UpdateResult {
+	if d.Result == nil {
+		d.Result = &UpdateResult{
+			Domain:    d.String(),
+			StartedAt: time.Now(),
+		}
+	}
+	return d.Result
+}
+
+func (d *Domain) finish(status consts.UpdateStatusType) {
+	d.UpdateStatus = status
+	d.Result.Status = status
+	d.Result.Duration = time.Since(d.Result.StartedAt)
+}
+
+// DomainsStatus 一组域名的总体状态, 一个失败则失败, 否则一个成功则成功
+func DomainsStatus(domains []*Domain) consts.UpdateStatusType {
+	successNum := 0
+	for _, domain := range domains {
+		switch domain.UpdateStatus {
+		case consts.UpdatedFailed:
+			return consts.UpdatedFailed
+		case consts.UpdatedSuccess:
+			successNum++
+		}
+	}
+	if successNum > 0 {
+		return consts.UpdatedSuccess
+	}
+	return consts.UpdatedNothing
+}
+
+// RunStatus 一次运行的总体结果, 值越大越严重
+type RunStatus int
+
+const (
+	// RunUnchanged 所有记录都未改变
+	RunUnchanged RunStatus = iota
+	// RunUpdated 至少新增或更新了一条记录, 预览模式下为有待执行的修改
+	RunUpdated
+	// RunDetectionFailed 获取IP失败
+	RunDetectionFailed
+	// RunProviderFailed 服务商更新失败
+	RunProviderFailed
+)
+
+func (s RunStatus) String() string {
+	switch s {
+	case RunUpdated:
+		return "updated"
+	case RunDetectionFailed:
+		return "detection failed"
+	case RunProviderFailed:
+		return "provider failed"
+	default:
+		return "unchanged"
+	}
+}
+
+// Status 根据获取IP的结果和每个域名的更新结果得出总体结果
+func (domains *Domains) Status() (status RunStatus) {
+	families := []struct {
+		family  iIPSource.Family
+		domains []*Domain
+	}{
+		{iIPSource.IPv4, domains.Ipv4Domains},
+		{iIPSource.IPv6, domains.Ipv6Domains},
+	}
+	for _, family := range families {
+		for _, domain := range family.domains {
+			// 获取IP失败时域名的结果都是由此产生的
+			if detection := domains.Detection(family.family, domain); detection != nil && detection.Addr == "" {
+				status = status.worse(RunDetectionFailed)
+				continue
+			}
+			switch {
+			case domain.Result.Failed():
+				status = status.worse(RunProviderFailed)
+			case domain.Result != nil && (domain.Result.Status == consts.UpdatedSuccess || domain.Result.Status == consts.UpdatedPlanned):
+				status = status.worse(RunUpdated)
+			}
+		}
+	}
+	return
+}
+
+// worse 返回更严重的结果
+func (s RunStatus) worse(other RunStatus) RunStatus {
+	if other > s {
+		return other
+	}
+	return s
+}
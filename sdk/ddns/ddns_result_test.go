@@ -0,0 +1,78 @@
+package ddns
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jxo-me/ddns/consts"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/internal/util"
+)
+
+// TestDomainResult 测试域名更新结果
+func TestDomainResult(t *testing.T) {
+	domain := &Domain{DomainName: "example.com", SubDomain: "www"}
+	domain.Begin("A", "1.1.1.1")
+	domain.Succeed(ActionUpdate, "2.2.2.2", "123")
+	if domain.UpdateStatus != consts.UpdatedSuccess || domain.Result.Status != consts.UpdatedSuccess {
+		t.Errorf("期待状态 %s，得到 %s", consts.UpdatedSuccess, domain.UpdateStatus)
+	}
+	if domain.Result.Domain != "www.example.com" || domain.Result.PreviousValue != "2.2.2.2" ||
+		domain.Result.NewValue != "1.1.1.1" || domain.Result.RecordID != "123" {
+		t.Errorf("结果不正确：%+v", domain.Result)
+	}
+
+	domain.Begin("A", "1.1.1.1")
+	err := fmt.Errorf("wrapped: %w", &util.HTTPError{URL: "https://example.com", StatusCode: http.StatusForbidden})
+	domain.Fail(ActionCreate, err, "Forbidden", "")
+	if !domain.Result.Failed() || domain.Result.HTTPStatus != http.StatusForbidden ||
+		domain.Result.ErrorCode != "Forbidden" || domain.Result.ErrorMessage == "" {
+		t.Errorf("失败结果不正确：%+v", domain.Result)
+	}
+
+	// 未调用 Begin 也能记录结果
+	skipped := &Domain{DomainName: "example.com"}
+	SkipDomains([]*Domain{skipped, domain}, "IPv4 address unchanged")
+	if skipped.Result == nil || skipped.Result.Action != ActionSkip {
+		t.Errorf("期待跳过，得到 %+v", skipped.Result)
+	}
+	if domain.Result.Action != ActionCreate {
+		t.Errorf("已处理的域名不应被跳过，得到 %s", domain.Result.Action)
+	}
+}
+
+// TestDomainsStatus 测试一次运行的总体结果
+func TestDomainsStatus(t *testing.T) {
+	newDomains := func() *Domains {
+		return &Domains{
+			Ipv4Detection: &iIPSource.Result{Addr: "1.1.1.1"},
+			Ipv4Domains:   []*Domain{{DomainName: "example.com"}, {DomainName: "example.org"}},
+		}
+	}
+
+	domains := newDomains()
+	domains.Ipv4Domains[0].Noop("1")
+	SkipDomains(domains.Ipv4Domains, "IPv4 address unchanged")
+	if status := domains.Status(); status != RunUnchanged {
+		t.Errorf("期待 %s，得到 %s", RunUnchanged, status)
+	}
+
+	domains.Ipv4Domains[1].Begin("A", "1.1.1.1")
+	domains.Ipv4Domains[1].Succeed(ActionCreate, "", "2")
+	if status := domains.Status(); status != RunUpdated {
+		t.Errorf("期待 %s，得到 %s", RunUpdated, status)
+	}
+
+	domains.Ipv6Detection = &iIPSource.Result{Source: "url"}
+	domains.Ipv6Domains = []*Domain{{DomainName: "example.net"}}
+	domains.Ipv6Domains[0].Fail(ActionSkip, nil, "", "failed to obtain IPv6 address 3 times in a row")
+	if status := domains.Status(); status != RunDetectionFailed {
+		t.Errorf("期待 %s，得到 %s", RunDetectionFailed, status)
+	}
+
+	domains.Ipv4Domains[0].Fail(ActionUpdate, nil, "Forbidden", "")
+	if status := domains.Status(); status != RunProviderFailed {
+		t.Errorf("期待 %s，得到 %s", RunProviderFailed, status)
+	}
+}
@@ -1,13 +1,17 @@
 package dnspod
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net/http"
 	"net/url"
+	"strings"
 )
 
 const (
@@ -17,6 +21,15 @@ const (
 	Code            string = "dnspod"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Dnspod{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: true,
+	})
+}
+
 // Dnspod 腾讯云dns实现
 // https://cloud.tencent.com/document/api/302/8516
 type Dnspod struct {
@@ -47,6 +60,10 @@ type DnspodStatus struct {
 		Code    string
 		Message string
 	}
+	// Record.Create/Record.Modify 返回的记录
+	Record struct {
+		ID json.Number `json:"id"`
+	}
 }
 
 func (dnspod *Dnspod) String() string {
@@ -58,12 +75,9 @@ func (dnspod *Dnspod) Endpoint() string {
 }
 
 // Init 初始化
-func (dnspod *Dnspod) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	dnspod.Domains.Ipv4Cache = ipv4cache
-	dnspod.Domains.Ipv6Cache = ipv6cache
-	dnspod.Domains.Logger = log
+func (dnspod *Dnspod) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	dnspod.Domains = domains
 	dnspod.DNS = dnsConf.DNS
-	dnspod.Domains.GetNewIp(dnsConf)
 	dnspod.logger = log
 	if dnsConf.TTL == "" {
 		// 默认600s
@@ -74,13 +88,13 @@ func (dnspod *Dnspod) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache,
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (dnspod *Dnspod) AddUpdateDomainRecords() ddns.Domains {
-	dnspod.addUpdateDomainRecords("A")
-	dnspod.addUpdateDomainRecords("AAAA")
+func (dnspod *Dnspod) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	dnspod.addUpdateDomainRecords(ctx, "A")
+	dnspod.addUpdateDomainRecords(ctx, "AAAA")
 	return dnspod.Domains
 }
 
-func (dnspod *Dnspod) addUpdateDomainRecords(recordType string) {
+func (dnspod *Dnspod) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := dnspod.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -88,10 +102,13 @@ func (dnspod *Dnspod) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
-		result, err := dnspod.getRecordList(domain, recordType)
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		result, err := dnspod.getRecordList(ctx, domain, recordType)
 		if err != nil {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			dnspod.logger.Infof("Failed to list records of %s! Code: %s, Message: %s", domain, result.Status.Code, result.Status.Message)
+			domain.Fail(ddns.ActionSkip, err, result.Status.Code, result.Status.Message)
+			continue
 		}
 
 		if len(result.Records) > 0 {
@@ -106,16 +123,21 @@ func (dnspod *Dnspod) addUpdateDomainRecords(recordType string) {
 				}
 			}
 			// 更新
-			dnspod.modify(recordSelected, domain, recordType, ipAddr)
+			dnspod.modify(ctx, recordSelected, domain, recordType, ipAddr)
 		} else {
 			// 新增
-			dnspod.create(domain, recordType, ipAddr)
+			dnspod.create(ctx, domain, recordType, ipAddr)
 		}
 	}
 }
 
 // 创建
-func (dnspod *Dnspod) create(domain *ddns.Domain, recordType string, ipAddr string) {
+func (dnspod *Dnspod) create(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
+	if dnspod.Domains.DryRun {
+		dnspod.logger.Infof("Will create record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
 	params := domain.GetCustomParams()
 	params.Set("login_token", dnspod.DNS.ID+","+dnspod.DNS.Secret)
 	params.Set("domain", domain.DomainName)
@@ -129,22 +151,28 @@ func (dnspod *Dnspod) create(domain *ddns.Domain, recordType string, ipAddr stri
 		params.Set("record_line", "默认")
 	}
 
-	status, err := dnspod.commonRequest(recordCreateAPI, params, domain)
+	status, err := dnspod.commonRequest(ctx, recordCreateAPI, params, domain)
 	if err == nil && status.Status.Code == "1" {
-		dnspod.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		dnspod.logger.Infof("Created record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", status.Record.ID.String())
 	} else {
-		dnspod.logger.Infof("新增域名解析 %s 失败！Code: %s, Message: %s", domain, status.Status.Code, status.Status.Message)
-		domain.UpdateStatus = consts.UpdatedFailed
+		dnspod.logger.Infof("Failed to create record %s! Code: %s, Message: %s", domain, status.Status.Code, status.Status.Message)
+		domain.Fail(ddns.ActionCreate, err, status.Status.Code, status.Status.Message)
 	}
 }
 
 // 修改
-func (dnspod *Dnspod) modify(record DnspodRecord, domain *ddns.Domain, recordType string, ipAddr string) {
+func (dnspod *Dnspod) modify(ctx context.Context, record DnspodRecord, domain *ddns.Domain, recordType string, ipAddr string) {
 
 	// 相同不修改
 	if record.Value == ipAddr {
-		dnspod.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+		dnspod.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+		domain.Noop(record.ID)
+		return
+	}
+	if dnspod.Domains.DryRun {
+		dnspod.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionUpdate, record.Value, record.ID)
 		return
 	}
 
@@ -161,31 +189,25 @@ func (dnspod *Dnspod) modify(record DnspodRecord, domain *ddns.Domain, recordTyp
 	if !params.Has("record_line") {
 		params.Set("record_line", "默认")
 	}
-	status, err := dnspod.commonRequest(recordModifyURL, params, domain)
+	status, err := dnspod.commonRequest(ctx, recordModifyURL, params, domain)
 	if err == nil && status.Status.Code == "1" {
-		dnspod.logger.Infof("更新域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		dnspod.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionUpdate, record.Value, record.ID)
 	} else {
-		dnspod.logger.Infof("更新域名解析 %s 失败！Code: %s, Message: %s", domain, status.Status.Code, status.Status.Message)
-		domain.UpdateStatus = consts.UpdatedFailed
+		dnspod.logger.Infof("Failed to update record %s! Code: %s, Message: %s", domain, status.Status.Code, status.Status.Message)
+		domain.Fail(ddns.ActionUpdate, err, status.Status.Code, status.Status.Message)
 	}
 }
 
 // 公共
-func (dnspod *Dnspod) commonRequest(apiAddr string, values url.Values, domain *ddns.Domain) (status DnspodStatus, err error) {
-	client := util.CreateHTTPClient()
-	resp, err := client.PostForm(
-		apiAddr,
-		values,
-	)
-
-	err = util.GetHTTPResponse(resp, apiAddr, err, &status)
+func (dnspod *Dnspod) commonRequest(ctx context.Context, apiAddr string, values url.Values, domain *ddns.Domain) (status DnspodStatus, err error) {
+	err = dnspod.request(ctx, apiAddr, values, &status)
 
 	return
 }
 
 // 获得域名记录列表
-func (dnspod *Dnspod) getRecordList(domain *ddns.Domain, typ string) (result DnspodRecordListResp, err error) {
+func (dnspod *Dnspod) getRecordList(ctx context.Context, domain *ddns.Domain, typ string) (result DnspodRecordListResp, err error) {
 
 	params := domain.GetCustomParams()
 	params.Set("login_token", dnspod.DNS.ID+","+dnspod.DNS.Secret)
@@ -194,13 +216,28 @@ func (dnspod *Dnspod) getRecordList(domain *ddns.Domain, typ string) (result Dns
 	params.Set("sub_domain", domain.GetSubDomain())
 	params.Set("format", "json")
 
-	client := util.CreateHTTPClient()
-	resp, err := client.PostForm(
-		Endpoint,
-		params,
+	err = dnspod.request(ctx, Endpoint, params, &result)
+
+	return
+}
+
+// request 统一请求接口, 以表单方式 POST
+func (dnspod *Dnspod) request(ctx context.Context, apiAddr string, values url.Values, result interface{}) (err error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		apiAddr,
+		strings.NewReader(values.Encode()),
 	)
+	if err != nil {
+		dnspod.logger.Infof("http.NewRequest failed. Error: %s", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	err = util.GetHTTPResponse(resp, Endpoint, err, &result)
+	client := util.CreateHTTPClient()
+	resp, err := client.Do(req)
+	err = util.GetHTTPResponse(resp, apiAddr, err, result)
 
 	return
 }
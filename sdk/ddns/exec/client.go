@@ -0,0 +1,194 @@
+package exec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"time"
+
+	"github.com/jxo-me/ddns/core/logger"
+)
+
+var (
+	ErrProcessExited       = errors.New("exec provider: process exited")
+	ErrUnsupportedVersion  = errors.New("exec provider: unsupported protocol version")
+	ErrUnexpectedResponse  = errors.New("exec provider: unexpected response id")
+	ErrProgramNotSpecified = errors.New("exec provider: program not specified")
+	ErrCallTimeout         = errors.New("exec provider: request timed out")
+)
+
+// DefaultCallTimeout 等待程序返回一个请求的结果的时间, 超时后终止程序
+const DefaultCallTimeout = 30 * time.Second
+
+// client 与外部程序通信, 请求按顺序发送, 每次等待一行结果
+type client struct {
+	cmd    *osexec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+	// stderrDone stderr 读取完毕时关闭
+	stderrDone chan struct{}
+	// reading 未返回的 stdout 读取, 程序被终止时读取仍在进行
+	reading      chan bool
+	timeout      time.Duration
+	id           int
+	capabilities map[string]bool
+	// err 程序被终止的原因, 之后的请求都返回该错误
+	err    error
+	logger logger.ILogger
+}
+
+// start 启动外部程序并完成 handshake, ctx 取消时程序会被终止
+func start(ctx context.Context, program string, args []string, env []string, params HandshakeParams, log logger.ILogger) (*client, error) {
+	if program == "" {
+		return nil, ErrProgramNotSpecified
+	}
+	cmd := osexec.CommandContext(ctx, program, args...)
+	cmd.Env = append(os.Environ(), env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Debugf("%s: %s", program, scanner.Text())
+		}
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	c := &client{
+		cmd:          cmd,
+		stdin:        stdin,
+		stdout:       scanner,
+		stderrDone:   stderrDone,
+		timeout:      DefaultCallTimeout,
+		capabilities: make(map[string]bool),
+		logger:       log,
+	}
+
+	params.Version = ProtocolVersion
+	var result HandshakeResult
+	if err = c.call(ctx, MethodHandshake, params, &result); err != nil {
+		c.close()
+		return nil, err
+	}
+	if result.Version != ProtocolVersion {
+		c.close()
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, result.Version)
+	}
+	for _, capability := range result.Capabilities {
+		c.capabilities[capability] = true
+	}
+	log.Debugf("exec provider %s started, capabilities: %v", result.Name, result.Capabilities)
+
+	return c, nil
+}
+
+// supports 程序是否支持该方法
+func (c *client) supports(method string) bool {
+	return c.capabilities[method]
+}
+
+// call 发送一个请求并读取结果, ctx 取消或超过 timeout 未返回时终止程序
+func (c *client) call(ctx context.Context, method string, params any, result any) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.id++
+	b, err := json.Marshal(&Request{
+		Version: ProtocolVersion,
+		ID:      c.id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = c.stdin.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	c.reading = make(chan bool, 1)
+	go func(reading chan<- bool) {
+		reading <- c.stdout.Scan()
+	}(c.reading)
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	var ok bool
+	select {
+	case ok = <-c.reading:
+		c.reading = nil
+	case <-ctx.Done():
+		return c.kill(ctx.Err())
+	case <-timer.C:
+		return c.kill(fmt.Errorf("%w: %s after %s", ErrCallTimeout, method, c.timeout))
+	}
+	if !ok {
+		if err = c.stdout.Err(); err != nil {
+			return err
+		}
+		return ErrProcessExited
+	}
+	var resp Response
+	if err = json.Unmarshal(c.stdout.Bytes(), &resp); err != nil {
+		return fmt.Errorf("exec provider: invalid response %q: %w", c.stdout.Text(), err)
+	}
+	if resp.ID != c.id {
+		return fmt.Errorf("%w: %d, expected %d", ErrUnexpectedResponse, resp.ID, c.id)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
+
+// kill 终止程序, 之后的请求都返回 err
+func (c *client) kill(err error) error {
+	c.err = err
+	if c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	return err
+}
+
+// close 关闭 stdin 并等待程序退出, 超过 timeout 未退出时终止程序
+// 读取 stdout/stderr 完毕后才调用 Wait, 否则会丢失输出
+func (c *client) close() {
+	_ = c.stdin.Close()
+	select {
+	case <-c.stderrDone:
+	case <-time.After(c.timeout):
+		c.logger.Debugf("exec provider did not exit after stdin was closed, killing it")
+		_ = c.kill(ErrProcessExited)
+		<-c.stderrDone
+	}
+	if c.reading != nil {
+		<-c.reading
+	}
+	if err := c.cmd.Wait(); err != nil {
+		c.logger.Debugf("exec provider exited: %s", err)
+	}
+}
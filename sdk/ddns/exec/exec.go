@@ -0,0 +1,204 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"github.com/jxo-me/ddns/config"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
+)
+
+const (
+	Code = "exec"
+)
+
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Exec{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: true,
+	})
+}
+
+// Exec 外部程序实现, 通过 stdin/stdout 的 JSON 行协议与程序通信
+// dns.ID 为程序路径, dns.args/dns.env 为程序参数和环境变量, dns.secret 会在 handshake 时传给程序
+type Exec struct {
+	DNS     *config.DNS
+	Domains ddns.Domains
+	TTL     string
+	service string
+	logger  logger.ILogger
+}
+
+func (e *Exec) String() string {
+	return Code
+}
+
+func (e *Exec) Endpoint() string {
+	return ""
+}
+
+// Init 初始化
+func (e *Exec) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	e.Domains = domains
+	e.DNS = dnsConf.DNS
+	e.service = dnsConf.Name
+	e.logger = log
+	e.TTL = dnsConf.TTL
+}
+
+// AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
+func (e *Exec) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	ipv4Addr, ipv4Domains := e.Domains.GetNewIpResult("A")
+	ipv6Addr, ipv6Domains := e.Domains.GetNewIpResult("AAAA")
+	if ipv4Addr == "" && ipv6Addr == "" {
+		return e.Domains
+	}
+
+	c, err := start(ctx, e.DNS.ID, e.DNS.Args, e.DNS.Env, HandshakeParams{
+		Service: e.service,
+		ID:      e.DNS.ID,
+		Secret:  e.DNS.Secret,
+		TTL:     e.TTL,
+	}, e.logger)
+	if err != nil {
+		e.logger.Infof("Failed to start exec provider %s! Err: %s", e.DNS.ID, err)
+		e.fail(ipv4Addr, "A", ipv4Domains, err)
+		e.fail(ipv6Addr, "AAAA", ipv6Domains, err)
+		return e.Domains
+	}
+	defer c.close()
+
+	e.addUpdateDomainRecords(ctx, c, "A", ipv4Addr, ipv4Domains)
+	e.addUpdateDomainRecords(ctx, c, "AAAA", ipv6Addr, ipv6Domains)
+	return e.Domains
+}
+
+func (e *Exec) addUpdateDomainRecords(ctx context.Context, c *client, recordType string, ipAddr string, domains []*ddns.Domain) {
+	if ipAddr == "" {
+		return
+	}
+
+	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		params := e.recordParams(domain, recordType)
+
+		if !c.supports(MethodList) {
+			// 不支持查询, 直接提交新的IP
+			method, action := MethodUpdate, ddns.ActionUpdate
+			if !c.supports(MethodUpdate) {
+				method, action = MethodCreate, ddns.ActionCreate
+			}
+			e.write(ctx, c, method, action, domain, params, ipAddr, "")
+			continue
+		}
+
+		var list ListResult
+		if err := c.call(ctx, MethodList, params, &list); err != nil {
+			e.logger.Infof("Failed to list records of %s! Err: %s", domain, err)
+			e.failDomain(domain, ddns.ActionSkip, err)
+			continue
+		}
+		if len(list.Records) == 0 {
+			e.write(ctx, c, MethodCreate, ddns.ActionCreate, domain, params, ipAddr, "")
+			continue
+		}
+
+		// 默认第一个
+		record := list.Records[0]
+		if recordID := domain.GetCustomParams().Get("RecordId"); recordID != "" {
+			for _, r := range list.Records {
+				if r.ID == recordID {
+					record = r
+				}
+			}
+		}
+		if record.Value == ipAddr {
+			e.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+			domain.Noop(record.ID)
+			continue
+		}
+		params.ID = record.ID
+		if c.supports(MethodUpdate) {
+			e.write(ctx, c, MethodUpdate, ddns.ActionUpdate, domain, params, ipAddr, record.Value)
+			continue
+		}
+		// 不支持更新, 先删除再新增
+		if e.Domains.DryRun {
+			e.write(ctx, c, MethodCreate, ddns.ActionUpdate, domain, params, ipAddr, record.Value)
+			continue
+		}
+		if err := c.call(ctx, MethodDelete, params, nil); err != nil {
+			e.logger.Infof("Failed to delete record %s! Err: %s", domain, err)
+			e.failDomain(domain, ddns.ActionUpdate, err)
+			continue
+		}
+		params.ID = ""
+		e.write(ctx, c, MethodCreate, ddns.ActionUpdate, domain, params, ipAddr, record.Value)
+	}
+}
+
+// write 新增或更新记录
+func (e *Exec) write(ctx context.Context, c *client, method string, action ddns.UpdateAction, domain *ddns.Domain, params *RecordParams, ipAddr string, previous string) {
+	params.Value = ipAddr
+	if e.Domains.DryRun {
+		e.logger.Infof("Will %s record %s, IP: %s", action, domain, ipAddr)
+		domain.Plan(action, previous, params.ID)
+		return
+	}
+	var result RecordResult
+	if err := c.call(ctx, method, params, &result); err != nil {
+		e.logger.Infof("Failed to %s record %s! Err: %s", action, domain, err)
+		e.failDomain(domain, action, err)
+		return
+	}
+	e.logger.Infof("%s record %s successfully! IP: %s", action, domain, ipAddr)
+	recordID := result.Record.ID
+	if recordID == "" {
+		recordID = params.ID
+	}
+	domain.Succeed(action, previous, recordID)
+}
+
+// failDomain 记录程序返回的错误码和错误信息
+func (e *Exec) failDomain(domain *ddns.Domain, action ddns.UpdateAction, err error) {
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) {
+		domain.Fail(action, err, protocolErr.Code, protocolErr.Message)
+		return
+	}
+	domain.Fail(action, err, "", "")
+}
+
+// fail 程序启动失败, 所有待更新的域名都失败
+func (e *Exec) fail(ipAddr string, recordType string, domains []*ddns.Domain, err error) {
+	if ipAddr == "" {
+		return
+	}
+	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		e.failDomain(domain, ddns.ActionSkip, err)
+	}
+}
+
+func (e *Exec) recordParams(domain *ddns.Domain, recordType string) *RecordParams {
+	params := &RecordParams{
+		Domain:     domain.DomainName,
+		SubDomain:  domain.GetSubDomain(),
+		FQDN:       domain.String(),
+		RecordType: recordType,
+		TTL:        e.TTL,
+	}
+	if customParams := domain.GetCustomParams(); len(customParams) > 0 {
+		params.Params = make(map[string]string, len(customParams))
+		for k := range customParams {
+			params.Params[k] = customParams.Get(k)
+		}
+	}
+	return params
+}
@@ -0,0 +1,190 @@
+package exec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	"github.com/jxo-me/ddns/consts"
+	xcache "github.com/jxo-me/ddns/sdk/cache"
+	"github.com/jxo-me/ddns/sdk/ddns"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+const helperEnv = "DDNS_EXEC_HELPER_PROCESS"
+
+// TestHelperProcess 作为外部程序运行, 记录保存在内存中
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperEnv) != "1" {
+		return
+	}
+	records := map[string]Record{
+		"www.example.com": {ID: "1", Value: "1.1.1.1"},
+		"api.example.com": {ID: "2", Value: "2.2.2.2"},
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			Request
+			Params RecordParams `json:"params"`
+		}
+		_ = json.Unmarshal(scanner.Bytes(), &req)
+		resp := map[string]any{"id": req.ID}
+		switch req.Method {
+		case MethodHandshake:
+			resp["result"] = HandshakeResult{Version: ProtocolVersion, Name: "helper", Capabilities: []string{MethodList, MethodCreate, MethodUpdate}}
+		case MethodList:
+			if req.Params.FQDN == "hang.example.com" {
+				select {}
+			}
+			var list ListResult
+			if r, ok := records[req.Params.FQDN]; ok {
+				list.Records = append(list.Records, r)
+			}
+			resp["result"] = list
+		case MethodCreate:
+			if req.Params.SubDomain == "denied" {
+				resp["error"] = ProtocolError{Code: "Forbidden", Message: "denied"}
+				break
+			}
+			resp["result"] = RecordResult{Record: Record{ID: "3", Value: req.Params.Value}}
+		case MethodUpdate:
+			resp["result"] = RecordResult{Record: Record{ID: req.Params.ID, Value: req.Params.Value}}
+		}
+		_ = encoder.Encode(resp)
+	}
+	os.Exit(0)
+}
+
+// newDomains 使用固定的IPv4地址
+func newDomains(conf *config.DDnsConfig) ddns.Domains {
+	domains := ddns.Domains{Ipv4Cache: &xcache.IpCache{}, Ipv6Cache: &xcache.IpCache{}, Logger: xlogger.Nop()}
+	domains.GetNewIp(context.Background(), conf, nil, nil)
+	domains.Ipv4Addr = "1.1.1.1"
+	return domains
+}
+
+// TestExec 测试 exec 服务商新增、更新、未改变和失败
+func TestExec(t *testing.T) {
+	e := &Exec{}
+	conf := &config.DDnsConfig{
+		Name: "test",
+		DNS: &config.DNS{
+			Name: Code,
+			ID:   os.Args[0],
+			Args: []string{"-test.run=TestHelperProcess"},
+			Env:  []string{helperEnv + "=1"},
+		},
+		Ipv6: &config.Ipv6{},
+		Ipv4: &config.Ipv4{
+			Domains: []string{"www.example.com", "api.example.com", "new.example.com", "denied.example.com"},
+		},
+	}
+	e.Init(conf, newDomains(conf), xlogger.Nop())
+
+	domains := e.AddUpdateDomainRecords(context.Background())
+	expected := []struct {
+		action ddns.UpdateAction
+		status consts.UpdateStatusType
+		id     string
+	}{
+		{ddns.ActionNoop, consts.UpdatedNothing, "1"},
+		{ddns.ActionUpdate, consts.UpdatedSuccess, "2"},
+		{ddns.ActionCreate, consts.UpdatedSuccess, "3"},
+		{ddns.ActionCreate, consts.UpdatedFailed, ""},
+	}
+	for i, domain := range domains.Ipv4Domains {
+		result := domain.Result
+		if result == nil {
+			t.Fatalf("%s 没有更新结果", domain)
+		}
+		if result.Action != expected[i].action || result.Status != expected[i].status || result.RecordID != expected[i].id {
+			t.Errorf("%s 期待 %v，得到 %+v", domain, expected[i], result)
+		}
+	}
+	if result := domains.Ipv4Domains[3].Result; result.ErrorCode != "Forbidden" {
+		t.Errorf("期待错误码 Forbidden，得到 %s", result.ErrorCode)
+	}
+}
+
+// TestExecStartFailed 测试程序无法启动
+func TestExecStartFailed(t *testing.T) {
+	e := &Exec{}
+	conf := &config.DDnsConfig{
+		DNS:  &config.DNS{Name: Code, ID: fmt.Sprintf("%s-not-exist", os.Args[0])},
+		Ipv6: &config.Ipv6{},
+		Ipv4: &config.Ipv4{Domains: []string{"www.example.com"}},
+	}
+	e.Init(conf, newDomains(conf), xlogger.Nop())
+
+	domains := e.AddUpdateDomainRecords(context.Background())
+	if result := domains.Ipv4Domains[0].Result; result == nil || !result.Failed() {
+		t.Errorf("期待失败，得到 %+v", result)
+	}
+}
+
+// TestExecDryRun 测试预览模式只查询不写入
+func TestExecDryRun(t *testing.T) {
+	e := &Exec{}
+	conf := &config.DDnsConfig{
+		DNS: &config.DNS{
+			Name: Code,
+			ID:   os.Args[0],
+			Args: []string{"-test.run=TestHelperProcess"},
+			Env:  []string{helperEnv + "=1"},
+		},
+		Ipv6: &config.Ipv6{},
+		Ipv4: &config.Ipv4{Domains: []string{"www.example.com", "api.example.com", "denied.example.com"}},
+	}
+	domains := newDomains(conf)
+	domains.DryRun = true
+	e.Init(conf, domains, xlogger.Nop())
+
+	expected := []struct {
+		action ddns.UpdateAction
+		status consts.UpdateStatusType
+	}{
+		{ddns.ActionNoop, consts.UpdatedNothing},
+		{ddns.ActionUpdate, consts.UpdatedPlanned},
+		// 预览时不会请求 create, 所以不会失败
+		{ddns.ActionCreate, consts.UpdatedPlanned},
+	}
+	for i, domain := range e.AddUpdateDomainRecords(context.Background()).Ipv4Domains {
+		if domain.Result.Action != expected[i].action || domain.Result.Status != expected[i].status {
+			t.Errorf("%s 期待 %v，得到 %+v", domain, expected[i], domain.Result)
+		}
+	}
+}
+
+// TestCallTimeout 测试程序没有返回结果时超时并终止程序
+func TestCallTimeout(t *testing.T) {
+	c, err := start(context.Background(), os.Args[0], []string{"-test.run=TestHelperProcess"}, []string{helperEnv + "=1"}, HandshakeParams{}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.timeout = 50 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var list ListResult
+		if err := c.call(context.Background(), MethodList, &RecordParams{FQDN: "hang.example.com"}, &list); !errors.Is(err, ErrCallTimeout) {
+			t.Errorf("程序没有返回结果时应超时，得到 %v", err)
+		}
+		if err := c.call(context.Background(), MethodList, &RecordParams{FQDN: "www.example.com"}, &list); !errors.Is(err, ErrCallTimeout) {
+			t.Errorf("程序被终止后的请求应失败，得到 %v", err)
+		}
+		c.close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("超时后没有终止程序")
+	}
+}
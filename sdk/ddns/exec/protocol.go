@@ -0,0 +1,106 @@
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion exec 服务商协议版本
+//
+// 每行一个JSON对象, ddns 通过 stdin 发送请求, 程序通过 stdout 返回结果, stderr 会输出到日志。
+// 启动后首先发送 handshake, 程序返回其支持的协议版本和方法:
+//
+//	-> {"version":1,"id":1,"method":"handshake","params":{"version":1,"service":"home","secret":"..."}}
+//	<- {"id":1,"result":{"version":1,"name":"my-dns","capabilities":["list","create","update","delete"]}}
+//
+// 之后对每个域名发送 list/create/update/delete, 失败时返回 error:
+//
+//	-> {"version":1,"id":2,"method":"list","params":{"domain":"example.com","subDomain":"www","fqdn":"www.example.com","recordType":"A"}}
+//	<- {"id":2,"result":{"records":[{"id":"1","value":"1.1.1.1","ttl":600}]}}
+//	-> {"version":1,"id":3,"method":"update","params":{...,"id":"1","value":"2.2.2.2","ttl":600}}
+//	<- {"id":3,"error":{"code":"Forbidden","message":"token expired"}}
+//
+// 所有请求完成后关闭 stdin, 程序应随即退出。
+const ProtocolVersion = 1
+
+// 协议方法
+const (
+	MethodHandshake = "handshake"
+	MethodList      = "list"
+	MethodCreate    = "create"
+	MethodUpdate    = "update"
+	MethodDelete    = "delete"
+)
+
+// Request 请求
+type Request struct {
+	Version int    `json:"version"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// Response 返回结果, Error 不为空表示失败
+type Response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *ProtocolError  `json:"error,omitempty"`
+}
+
+// ProtocolError 程序返回的错误
+type ProtocolError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("exec provider error: code: %s, message: %s", e.Code, e.Message)
+}
+
+// HandshakeParams handshake 参数
+type HandshakeParams struct {
+	Version int    `json:"version"`
+	Service string `json:"service"`
+	ID      string `json:"id,omitempty"`
+	Secret  string `json:"secret,omitempty"`
+	TTL     string `json:"ttl,omitempty"`
+}
+
+// HandshakeResult handshake 结果
+type HandshakeResult struct {
+	Version      int      `json:"version"`
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// RecordParams list/create/update/delete 参数
+type RecordParams struct {
+	Domain     string `json:"domain"`
+	SubDomain  string `json:"subDomain"`
+	FQDN       string `json:"fqdn"`
+	RecordType string `json:"recordType"`
+	// ID create/list 时为空
+	ID string `json:"id,omitempty"`
+	// Value list/delete 时为空
+	Value string `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"`
+	// Params 域名后的自定义参数
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Record 解析记录
+type Record struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+	TTL   int    `json:"ttl,omitempty"`
+}
+
+// ListResult list 结果
+type ListResult struct {
+	Records []Record `json:"records"`
+}
+
+// RecordResult create/update 结果
+type RecordResult struct {
+	Record Record `json:"record"`
+}
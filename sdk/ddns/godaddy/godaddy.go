@@ -2,14 +2,16 @@ package godaddy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 	"strconv"
 )
@@ -19,6 +21,15 @@ const (
 	Code     string = "godaddy"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &GoDaddyDNS{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  false,
+		CustomParams: false,
+	})
+}
+
 type godaddyRecord struct {
 	Data string `json:"data"`
 	Name string `json:"name"`
@@ -28,6 +39,12 @@ type godaddyRecord struct {
 
 type godaddyRecords []godaddyRecord
 
+// godaddyError 失败时返回的错误码和错误信息
+type godaddyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 type GoDaddyDNS struct {
 	dns      *config.DNS
 	domains  ddns.Domains
@@ -47,15 +64,12 @@ func (g *GoDaddyDNS) Endpoint() string {
 	return Endpoint
 }
 
-func (g *GoDaddyDNS) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	g.domains.Ipv4Cache = ipv4cache
-	g.domains.Ipv6Cache = ipv6cache
-	g.domains.Logger = log
-	g.lastIpv4 = ipv4cache.GetAddr()
-	g.lastIpv6 = ipv6cache.GetAddr()
+func (g *GoDaddyDNS) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	g.domains = domains
+	g.lastIpv4 = domains.Ipv4Cache.GetAddr()
+	g.lastIpv6 = domains.Ipv6Cache.GetAddr()
 
 	g.dns = dnsConf.DNS
-	g.domains.GetNewIp(dnsConf)
 	g.logger = log
 	g.ttl = 600
 	if val, err := strconv.Atoi(dnsConf.TTL); err == nil {
@@ -69,7 +83,7 @@ func (g *GoDaddyDNS) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache,
 	g.client = util.CreateHTTPClient()
 }
 
-func (g *GoDaddyDNS) updateDomainRecord(recordType string, ipAddr string, domains []*ddns.Domain) {
+func (g *GoDaddyDNS) updateDomainRecord(ctx context.Context, recordType string, ipAddr string, domains []*ddns.Domain) {
 	if ipAddr == "" {
 		return
 	}
@@ -77,44 +91,59 @@ func (g *GoDaddyDNS) updateDomainRecord(recordType string, ipAddr string, domain
 	// 防止多次发送Webhook通知
 	if recordType == "A" {
 		if g.lastIpv4 == ipAddr {
-			g.logger.Infof("你的IPv4未变化, 未触发Godaddy请求")
+			g.logger.Infof("Your IPv4 has not changed, GoDaddy request not triggered")
+			ddns.SkipDomains(domains, "IPv4 address unchanged")
 			return
 		}
 	} else {
 		if g.lastIpv6 == ipAddr {
-			g.logger.Infof("你的IPv6未变化, 未触发Godaddy请求")
+			g.logger.Infof("Your IPv6 has not changed, GoDaddy request not triggered")
+			ddns.SkipDomains(domains, "IPv6 address unchanged")
 			return
 		}
 	}
 
 	for _, domain := range domains {
-		err := g.sendReq(http.MethodPut, recordType, domain, &godaddyRecords{godaddyRecord{
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		if g.domains.DryRun {
+			// 无法查询现有记录, 只能提交新的IP
+			g.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+			domain.Plan(ddns.ActionUpdate, "", "")
+			continue
+		}
+		err := g.sendReq(ctx, http.MethodPut, recordType, domain, &godaddyRecords{godaddyRecord{
 			Data: ipAddr,
 			Name: domain.GetSubDomain(),
 			TTL:  g.ttl,
 			Type: recordType,
 		}})
 		if err == nil {
-			g.logger.Infof("更新域名解析 %s 成功! IP: %s", domain, ipAddr)
-			domain.UpdateStatus = consts.UpdatedSuccess
+			g.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+			domain.Succeed(ddns.ActionUpdate, "", "")
 		} else {
-			g.logger.Infof("更新域名解析 %s 失败！", domain)
-			domain.UpdateStatus = consts.UpdatedFailed
+			var gErr godaddyError
+			var httpErr *util.HTTPError
+			if errors.As(err, &httpErr) {
+				_ = json.Unmarshal(httpErr.Body, &gErr)
+			}
+			g.logger.Infof("Failed to update record %s! Code: %s, Message: %s", domain, gErr.Code, gErr.Message)
+			domain.Fail(ddns.ActionUpdate, err, gErr.Code, gErr.Message)
 		}
 	}
 }
 
-func (g *GoDaddyDNS) AddUpdateDomainRecords() ddns.Domains {
+func (g *GoDaddyDNS) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
 	if ipv4Addr, ipv4Domains := g.domains.GetNewIpResult("A"); ipv4Addr != "" {
-		g.updateDomainRecord("A", ipv4Addr, ipv4Domains)
+		g.updateDomainRecord(ctx, "A", ipv4Addr, ipv4Domains)
 	}
 	if ipv6Addr, ipv6Domains := g.domains.GetNewIpResult("AAAA"); ipv6Addr != "" {
-		g.updateDomainRecord("AAAA", ipv6Addr, ipv6Domains)
+		g.updateDomainRecord(ctx, "AAAA", ipv6Addr, ipv6Domains)
 	}
 	return g.domains
 }
 
-func (g *GoDaddyDNS) sendReq(method string, rType string, domain *ddns.Domain, data *godaddyRecords) error {
+func (g *GoDaddyDNS) sendReq(ctx context.Context, method string, rType string, domain *ddns.Domain, data *godaddyRecords) error {
 
 	var body *bytes.Buffer
 	if data != nil {
@@ -126,7 +155,7 @@ func (g *GoDaddyDNS) sendReq(method string, rType string, domain *ddns.Domain, d
 	}
 	path := fmt.Sprintf("%s/%s/records/%s/%s", Endpoint, domain.DomainName, rType, domain.GetSubDomain())
 
-	req, err := http.NewRequest(method, path, body)
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
 	if err != nil {
 		return err
 	}
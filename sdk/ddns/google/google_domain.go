@@ -1,12 +1,13 @@
 package google
 
 import (
+	"context"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"io"
 	"net/http"
 	"net/url"
@@ -18,6 +19,15 @@ const (
 	Code     string = "google"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &GoogleDomain{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  false,
+		CustomParams: true,
+	})
+}
+
 // GoogleDomain Google Domain
 // https://support.google.com/domains/answer/6147083?hl=zh-Hans#zippy=%2C使用-api-更新您的动态-dns-记录
 type GoogleDomain struct {
@@ -39,23 +49,20 @@ func (gd *GoogleDomain) Endpoint() string {
 }
 
 // Init 初始化
-func (gd *GoogleDomain) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	gd.Domains.Ipv4Cache = ipv4cache
-	gd.Domains.Ipv6Cache = ipv6cache
-	gd.Domains.Logger = log
+func (gd *GoogleDomain) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	gd.Domains = domains
 	gd.DNS = dnsConf.DNS
-	gd.Domains.GetNewIp(dnsConf)
 	gd.logger = log
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (gd *GoogleDomain) AddUpdateDomainRecords() ddns.Domains {
-	gd.addUpdateDomainRecords("A")
-	gd.addUpdateDomainRecords("AAAA")
+func (gd *GoogleDomain) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	gd.addUpdateDomainRecords(ctx, "A")
+	gd.addUpdateDomainRecords(ctx, "AAAA")
 	return gd.Domains
 }
 
-func (gd *GoogleDomain) addUpdateDomainRecords(recordType string) {
+func (gd *GoogleDomain) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := gd.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -65,18 +72,28 @@ func (gd *GoogleDomain) addUpdateDomainRecords(recordType string) {
 	// 防止多次发送Webhook通知
 	if recordType == "A" {
 		if gd.lastIpv4 == ipAddr {
-			gd.logger.Infof("你的IPv4未变化, 未触发Google请求")
+			gd.logger.Infof("Your IPv4 has not changed, Google request not triggered")
+			ddns.SkipDomains(domains, "IPv4 address unchanged")
 			return
 		}
 	} else {
 		if gd.lastIpv6 == ipAddr {
-			gd.logger.Infof("你的IPv6未变化, 未触发Google请求")
+			gd.logger.Infof("Your IPv6 has not changed, Google request not triggered")
+			ddns.SkipDomains(domains, "IPv6 address unchanged")
 			return
 		}
 	}
 
 	for _, domain := range domains {
-		gd.modify(domain, recordType, ipAddr)
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		if gd.Domains.DryRun {
+			// 无法查询现有记录, 只能提交新的IP
+			gd.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+			domain.Plan(ddns.ActionUpdate, "", "")
+			continue
+		}
+		gd.modify(ctx, domain, recordType, ipAddr)
 	}
 }
 
@@ -85,43 +102,45 @@ func (gd *GoogleDomain) String() string {
 }
 
 // 修改
-func (gd *GoogleDomain) modify(domain *ddns.Domain, recordType string, ipAddr string) {
+func (gd *GoogleDomain) modify(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
 	params := domain.GetCustomParams()
 	params.Set("hostname", domain.GetFullDomain())
 	params.Set("myip", ipAddr)
 
 	var result GoogleDomainResp
-	err := gd.request(params, &result)
+	err := gd.request(ctx, params, &result)
 
 	if err != nil {
-		gd.logger.Infof("修改域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		gd.logger.Infof("Failed to update record %s! Err: %s", domain, err)
+		domain.Fail(ddns.ActionUpdate, err, "", "")
 		return
 	}
 
 	switch result.Status {
 	case "nochg":
-		gd.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+		gd.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+		domain.Noop("")
 	case "good":
-		gd.logger.Infof("修改域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		gd.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionUpdate, "", "")
 	default:
-		gd.logger.Infof("修改域名解析 %s 失败！Status: %s", domain, result.Status)
-		domain.UpdateStatus = consts.UpdatedFailed
+		gd.logger.Infof("Failed to update record %s! Status: %s", domain, result.Status)
+		domain.Fail(ddns.ActionUpdate, nil, result.Status, "")
 	}
 }
 
 // request 统一请求接口
-func (gd *GoogleDomain) request(params url.Values, result *GoogleDomainResp) (err error) {
+func (gd *GoogleDomain) request(ctx context.Context, params url.Values, result *GoogleDomainResp) (err error) {
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
 		Endpoint,
 		http.NoBody,
 	)
 
 	if err != nil {
-		gd.logger.Infof("http.NewRequest失败. Error: ", err)
+		gd.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
@@ -131,7 +150,7 @@ func (gd *GoogleDomain) request(params url.Values, result *GoogleDomainResp) (er
 	client := util.CreateHTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
-		gd.logger.Infof("client.Do失败. Error: ", err)
+		gd.logger.Infof("client.Do failed. Error: %s", err)
 		return
 	}
 
@@ -2,14 +2,15 @@ package huawei
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 	"strconv"
 )
@@ -19,6 +20,15 @@ const (
 	Code     string = "huaweicloud"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Huaweicloud{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: false,
+	})
+}
+
 // Huaweicloud Huaweicloud
 // https://support.huaweicloud.com/api-dns/dns_api_64001.html
 type Huaweicloud struct {
@@ -39,11 +49,19 @@ type HuaweicloudZonesResp struct {
 
 // HuaweicloudRecordsResp 记录返回结果
 type HuaweicloudRecordsResp struct {
+	HuaweicloudStatus
 	Recordsets []HuaweicloudRecordsets
 }
 
+// HuaweicloudStatus 失败时返回的错误码和错误信息
+type HuaweicloudStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 // HuaweicloudRecordsets 记录
 type HuaweicloudRecordsets struct {
+	HuaweicloudStatus
 	ID      string
 	Name    string `json:"name"`
 	ZoneID  string `json:"zone_id"`
@@ -62,12 +80,9 @@ func (hw *Huaweicloud) Endpoint() string {
 }
 
 // Init 初始化
-func (hw *Huaweicloud) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	hw.Domains.Ipv4Cache = ipv4cache
-	hw.Domains.Ipv6Cache = ipv6cache
-	hw.Domains.Logger = log
+func (hw *Huaweicloud) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	hw.Domains = domains
 	hw.DNS = dnsConf.DNS
-	hw.Domains.GetNewIp(dnsConf)
 	hw.logger = log
 	if dnsConf.TTL == "" {
 		// 默认300s
@@ -83,13 +98,13 @@ func (hw *Huaweicloud) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (hw *Huaweicloud) AddUpdateDomainRecords() ddns.Domains {
-	hw.addUpdateDomainRecords("A")
-	hw.addUpdateDomainRecords("AAAA")
+func (hw *Huaweicloud) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	hw.addUpdateDomainRecords(ctx, "A")
+	hw.addUpdateDomainRecords(ctx, "AAAA")
 	return hw.Domains
 }
 
-func (hw *Huaweicloud) addUpdateDomainRecords(recordType string) {
+func (hw *Huaweicloud) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := hw.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -97,10 +112,13 @@ func (hw *Huaweicloud) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
 
 		var records HuaweicloudRecordsResp
 
 		err := hw.request(
+			ctx,
 			"GET",
 			fmt.Sprintf(Endpoint+"/v2/recordsets?type=%s&name=%s", recordType, domain),
 			nil,
@@ -108,8 +126,9 @@ func (hw *Huaweicloud) addUpdateDomainRecords(recordType string) {
 		)
 
 		if err != nil {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			hw.logger.Infof("Failed to list records of %s! Code: %s, Message: %s", domain, records.Code, records.Message)
+			domain.Fail(ddns.ActionSkip, err, records.Code, records.Message)
+			continue
 		}
 
 		find := false
@@ -117,7 +136,7 @@ func (hw *Huaweicloud) addUpdateDomainRecords(recordType string) {
 			// 名称相同才更新。华为云默认是模糊搜索
 			if record.Name == domain.String()+"." {
 				// 更新
-				hw.modify(record, domain, recordType, ipAddr)
+				hw.modify(ctx, record, domain, recordType, ipAddr)
 				find = true
 				break
 			}
@@ -125,20 +144,28 @@ func (hw *Huaweicloud) addUpdateDomainRecords(recordType string) {
 
 		if !find {
 			// 新增
-			hw.create(domain, recordType, ipAddr)
+			hw.create(ctx, domain, recordType, ipAddr)
 		}
 
 	}
 }
 
 // 创建
-func (hw *Huaweicloud) create(domain *ddns.Domain, recordType string, ipAddr string) {
-	zone, err := hw.getZones(domain)
+func (hw *Huaweicloud) create(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
+	if hw.Domains.DryRun {
+		hw.logger.Infof("Will create record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
+	zone, err := hw.getZones(ctx, domain)
 	if err != nil {
+		hw.logger.Infof("Failed to get zones of %s! Err: %s", domain, err)
+		domain.Fail(ddns.ActionCreate, err, "", "")
 		return
 	}
 	if len(zone.Zones) == 0 {
-		hw.logger.Infof("未能找到公网域名, 请检查域名是否添加")
+		hw.logger.Infof("Public zone %s not found, please check whether the domain has been added", domain.DomainName)
+		domain.Fail(ddns.ActionCreate, nil, "", "public zone not found")
 		return
 	}
 
@@ -158,26 +185,37 @@ func (hw *Huaweicloud) create(domain *ddns.Domain, recordType string, ipAddr str
 	}
 	var result HuaweicloudRecordsets
 	err = hw.request(
+		ctx,
 		"POST",
 		fmt.Sprintf(Endpoint+"/v2/zones/%s/recordsets", zoneID),
 		record,
 		&result,
 	)
 	if err == nil && (len(result.Records) > 0 && result.Records[0] == ipAddr) {
-		hw.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		hw.logger.Infof("Created record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", result.ID)
 	} else {
-		hw.logger.Infof("新增域名解析 %s 失败！Status: %s", domain, result.Status)
-		domain.UpdateStatus = consts.UpdatedFailed
+		hw.logger.Infof("Failed to create record %s! Status: %s, Code: %s, Message: %s", domain, result.Status, result.Code, result.Message)
+		domain.Fail(ddns.ActionCreate, err, result.Code, result.Message)
 	}
 }
 
 // 修改
-func (hw *Huaweicloud) modify(record HuaweicloudRecordsets, domain *ddns.Domain, recordType string, ipAddr string) {
+func (hw *Huaweicloud) modify(ctx context.Context, record HuaweicloudRecordsets, domain *ddns.Domain, recordType string, ipAddr string) {
 
 	// 相同不修改
 	if len(record.Records) > 0 && record.Records[0] == ipAddr {
-		hw.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+		hw.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+		domain.Noop(record.ID)
+		return
+	}
+	previous := ""
+	if len(record.Records) > 0 {
+		previous = record.Records[0]
+	}
+	if hw.Domains.DryRun {
+		hw.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionUpdate, previous, record.ID)
 		return
 	}
 
@@ -188,6 +226,7 @@ func (hw *Huaweicloud) modify(record HuaweicloudRecordsets, domain *ddns.Domain,
 	var result HuaweicloudRecordsets
 
 	err := hw.request(
+		ctx,
 		"PUT",
 		fmt.Sprintf(Endpoint+"/v2/zones/%s/recordsets/%s", record.ZoneID, record.ID),
 		&request,
@@ -195,17 +234,18 @@ func (hw *Huaweicloud) modify(record HuaweicloudRecordsets, domain *ddns.Domain,
 	)
 
 	if err == nil && (len(result.Records) > 0 && result.Records[0] == ipAddr) {
-		hw.logger.Infof("更新域名解析 %s 成功！IP: %s, 状态: %s", domain, ipAddr, result.Status)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		hw.logger.Infof("Updated record %s successfully! IP: %s, Status: %s", domain, ipAddr, result.Status)
+		domain.Succeed(ddns.ActionUpdate, previous, record.ID)
 	} else {
-		hw.logger.Infof("更新域名解析 %s 失败！Status: %s", domain, result.Status)
-		domain.UpdateStatus = consts.UpdatedFailed
+		hw.logger.Infof("Failed to update record %s! Status: %s, Code: %s, Message: %s", domain, result.Status, result.Code, result.Message)
+		domain.Fail(ddns.ActionUpdate, err, result.Code, result.Message)
 	}
 }
 
 // 获得域名记录列表
-func (hw *Huaweicloud) getZones(domain *ddns.Domain) (result HuaweicloudZonesResp, err error) {
+func (hw *Huaweicloud) getZones(ctx context.Context, domain *ddns.Domain) (result HuaweicloudZonesResp, err error) {
 	err = hw.request(
+		ctx,
 		"GET",
 		fmt.Sprintf(Endpoint+"/v2/zones?name=%s", domain.DomainName),
 		nil,
@@ -216,20 +256,21 @@ func (hw *Huaweicloud) getZones(domain *ddns.Domain) (result HuaweicloudZonesRes
 }
 
 // request 统一请求接口
-func (hw *Huaweicloud) request(method string, url string, data interface{}, result interface{}) (err error) {
+func (hw *Huaweicloud) request(ctx context.Context, method string, url string, data interface{}, result interface{}) (err error) {
 	jsonStr := make([]byte, 0)
 	if data != nil {
 		jsonStr, _ = json.Marshal(data)
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		method,
 		url,
 		bytes.NewBuffer(jsonStr),
 	)
 
 	if err != nil {
-		hw.logger.Infof("http.NewRequest失败. Error: ", err)
+		hw.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
@@ -1,12 +1,13 @@
 package namecheap
 
 import (
+	"context"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"io"
 	"net/http"
 	"strings"
@@ -17,6 +18,15 @@ const (
 	Code     string = "namecheap"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &NameCheap{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         false,
+		ReadRecords:  false,
+		CustomParams: false,
+	})
+}
+
 // NameCheap Domain
 type NameCheap struct {
 	DNS      *config.DNS
@@ -41,26 +51,23 @@ func (nc *NameCheap) Endpoint() string {
 }
 
 // Init 初始化
-func (nc *NameCheap) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	nc.Domains.Ipv4Cache = ipv4cache
-	nc.Domains.Ipv6Cache = ipv6cache
-	nc.Domains.Logger = log
-	nc.lastIpv4 = ipv4cache.GetAddr()
-	nc.lastIpv6 = ipv6cache.GetAddr()
+func (nc *NameCheap) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	nc.Domains = domains
+	nc.lastIpv4 = domains.Ipv4Cache.GetAddr()
+	nc.lastIpv6 = domains.Ipv6Cache.GetAddr()
 
 	nc.DNS = dnsConf.DNS
-	nc.Domains.GetNewIp(dnsConf)
 	nc.logger = log
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (nc *NameCheap) AddUpdateDomainRecords() ddns.Domains {
-	nc.addUpdateDomainRecords("A")
-	nc.addUpdateDomainRecords("AAAA")
+func (nc *NameCheap) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	nc.addUpdateDomainRecords(ctx, "A")
+	nc.addUpdateDomainRecords(ctx, "AAAA")
 	return nc.Domains
 }
 
-func (nc *NameCheap) addUpdateDomainRecords(recordType string) {
+func (nc *NameCheap) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := nc.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -70,75 +77,86 @@ func (nc *NameCheap) addUpdateDomainRecords(recordType string) {
 	// 防止多次发送Webhook通知
 	if recordType == "A" {
 		if nc.lastIpv4 == ipAddr {
-			nc.logger.Infof("你的IPv4未变化, 未触发Namecheap请求")
+			nc.logger.Infof("Your IPv4 has not changed, Namecheap request not triggered")
+			ddns.SkipDomains(domains, "IPv4 address unchanged")
 			return
 		}
 	} else {
 		// https://www.namecheap.com/support/knowledgebase/article.aspx/29/11/how-to-dynamically-update-the-hosts-ip-with-an-http-request/
-		nc.logger.Infof("Namecheap DDNS 不支持更新 IPv6！")
+		nc.logger.Infof("Namecheap DDNS does not support updating IPv6!")
+		ddns.SkipDomains(domains, "IPv6 is not supported by Namecheap DDNS")
 		return
 		// if nc.lastIpv6 == ipAddr {
-		// 	nc.logger.Infof("你的IPv6未变化, 未触发Namecheap请求")
+		// 	nc.logger.Infof("Your IPv6 has not changed, Namecheap request not triggered")
 		// 	return
 		// }
 	}
 
 	for _, domain := range domains {
-		nc.modify(domain, recordType, ipAddr)
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		if nc.Domains.DryRun {
+			// 无法查询现有记录, 只能提交新的IP
+			nc.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+			domain.Plan(ddns.ActionUpdate, "", "")
+			continue
+		}
+		nc.modify(ctx, domain, recordType, ipAddr)
 	}
 }
 
 // 修改
-func (nc *NameCheap) modify(domain *ddns.Domain, recordType string, ipAddr string) {
+func (nc *NameCheap) modify(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
 	var result NameCheapResp
-	err := nc.request(&result, ipAddr, domain)
+	err := nc.request(ctx, &result, ipAddr, domain)
 
 	if err != nil {
-		nc.logger.Infof("修改域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		nc.logger.Infof("Failed to update record %s! Err: %s", domain, err)
+		domain.Fail(ddns.ActionUpdate, err, "", "")
 		return
 	}
 
 	switch result.Status {
 	case "Success":
-		nc.logger.Infof("修改域名解析 %s 成功！IP: %s\n", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		nc.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionUpdate, "", "")
 	default:
-		nc.logger.Infof("修改域名解析 %s 失败！Status: %s\n", domain, result.Status)
-		domain.UpdateStatus = consts.UpdatedFailed
+		nc.logger.Infof("Failed to update record %s! Status: %s", domain, result.Status)
+		domain.Fail(ddns.ActionUpdate, nil, "", result.Status)
 	}
 }
 
 // request 统一请求接口
-func (nc *NameCheap) request(result *NameCheapResp, ipAddr string, domain *ddns.Domain) (err error) {
+func (nc *NameCheap) request(ctx context.Context, result *NameCheapResp, ipAddr string, domain *ddns.Domain) (err error) {
 	var url string = Endpoint
 	url = strings.ReplaceAll(url, "#{host}", domain.GetSubDomain())
 	url = strings.ReplaceAll(url, "#{domain}", domain.DomainName)
 	url = strings.ReplaceAll(url, "#{password}", nc.DNS.Secret)
 	url = strings.ReplaceAll(url, "#{ip}", ipAddr)
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
 		url,
 		http.NoBody,
 	)
 
 	if err != nil {
-		nc.logger.Infof("http.NewRequest失败. Error: ", err)
+		nc.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
 	client := util.CreateHTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
-		nc.logger.Infof("client.Do失败. Error: ", err)
+		nc.logger.Infof("client.Do failed. Error: %s", err)
 		return
 	}
 
 	defer resp.Body.Close()
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		nc.logger.Infof("请求namecheap失败")
+		nc.logger.Infof("Failed to read Namecheap response. Error: %s", err)
 		return err
 	}
 
@@ -1,15 +1,17 @@
 package namesilo
 
 import (
+	"context"
 	"encoding/xml"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -20,6 +22,15 @@ const (
 	Code                         = "namesilo"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &NameSilo{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: false,
+	})
+}
+
 // NameSilo Domain
 type NameSilo struct {
 	DNS      *config.DNS
@@ -77,26 +88,23 @@ func (ns *NameSilo) Endpoint() string {
 }
 
 // Init 初始化
-func (ns *NameSilo) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	ns.Domains.Ipv4Cache = ipv4cache
-	ns.Domains.Ipv6Cache = ipv6cache
-	ns.Domains.Logger = log
-	ns.lastIpv4 = ipv4cache.GetAddr()
-	ns.lastIpv6 = ipv6cache.GetAddr()
+func (ns *NameSilo) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	ns.Domains = domains
+	ns.lastIpv4 = domains.Ipv4Cache.GetAddr()
+	ns.lastIpv6 = domains.Ipv6Cache.GetAddr()
 
 	ns.DNS = dnsConf.DNS
-	ns.Domains.GetNewIp(dnsConf)
 	ns.logger = log
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (ns *NameSilo) AddUpdateDomainRecords() ddns.Domains {
-	ns.addUpdateDomainRecords("A")
-	ns.addUpdateDomainRecords("AAAA")
+func (ns *NameSilo) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	ns.addUpdateDomainRecords(ctx, "A")
+	ns.addUpdateDomainRecords(ctx, "AAAA")
 	return ns.Domains
 }
 
-func (ns *NameSilo) addUpdateDomainRecords(recordType string) {
+func (ns *NameSilo) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := ns.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -104,70 +112,86 @@ func (ns *NameSilo) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
 		// 有可能有人填写@.example.com
 		if domain.SubDomain == "@" {
 			domain.SubDomain = ""
 		}
 		// 拿到DNS记录列表，从列表中去取对应域名的id，有id进行修改，没ID进行新增
-		records, err := ns.listRecords(domain)
+		records, err := ns.listRecords(ctx, domain)
 		if err != nil {
-			ns.logger.Infof("获取域名列表 %s 失败！", domain)
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			ns.logger.Infof("Failed to list records of %s! Err: %s", domain, err)
+			domain.Fail(ddns.ActionSkip, err, strconv.Itoa(records.Reply.Code), records.Reply.Detail)
+			continue
 		}
 		items := records.Reply.ResourceItems
 		record := findResourceRecord(items, recordType, domain.String())
 		var isAdd bool
-		var recordID string
+		var recordID, previous string
 		if record == nil {
 			isAdd = true
 		} else {
 			recordID = record.RecordID
+			previous = record.Value
 			if record.Value == ipAddr {
-				ns.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
-				return
+				ns.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+				domain.Noop(recordID)
+				continue
 			}
 		}
-		ns.modify(domain, recordID, recordType, ipAddr, isAdd)
+		ns.modify(ctx, domain, recordID, previous, recordType, ipAddr, isAdd)
 	}
 }
 
 // 修改
-func (ns *NameSilo) modify(domain *ddns.Domain, recordID, recordType, ipAddr string, isAdd bool) {
+func (ns *NameSilo) modify(ctx context.Context, domain *ddns.Domain, recordID, previous, recordType, ipAddr string, isAdd bool) {
 	var err error
 	var result string
-	var requestType string
+	action := ddns.ActionUpdate
+	if isAdd {
+		action = ddns.ActionCreate
+	}
+	if ns.Domains.DryRun {
+		ns.logger.Infof("Will %s record %s, IP: %s", action, domain, ipAddr)
+		domain.Plan(action, previous, recordID)
+		return
+	}
 	if isAdd {
-		requestType = "新增"
-		result, err = ns.request(ipAddr, domain, "", recordType, nameSiloAddRecordEndpoint)
+		result, err = ns.request(ctx, ipAddr, domain, "", recordType, nameSiloAddRecordEndpoint)
 	} else {
-		requestType = "修改"
-		result, err = ns.request(ipAddr, domain, recordID, "", nameSiloUpdateRecordEndpoint)
+		result, err = ns.request(ctx, ipAddr, domain, recordID, "", nameSiloUpdateRecordEndpoint)
 	}
 	if err != nil {
-		ns.logger.Infof("修改域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		ns.logger.Infof("Failed to %s record %s! Err: %s", action, domain, err)
+		domain.Fail(action, err, "", "")
 		return
 	}
 	var resp NameSiloResp
 	xml.Unmarshal([]byte(result), &resp)
 	if resp.Reply.Code == 300 {
-		ns.logger.Infof("%s 域名解析 %s 成功！IP: %s\n", requestType, domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		ns.logger.Infof("%s record %s successfully! IP: %s", action, domain, ipAddr)
+		if resp.Reply.RecordID != "" {
+			recordID = resp.Reply.RecordID
+		}
+		domain.Succeed(action, previous, recordID)
 	} else {
-		ns.logger.Infof("%s 域名解析 %s 失败！Deatil: %s\n", requestType, domain, resp.Reply.Detail)
-		domain.UpdateStatus = consts.UpdatedFailed
+		ns.logger.Infof("Failed to %s record %s! Detail: %s", action, domain, resp.Reply.Detail)
+		domain.Fail(action, nil, strconv.Itoa(resp.Reply.Code), resp.Reply.Detail)
 	}
 }
 
-func (ns *NameSilo) listRecords(domain *ddns.Domain) (resp NameSiloDNSListRecordResp, err error) {
-	result, err := ns.request("", domain, "", "", Endpoint)
+func (ns *NameSilo) listRecords(ctx context.Context, domain *ddns.Domain) (resp NameSiloDNSListRecordResp, err error) {
+	result, err := ns.request(ctx, "", domain, "", "", Endpoint)
+	if err != nil {
+		return
+	}
 	err = xml.Unmarshal([]byte(result), &resp)
 	return
 }
 
 // request 统一请求接口
-func (ns *NameSilo) request(ipAddr string, domain *ddns.Domain, recordID, recordType, url string) (result string, err error) {
+func (ns *NameSilo) request(ctx context.Context, ipAddr string, domain *ddns.Domain, recordID, recordType, url string) (result string, err error) {
 	if domain.SubDomain == "@" {
 		url = strings.ReplaceAll(url, "#{host}", "")
 	} else {
@@ -178,21 +202,22 @@ func (ns *NameSilo) request(ipAddr string, domain *ddns.Domain, recordID, record
 	url = strings.ReplaceAll(url, "#{recordID}", recordID)
 	url = strings.ReplaceAll(url, "#{recordType}", recordType)
 	url = strings.ReplaceAll(url, "#{ip}", ipAddr)
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
 		url,
 		http.NoBody,
 	)
 
 	if err != nil {
-		ns.logger.Infof("http.NewRequest失败. Error: ", err)
+		ns.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
 	client := util.CreateHTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
-		ns.logger.Infof("client.Do失败. Error: ", err)
+		ns.logger.Infof("client.Do failed. Error: %s", err)
 		return
 	}
 
@@ -2,14 +2,15 @@ package porkbun
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 )
 
@@ -18,6 +19,15 @@ const (
 	Code     string = "porkbun"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &Porkbun{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: false,
+	})
+}
+
 type Porkbun struct {
 	DNSConfig *config.DNS
 	Domains   ddns.Domains
@@ -33,7 +43,10 @@ type PorkbunDomainRecord struct {
 }
 
 type PorkbunResponse struct {
-	Status string `json:"status"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// 新增成功时返回的记录ID
+	ID json.Number `json:"id"`
 }
 
 type PorkbunDomainQueryResponse struct {
@@ -60,12 +73,9 @@ func (pb *Porkbun) Endpoint() string {
 }
 
 // Init 初始化
-func (pb *Porkbun) Init(conf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	pb.Domains.Ipv4Cache = ipv4cache
-	pb.Domains.Ipv6Cache = ipv6cache
-	pb.Domains.Logger = log
+func (pb *Porkbun) Init(conf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	pb.Domains = domains
 	pb.DNSConfig = conf.DNS
-	pb.Domains.GetNewIp(conf)
 	pb.logger = log
 	if conf.TTL == "" {
 		// 默认600s
@@ -76,13 +86,13 @@ func (pb *Porkbun) Init(conf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6c
 }
 
 // AddUpdateDomainRecords 添加或更新IPv4/IPv6记录
-func (pb *Porkbun) AddUpdateDomainRecords() ddns.Domains {
-	pb.addUpdateDomainRecords("A")
-	pb.addUpdateDomainRecords("AAAA")
+func (pb *Porkbun) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	pb.addUpdateDomainRecords(ctx, "A")
+	pb.addUpdateDomainRecords(ctx, "AAAA")
 	return pb.Domains
 }
 
-func (pb *Porkbun) addUpdateDomainRecords(recordType string) {
+func (pb *Porkbun) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := pb.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -90,9 +100,12 @@ func (pb *Porkbun) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
 		var record PorkbunDomainQueryResponse
 		// 获取当前域名信息
 		err := pb.request(
+			ctx,
 			Endpoint+fmt.Sprintf("/retrieveByNameType/%s/%s/%s", domain.DomainName, recordType, domain.SubDomain),
 			&PorkbunApiKey{
 				AccessKey: pb.DNSConfig.ID,
@@ -102,29 +115,36 @@ func (pb *Porkbun) addUpdateDomainRecords(recordType string) {
 		)
 
 		if err != nil {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			pb.logger.Infof("Failed to query records of %s! Err: %s", domain, err)
+			domain.Fail(ddns.ActionSkip, err, "", "")
+			continue
 		}
 		if record.Status == "SUCCESS" {
 			if len(record.Records) > 0 {
 				// 存在，更新
-				pb.modify(&record, domain, &recordType, &ipAddr)
+				pb.modify(ctx, &record, domain, &recordType, &ipAddr)
 			} else {
 				// 不存在，创建
-				pb.create(domain, &recordType, &ipAddr)
+				pb.create(ctx, domain, &recordType, &ipAddr)
 			}
 		} else {
-			pb.logger.Infof("查询现有域名记录失败")
-			domain.UpdateStatus = consts.UpdatedFailed
+			pb.logger.Infof("Failed to query records of %s! Status: %s", domain, record.Status)
+			domain.Fail(ddns.ActionSkip, nil, record.Status, record.Message)
 		}
 	}
 }
 
 // 创建
-func (pb *Porkbun) create(domain *ddns.Domain, recordType *string, ipAddr *string) {
+func (pb *Porkbun) create(ctx context.Context, domain *ddns.Domain, recordType *string, ipAddr *string) {
+	if pb.Domains.DryRun {
+		pb.logger.Infof("Will create record %s, IP: %s", domain, *ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
 	var response PorkbunResponse
 
 	err := pb.request(
+		ctx,
 		Endpoint+fmt.Sprintf("/create/%s", domain.DomainName),
 		&PorkbunDomainCreateOrUpdateVO{
 			PorkbunApiKey: &PorkbunApiKey{
@@ -142,26 +162,33 @@ func (pb *Porkbun) create(domain *ddns.Domain, recordType *string, ipAddr *strin
 	)
 
 	if err == nil && response.Status == "SUCCESS" {
-		pb.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, *ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		pb.logger.Infof("Created record %s successfully! IP: %s", domain, *ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", response.ID.String())
 	} else {
-		pb.logger.Infof("新增域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		pb.logger.Infof("Failed to create record %s! Status: %s, Message: %s", domain, response.Status, response.Message)
+		domain.Fail(ddns.ActionCreate, err, response.Status, response.Message)
 	}
 }
 
 // 修改
-func (pb *Porkbun) modify(record *PorkbunDomainQueryResponse, domain *ddns.Domain, recordType *string, ipAddr *string) {
+func (pb *Porkbun) modify(ctx context.Context, record *PorkbunDomainQueryResponse, domain *ddns.Domain, recordType *string, ipAddr *string) {
 
 	// 相同不修改
 	if len(record.Records) > 0 && *record.Records[0].Content == *ipAddr {
-		pb.logger.Infof("你的IP %s 没有变化, 域名 %s", *ipAddr, domain)
+		pb.logger.Infof("Your IP %s has not changed, domain %s", *ipAddr, domain)
+		domain.Noop("")
+		return
+	}
+	if pb.Domains.DryRun {
+		pb.logger.Infof("Will update record %s, IP: %s", domain, *ipAddr)
+		domain.Plan(ddns.ActionUpdate, *record.Records[0].Content, "")
 		return
 	}
 
 	var response PorkbunResponse
 
 	err := pb.request(
+		ctx,
 		Endpoint+fmt.Sprintf("/editByNameType/%s/%s/%s", domain.DomainName, *recordType, domain.SubDomain),
 		&PorkbunDomainCreateOrUpdateVO{
 			PorkbunApiKey: &PorkbunApiKey{
@@ -177,27 +204,28 @@ func (pb *Porkbun) modify(record *PorkbunDomainQueryResponse, domain *ddns.Domai
 	)
 
 	if err == nil && response.Status == "SUCCESS" {
-		pb.logger.Infof("更新域名解析 %s 成功！IP: %s", domain, *ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		pb.logger.Infof("Updated record %s successfully! IP: %s", domain, *ipAddr)
+		domain.Succeed(ddns.ActionUpdate, *record.Records[0].Content, "")
 	} else {
-		pb.logger.Infof("更新域名解析 %s 失败！", domain)
-		domain.UpdateStatus = consts.UpdatedFailed
+		pb.logger.Infof("Failed to update record %s! Status: %s, Message: %s", domain, response.Status, response.Message)
+		domain.Fail(ddns.ActionUpdate, err, response.Status, response.Message)
 	}
 }
 
 // request 统一请求接口
-func (pb *Porkbun) request(url string, data interface{}, result interface{}) (err error) {
+func (pb *Porkbun) request(ctx context.Context, url string, data interface{}, result interface{}) (err error) {
 	jsonStr := make([]byte, 0)
 	if data != nil {
 		jsonStr, _ = json.Marshal(data)
 	}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		url,
 		bytes.NewBuffer(jsonStr),
 	)
 	if err != nil {
-		pb.logger.Infof("http.NewRequest失败. Error: ", err)
+		pb.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
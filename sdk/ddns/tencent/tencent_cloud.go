@@ -2,13 +2,14 @@ package tencent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/jxo-me/ddns/config"
-	"github.com/jxo-me/ddns/consts"
-	"github.com/jxo-me/ddns/core/cache"
+	iDDNS "github.com/jxo-me/ddns/core/ddns"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/registry"
 	"net/http"
 	"strconv"
 )
@@ -19,6 +20,15 @@ const (
 	Code                = "tencent"
 )
 
+func init() {
+	registry.MustRegisterProvider(Code, func() iDDNS.IDDNS { return &TencentCloud{} }, iDDNS.Capabilities{
+		IPv4:         true,
+		IPv6:         true,
+		ReadRecords:  true,
+		CustomParams: true,
+	})
+}
+
 // TencentCloud 腾讯云 DNSPod API 3.0 实现
 // https://cloud.tencent.com/document/api/1427/56193
 type TencentCloud struct {
@@ -54,6 +64,22 @@ type TencentCloudRecordListsResp struct {
 		} `json:"RecordCountInfo"`
 
 		RecordList []TencentCloudRecord `json:"RecordList"`
+
+		Error struct {
+			Code    string
+			Message string
+		}
+	}
+}
+
+// TencentCloudCreateResp 添加记录返回结果
+type TencentCloudCreateResp struct {
+	Response struct {
+		RecordId int
+		Error    struct {
+			Code    string
+			Message string
+		}
 	}
 }
 
@@ -76,12 +102,9 @@ func (tc *TencentCloud) Endpoint() string {
 	return Endpoint
 }
 
-func (tc *TencentCloud) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCache, ipv6cache cache.IIpCache, log logger.ILogger) {
-	tc.Domains.Ipv4Cache = ipv4cache
-	tc.Domains.Ipv6Cache = ipv6cache
-	tc.Domains.Logger = log
+func (tc *TencentCloud) Init(dnsConf *config.DDnsConfig, domains ddns.Domains, log logger.ILogger) {
+	tc.Domains = domains
 	tc.DNS = dnsConf.DNS
-	tc.Domains.GetNewIp(dnsConf)
 	tc.logger = log
 	if dnsConf.TTL == "" {
 		// 默认 600s
@@ -97,13 +120,13 @@ func (tc *TencentCloud) Init(dnsConf *config.DDnsConfig, ipv4cache cache.IIpCach
 }
 
 // AddUpdateDomainRecords 添加或更新 IPv4/IPv6 记录
-func (tc *TencentCloud) AddUpdateDomainRecords() ddns.Domains {
-	tc.addUpdateDomainRecords("A")
-	tc.addUpdateDomainRecords("AAAA")
+func (tc *TencentCloud) AddUpdateDomainRecords(ctx context.Context) ddns.Domains {
+	tc.addUpdateDomainRecords(ctx, "A")
+	tc.addUpdateDomainRecords(ctx, "AAAA")
 	return tc.Domains
 }
 
-func (tc *TencentCloud) addUpdateDomainRecords(recordType string) {
+func (tc *TencentCloud) addUpdateDomainRecords(ctx context.Context, recordType string) {
 	ipAddr, domains := tc.Domains.GetNewIpResult(recordType)
 
 	if ipAddr == "" {
@@ -111,10 +134,13 @@ func (tc *TencentCloud) addUpdateDomainRecords(recordType string) {
 	}
 
 	for _, domain := range domains {
-		result, err := tc.getRecordList(domain, recordType)
+		ipAddr := domain.Addr(ipAddr)
+		domain.Begin(recordType, ipAddr)
+		result, err := tc.getRecordList(ctx, domain, recordType)
 		if err != nil {
-			domain.UpdateStatus = consts.UpdatedFailed
-			return
+			tc.logger.Infof("Failed to list records of %s! Code: %s, Message: %s", domain, result.Response.Error.Code, result.Response.Error.Message)
+			domain.Fail(ddns.ActionSkip, err, result.Response.Error.Code, result.Response.Error.Message)
+			continue
 		}
 
 		if result.Response.RecordCountInfo.TotalCount > 0 {
@@ -130,17 +156,22 @@ func (tc *TencentCloud) addUpdateDomainRecords(recordType string) {
 			}
 
 			// 修改记录
-			tc.modify(recordSelected, domain, recordType, ipAddr)
+			tc.modify(ctx, recordSelected, domain, recordType, ipAddr)
 		} else {
 			// 添加记录
-			tc.create(domain, recordType, ipAddr)
+			tc.create(ctx, domain, recordType, ipAddr)
 		}
 	}
 }
 
 // create 添加记录
 // CreateRecord https://cloud.tencent.com/document/api/1427/56180
-func (tc *TencentCloud) create(domain *ddns.Domain, recordType string, ipAddr string) {
+func (tc *TencentCloud) create(ctx context.Context, domain *ddns.Domain, recordType string, ipAddr string) {
+	if tc.Domains.DryRun {
+		tc.logger.Infof("Will create record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionCreate, "", "")
+		return
+	}
 	record := &TencentCloudRecord{
 		Domain:     domain.DomainName,
 		SubDomain:  domain.GetSubDomain(),
@@ -150,30 +181,38 @@ func (tc *TencentCloud) create(domain *ddns.Domain, recordType string, ipAddr st
 		TTL:        tc.TTL,
 	}
 
-	var status TencentCloudStatus
+	var status TencentCloudCreateResp
 	err := tc.request(
+		ctx,
 		"CreateRecord",
 		record,
 		&status,
 	)
 	if err == nil && status.Response.Error.Code == "" {
-		tc.logger.Infof("新增域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		tc.logger.Infof("Created record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionCreate, "", strconv.Itoa(status.Response.RecordId))
 	} else {
-		tc.logger.Infof("新增域名解析 %s 失败！Code: %s, Message: %s", domain, status.Response.Error.Code, status.Response.Error.Message)
-		domain.UpdateStatus = consts.UpdatedFailed
+		tc.logger.Infof("Failed to create record %s! Code: %s, Message: %s", domain, status.Response.Error.Code, status.Response.Error.Message)
+		domain.Fail(ddns.ActionCreate, err, status.Response.Error.Code, status.Response.Error.Message)
 	}
 }
 
 // modify 修改记录
 // ModifyRecord https://cloud.tencent.com/document/api/1427/56157
-func (tc *TencentCloud) modify(record TencentCloudRecord, domain *ddns.Domain, recordType string, ipAddr string) {
+func (tc *TencentCloud) modify(ctx context.Context, record TencentCloudRecord, domain *ddns.Domain, recordType string, ipAddr string) {
 	// 相同不修改
 	if record.Value == ipAddr {
-		tc.logger.Infof("你的IP %s 没有变化, 域名 %s", ipAddr, domain)
+		tc.logger.Infof("Your IP %s has not changed, domain %s", ipAddr, domain)
+		domain.Noop(strconv.Itoa(record.RecordId))
+		return
+	}
+	if tc.Domains.DryRun {
+		tc.logger.Infof("Will update record %s, IP: %s", domain, ipAddr)
+		domain.Plan(ddns.ActionUpdate, record.Value, strconv.Itoa(record.RecordId))
 		return
 	}
 	var status TencentCloudStatus
+	previous := record.Value
 	record.Domain = domain.DomainName
 	record.SubDomain = domain.GetSubDomain()
 	record.RecordType = recordType
@@ -181,22 +220,23 @@ func (tc *TencentCloud) modify(record TencentCloudRecord, domain *ddns.Domain, r
 	record.Value = ipAddr
 	record.TTL = tc.TTL
 	err := tc.request(
+		ctx,
 		"ModifyRecord",
 		record,
 		&status,
 	)
 	if err == nil && status.Response.Error.Code == "" {
-		tc.logger.Infof("更新域名解析 %s 成功！IP: %s", domain, ipAddr)
-		domain.UpdateStatus = consts.UpdatedSuccess
+		tc.logger.Infof("Updated record %s successfully! IP: %s", domain, ipAddr)
+		domain.Succeed(ddns.ActionUpdate, previous, strconv.Itoa(record.RecordId))
 	} else {
-		tc.logger.Infof("更新域名解析 %s 失败！Code: %s, Message: %s", domain, status.Response.Error.Code, status.Response.Error.Message)
-		domain.UpdateStatus = consts.UpdatedFailed
+		tc.logger.Infof("Failed to update record %s! Code: %s, Message: %s", domain, status.Response.Error.Code, status.Response.Error.Message)
+		domain.Fail(ddns.ActionUpdate, err, status.Response.Error.Code, status.Response.Error.Message)
 	}
 }
 
 // getRecordList 获取域名的解析记录列表
 // DescribeRecordList https://cloud.tencent.com/document/api/1427/56166
-func (tc *TencentCloud) getRecordList(domain *ddns.Domain, recordType string) (result TencentCloudRecordListsResp, err error) {
+func (tc *TencentCloud) getRecordList(ctx context.Context, domain *ddns.Domain, recordType string) (result TencentCloudRecordListsResp, err error) {
 	record := TencentCloudRecord{
 		Domain:     domain.DomainName,
 		Subdomain:  domain.GetSubDomain(),
@@ -204,6 +244,7 @@ func (tc *TencentCloud) getRecordList(domain *ddns.Domain, recordType string) (r
 		RecordLine: tc.getRecordLine(domain),
 	}
 	err = tc.request(
+		ctx,
 		"DescribeRecordList",
 		record,
 		&result,
@@ -221,18 +262,19 @@ func (tc *TencentCloud) getRecordLine(domain *ddns.Domain) string {
 }
 
 // request 统一请求接口
-func (tc *TencentCloud) request(action string, data interface{}, result interface{}) (err error) {
+func (tc *TencentCloud) request(ctx context.Context, action string, data interface{}, result interface{}) (err error) {
 	jsonStr := make([]byte, 0)
 	if data != nil {
 		jsonStr, _ = json.Marshal(data)
 	}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		Endpoint,
 		bytes.NewBuffer(jsonStr),
 	)
 	if err != nil {
-		tc.logger.Infof("http.NewRequest 失败. Error: ", err)
+		tc.logger.Infof("http.NewRequest failed. Error: %s", err)
 		return
 	}
 
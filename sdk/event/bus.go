@@ -0,0 +1,179 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"github.com/jxo-me/ddns/core/event"
+	"github.com/jxo-me/ddns/core/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultQueueSize 每个订阅者最多缓存的事件数, 超出后丢弃新的事件
+	DefaultQueueSize = 64
+	// DefaultDrainTimeout 关闭时等待订阅者处理已发布事件的时间, 之后取消订阅者的 ctx
+	DefaultDrainTimeout = 5 * time.Second
+)
+
+var (
+	ErrDupSubscriber = errors.New("event: duplicate subscriber")
+	ErrBusClosed     = errors.New("event: bus closed")
+)
+
+type subscriber struct {
+	name    string
+	types   map[event.Type]bool
+	handler event.Handler
+	queue   chan *event.Event
+	done    chan struct{}
+}
+
+func (s *subscriber) accepts(t event.Type) bool {
+	return len(s.types) == 0 || s.types[t]
+}
+
+// Bus 事件总线, 每个订阅者有自己的队列和 goroutine
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[string]*subscriber
+	closed      bool
+	queueSize   int
+	// DrainTimeout 关闭时等待订阅者处理已发布事件的时间, 超时后取消 ctx, 进行中的请求立即返回
+	DrainTimeout time.Duration
+	ctx          context.Context
+	cancel       context.CancelFunc
+	logger       logger.ILogger
+}
+
+// NewBus 创建事件总线, log 为空时使用默认日志
+func NewBus(queueSize int, log logger.ILogger) *Bus {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bus{
+		subscribers:  make(map[string]*subscriber),
+		queueSize:    queueSize,
+		DrainTimeout: DefaultDrainTimeout,
+		ctx:          ctx,
+		cancel:       cancel,
+		logger:       log,
+	}
+}
+
+func (b *Bus) log() logger.ILogger {
+	if b.logger != nil {
+		return b.logger
+	}
+	return logger.Default()
+}
+
+// Publish 发布事件, 订阅者的队列已满时丢弃该事件
+func (b *Bus) Publish(e *event.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, s := range b.subscribers {
+		if !s.accepts(e.Type) {
+			continue
+		}
+		select {
+		case s.queue <- e:
+		default:
+			b.log().Warnf("Event subscriber %s is too slow, %s event of service %s dropped", s.name, e.Type, e.Service)
+		}
+	}
+}
+
+// Subscribe 订阅事件, types 为空时订阅所有类型
+func (b *Bus) Subscribe(name string, handler event.Handler, types ...event.Type) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBusClosed
+	}
+	if _, ok := b.subscribers[name]; ok {
+		return ErrDupSubscriber
+	}
+	s := &subscriber{
+		name:    name,
+		types:   make(map[event.Type]bool),
+		handler: handler,
+		queue:   make(chan *event.Event, b.queueSize),
+		done:    make(chan struct{}),
+	}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	b.subscribers[name] = s
+	go b.run(s)
+	return nil
+}
+
+// Unsubscribe 取消订阅, 已在队列中的事件仍会被处理
+func (b *Bus) Unsubscribe(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.subscribers[name]; ok {
+		delete(b.subscribers, name)
+		close(s.queue)
+	}
+}
+
+// Close 不再接收新事件, 等待订阅者处理完已发布的事件
+// 超过 DrainTimeout 时取消订阅者的 ctx, 慢的订阅者不会阻塞关闭
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	subscribers := make([]*subscriber, 0, len(b.subscribers))
+	for name, s := range b.subscribers {
+		delete(b.subscribers, name)
+		close(s.queue)
+		subscribers = append(subscribers, s)
+	}
+	b.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		for _, s := range subscribers {
+			<-s.done
+		}
+		close(drained)
+	}()
+	timer := time.NewTimer(b.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		b.log().Warnf("Event subscribers did not finish in %s, cancelling", b.DrainTimeout)
+	}
+	b.cancel()
+	<-drained
+}
+
+func (b *Bus) run(s *subscriber) {
+	defer close(s.done)
+	for e := range s.queue {
+		b.handle(s, e)
+	}
+}
+
+// handle 处理单个事件, 订阅者的 panic 不影响其它订阅者
+func (b *Bus) handle(s *subscriber, e *event.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log().Errorf("Event subscriber %s panic on %s event: %v", s.name, e.Type, r)
+		}
+	}()
+	s.handler(b.ctx, e)
+}
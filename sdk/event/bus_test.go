@@ -0,0 +1,97 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/core/event"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// TestBusIsolation 测试慢的订阅者不阻塞发布者和其它订阅者
+func TestBusIsolation(t *testing.T) {
+	bus := NewBus(8, xlogger.Nop())
+	block := make(chan struct{})
+	var slow, fast, panicked int32
+	_ = bus.Subscribe("slow", func(ctx context.Context, e *event.Event) {
+		<-block
+		atomic.AddInt32(&slow, 1)
+	})
+	_ = bus.Subscribe("fast", func(ctx context.Context, e *event.Event) {
+		atomic.AddInt32(&fast, 1)
+	}, event.RecordUpdated)
+	_ = bus.Subscribe("panic", func(ctx context.Context, e *event.Event) {
+		atomic.AddInt32(&panicked, 1)
+		panic("boom")
+	}, event.RecordUpdated)
+	if err := bus.Subscribe("fast", nil); !errors.Is(err, ErrDupSubscriber) {
+		t.Errorf("重复订阅应返回 ErrDupSubscriber，得到 %v", err)
+	}
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			bus.Publish(&event.Event{Type: event.RecordUpdated})
+		}
+		// 只有 slow 订阅, 超出队列长度
+		for i := 0; i < 20; i++ {
+			bus.Publish(&event.Event{Type: event.RecordCreated})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("发布被慢的订阅者阻塞")
+	}
+
+	close(block)
+	bus.Close()
+	if fast != 5 {
+		t.Errorf("期待 fast 收到 5 个事件，得到 %d", fast)
+	}
+	if panicked != 5 {
+		t.Errorf("panic 后应继续处理，期待 5，得到 %d", panicked)
+	}
+	// 阻塞期间超出队列长度的事件被丢弃
+	if slow == 0 || slow >= 25 {
+		t.Errorf("期待 slow 丢弃部分事件，得到 %d", slow)
+	}
+
+	bus.Publish(&event.Event{Type: event.RecordUpdated})
+	if err := bus.Subscribe("late", nil); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("关闭后订阅应返回 ErrBusClosed，得到 %v", err)
+	}
+}
+
+// TestBusCloseTimeout 测试订阅者阻塞时 Close 超时后取消 ctx 并返回
+func TestBusCloseTimeout(t *testing.T) {
+	bus := NewBus(8, xlogger.Nop())
+	bus.DrainTimeout = 50 * time.Millisecond
+	started := make(chan struct{})
+	var cancelled int32
+	_ = bus.Subscribe("blocking", func(ctx context.Context, e *event.Event) {
+		close(started)
+		<-ctx.Done()
+		atomic.AddInt32(&cancelled, 1)
+	})
+	bus.Publish(&event.Event{Type: event.RunCompleted})
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("订阅者阻塞时 Close 没有及时返回")
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("Close 超时后应取消订阅者的 ctx")
+	}
+}
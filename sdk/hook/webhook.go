@@ -1,14 +1,18 @@
 package hook
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/jxo-me/ddns/consts"
+	"github.com/jxo-me/ddns/core/event"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
 	"github.com/jxo-me/ddns/core/logger"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/ddns"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -42,89 +46,132 @@ func (w *Webhook) String() string {
 	return Code
 }
 
-// ExecHook 添加或更新IPv4/IPv6记录, 返回是否有更新失败的
-func (w *Webhook) ExecHook(domains *ddns.Domains) (v4Status consts.UpdateStatusType, v6Status consts.UpdateStatusType) {
-	v4Status = w.getDomainsStatus(domains.Ipv4Domains)
-	v6Status = w.getDomainsStatus(domains.Ipv6Domains)
-
-	if w.WebhookURL != "" && (v4Status != consts.UpdatedNothing || v6Status != consts.UpdatedNothing) {
-		// 成功和失败都要触发webhook
-		method := "GET"
-		postPara := ""
-		contentType := "application/x-www-form-urlencoded"
-		if w.WebhookRequestBody != "" {
-			method = "POST"
-			postPara = w.replacePara(domains, w.WebhookRequestBody, v4Status, v6Status)
-			if json.Valid([]byte(postPara)) {
-				contentType = "application/json"
-				// 如果 RequestBody 的 JSON 无效但前缀为 JSON 括号则为 JSON
-			} else if hasJSONPrefix(postPara) {
-				w.logger.Infof("RequestBody 的 JSON 无效！")
-			}
-		}
-		requestURL := w.replacePara(domains, w.WebhookURL, v4Status, v6Status)
-		u, err := url.Parse(requestURL)
-		if err != nil {
-			w.logger.Infof("Webhook配置中的URL不正确")
+// Subscribe 订阅服务的 RunCompleted、BackoffEntered 和 Recovered 事件
+// 每次运行完成后触发 webhook, 进入退避和恢复时各触发一次
+func (w *Webhook) Subscribe(bus event.IBus, service string) error {
+	return bus.Subscribe(Code+":"+service, func(ctx context.Context, e *event.Event) {
+		if e.Service != service {
 			return
 		}
-		req, err := http.NewRequest(method, fmt.Sprintf("%s://%s%s?%s", u.Scheme, u.Host, u.Path, u.Query().Encode()), strings.NewReader(postPara))
-		if err != nil {
-			w.logger.Infof("创建Webhook请求异常, Err:", err)
-			return
+		switch e.Type {
+		case event.RunCompleted:
+			if e.Domains != nil {
+				w.ExecHook(ctx, e.Domains)
+			}
+		default:
+			w.ExecEvent(ctx, e)
 		}
+	}, event.RunCompleted, event.BackoffEntered, event.Recovered)
+}
 
-		headers := w.CheckParseHeaders(w.WebhookHeaders)
-		for key, value := range headers {
-			req.Header.Add(key, value)
-		}
-		req.Header.Add("content-type", contentType)
-
-		clt := util.CreateHTTPClient()
-		resp, err := clt.Do(req)
-		body, err := util.GetHTTPResponseOrg(resp, requestURL, err)
-		if err == nil {
-			w.logger.Infof("Webhook调用成功, 返回数据: %q\n", string(body))
-		} else {
-			w.logger.Infof("Webhook调用失败，Err：%s\n", err)
-		}
+// ExecHook 添加或更新IPv4/IPv6记录, 返回是否有更新失败的
+func (w *Webhook) ExecHook(ctx context.Context, domains *ddns.Domains) (v4Status consts.UpdateStatusType, v6Status consts.UpdateStatusType) {
+	v4Status = ddns.DomainsStatus(domains.Ipv4Domains)
+	v6Status = ddns.DomainsStatus(domains.Ipv6Domains)
+
+	if w.WebhookURL != "" && (v4Status != consts.UpdatedNothing || v6Status != consts.UpdatedNothing) {
+		// 成功和失败都要触发webhook
+		w.send(ctx, &event.Event{Type: event.RunCompleted}, domains, v4Status, v6Status)
 	}
 	return
 }
 
-// getDomainsStatus 获取域名状态
-func (w *Webhook) getDomainsStatus(domains []*ddns.Domain) consts.UpdateStatusType {
-	successNum := 0
-	for _, v46 := range domains {
-		switch v46.UpdateStatus {
-		case consts.UpdatedFailed:
-			// 一个失败，全部失败
-			return consts.UpdatedFailed
-		case consts.UpdatedSuccess:
-			successNum++
+// ExecEvent 进入退避或恢复时触发 webhook, 不论更新结果; Domains 为触发该事件的那次运行
+func (w *Webhook) ExecEvent(ctx context.Context, e *event.Event) {
+	if w.WebhookURL == "" {
+		return
+	}
+	domains := e.Domains
+	if domains == nil {
+		domains = &ddns.Domains{}
+	}
+	w.send(ctx, e, domains, ddns.DomainsStatus(domains.Ipv4Domains), ddns.DomainsStatus(domains.Ipv6Domains))
+}
+
+// send 替换参数并请求 webhook
+func (w *Webhook) send(ctx context.Context, e *event.Event, domains *ddns.Domains, v4Status consts.UpdateStatusType, v6Status consts.UpdateStatusType) {
+	method := "GET"
+	postPara := ""
+	contentType := "application/x-www-form-urlencoded"
+	if w.WebhookRequestBody != "" {
+		method = "POST"
+		postPara = w.replaceEvent(w.replacePara(domains, w.WebhookRequestBody, v4Status, v6Status), e)
+		if json.Valid([]byte(postPara)) {
+			contentType = "application/json"
+			// 如果 RequestBody 的 JSON 无效但前缀为 JSON 括号则为 JSON
+		} else if hasJSONPrefix(postPara) {
+			w.logger.Infof("The JSON of RequestBody is invalid!")
 		}
 	}
+	requestURL := w.replaceEvent(w.replacePara(domains, w.WebhookURL, v4Status, v6Status), e)
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		w.logger.Infof("The URL in the webhook configuration is incorrect! Err: %s", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s://%s%s?%s", u.Scheme, u.Host, u.Path, u.Query().Encode()), strings.NewReader(postPara))
+	if err != nil {
+		w.logger.Infof("Failed to create webhook request! Err: %s", err)
+		return
+	}
 
-	if successNum > 0 {
-		// 迭代完成后一个成功，就成功
-		return consts.UpdatedSuccess
+	headers := w.CheckParseHeaders(w.WebhookHeaders)
+	for key, value := range headers {
+		req.Header.Add(key, value)
+	}
+	req.Header.Add("content-type", contentType)
+
+	clt := util.CreateHTTPClient()
+	resp, err := clt.Do(req)
+	body, err := util.GetHTTPResponseOrg(resp, requestURL, err)
+	if err == nil {
+		w.logger.Infof("Webhook called successfully, response: %q", string(body))
+	} else {
+		w.logger.Infof("Webhook call failed! Err: %s", err)
+	}
+}
+
+// replaceEvent 替换事件参数, #{failures}/#{retry} 只用于 BackoffEntered 和 Recovered
+func (w *Webhook) replaceEvent(orgPara string, e *event.Event) string {
+	var failures, retry string
+	if e.Failures > 0 {
+		failures = strconv.Itoa(e.Failures)
+	}
+	if e.Retry > 0 {
+		retry = e.Retry.String()
 	}
-	return consts.UpdatedNothing
+	orgPara = strings.ReplaceAll(orgPara, "#{event}", string(e.Type))
+	orgPara = strings.ReplaceAll(orgPara, "#{policy}", e.Policy)
+	orgPara = strings.ReplaceAll(orgPara, "#{failures}", failures)
+	orgPara = strings.ReplaceAll(orgPara, "#{retry}", retry)
+	return orgPara
 }
 
 // replacePara 替换参数
 func (w *Webhook) replacePara(domains *ddns.Domains, orgPara string, ipv4Result consts.UpdateStatusType, ipv6Result consts.UpdateStatusType) (newPara string) {
 	orgPara = strings.ReplaceAll(orgPara, "#{ipv4Addr}", domains.Ipv4Addr)
+	orgPara = strings.ReplaceAll(orgPara, "#{ipv4Source}", detectionSource(domains.Ipv4Detection))
 	orgPara = strings.ReplaceAll(orgPara, "#{ipv4Result}", string(ipv4Result))
 	orgPara = strings.ReplaceAll(orgPara, "#{ipv4Domains}", w.getDomainsStr(domains.Ipv4Domains))
+	orgPara = strings.ReplaceAll(orgPara, "#{ipv4Results}", w.getResultsStr(domains.Ipv4Domains))
 
 	orgPara = strings.ReplaceAll(orgPara, "#{ipv6Addr}", domains.Ipv6Addr)
+	orgPara = strings.ReplaceAll(orgPara, "#{ipv6Source}", detectionSource(domains.Ipv6Detection))
 	orgPara = strings.ReplaceAll(orgPara, "#{ipv6Result}", string(ipv6Result))
 	orgPara = strings.ReplaceAll(orgPara, "#{ipv6Domains}", w.getDomainsStr(domains.Ipv6Domains))
+	orgPara = strings.ReplaceAll(orgPara, "#{ipv6Results}", w.getResultsStr(domains.Ipv6Domains))
 
 	return orgPara
 }
 
+// detectionSource 获得地址的来源, 未获取到时为空
+func detectionSource(detection *iIPSource.Result) string {
+	if detection == nil || detection.Addr == "" {
+		return ""
+	}
+	return detection.Source
+}
+
 // getDomainsStr 用逗号分割域名
 func (w *Webhook) getDomainsStr(domains []*ddns.Domain) string {
 	str := ""
@@ -138,6 +185,18 @@ func (w *Webhook) getDomainsStr(domains []*ddns.Domain) string {
 	return str
 }
 
+// getResultsStr 域名更新结果的JSON数组
+func (w *Webhook) getResultsStr(domains []*ddns.Domain) string {
+	results := make([]*ddns.UpdateResult, 0, len(domains))
+	for _, v46 := range domains {
+		if v46.Result != nil {
+			results = append(results, v46.Result)
+		}
+	}
+	b, _ := json.Marshal(results)
+	return string(b)
+}
+
 func (w *Webhook) CheckParseHeaders(headerStr string) (headers map[string]string) {
 	headers = make(map[string]string)
 	headerArr := strings.Split(headerStr, "\r\n")
@@ -146,7 +205,7 @@ func (w *Webhook) CheckParseHeaders(headerStr string) (headers map[string]string
 		if headerStr != "" {
 			parts := strings.Split(headerStr, ":")
 			if len(parts) != 2 {
-				w.logger.Infof(headerStr, "Header不正确")
+				w.logger.Infof("Header %s is incorrect", headerStr)
 				continue
 			}
 			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
@@ -2,17 +2,62 @@ package hook
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/core/event"
+	xevent "github.com/jxo-me/ddns/sdk/event"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
 )
 
 // TestParseHeaderArr 测试 parseHeaderArr
 func TestParseHeaderArr(t *testing.T) {
 	headers := "a : 1\r\nb:2\r\n"
 	expected := `map[a:1 b:2]`
-	obj := NewHook("", "", "")
+	obj := NewHook("", "", "", xlogger.Nop())
 	parsedHeaders := obj.CheckParseHeaders(headers)
 	resultStr := fmt.Sprintf("%v", parsedHeaders)
 	if resultStr != expected {
 		t.Error("解析Header失败", resultStr)
 	}
 }
+
+// TestSubscribeBackoff 测试进入退避和恢复时触发 webhook
+func TestSubscribeBackoff(t *testing.T) {
+	received := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	bus := xevent.NewBus(8, xlogger.Nop())
+	defer bus.Close()
+	hook := NewHook(srv.URL+"?event=#{event}&policy=#{policy}&failures=#{failures}&retry=#{retry}", "", "", xlogger.Nop())
+	if err := hook.Subscribe(bus, "test"); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(&event.Event{Type: event.BackoffEntered, Service: "test", Policy: "provider", Failures: 3, Retry: time.Minute})
+	bus.Publish(&event.Event{Type: event.Recovered, Service: "test", Policy: "provider", Failures: 5})
+	bus.Publish(&event.Event{Type: event.Recovered, Service: "other", Policy: "provider", Failures: 1})
+
+	for _, expected := range []string{
+		"event=BackoffEntered&failures=3&policy=provider&retry=1m0s",
+		"event=Recovered&failures=5&policy=provider&retry=",
+	} {
+		select {
+		case query := <-received:
+			if query != expected {
+				t.Errorf("期待 %s，得到 %s", expected, query)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("没有触发 webhook：%s", expected)
+		}
+	}
+	select {
+	case query := <-received:
+		t.Errorf("其它服务的事件不应触发 webhook，得到 %s", query)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,100 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"strings"
+	"time"
+)
+
+// DefaultChainTimeout 依次尝试时每个方式的超时
+const DefaultChainTimeout = 30 * time.Second
+
+var (
+	ErrAllSourcesFailed = errors.New("all ip sources failed")
+)
+
+// Chain 按顺序尝试多个获取IP的方式, 第一个得到有效地址的为结果
+type Chain struct {
+	sources []ChainSource
+	logger  logger.ILogger
+}
+
+// ChainSource Chain 中的一个方式, Timeout 为该方式单独的超时
+type ChainSource struct {
+	iIPSource.IIPSource
+	Timeout time.Duration
+}
+
+// NewChain 创建, 方式没有设置超时时使用 timeout, timeout 为 0 时使用 DefaultChainTimeout
+func NewChain(sources []ChainSource, timeout time.Duration, log logger.ILogger) *Chain {
+	if timeout <= 0 {
+		timeout = DefaultChainTimeout
+	}
+	c := &Chain{sources: make([]ChainSource, len(sources)), logger: log}
+	for i, source := range sources {
+		if source.Timeout <= 0 {
+			source.Timeout = timeout
+		}
+		c.sources[i] = source
+	}
+	return c
+}
+
+func (c *Chain) String() string {
+	names := make([]string, len(c.sources))
+	for i, source := range c.sources {
+		names[i] = source.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// GetAddr 依次获取, 返回第一个得到地址的方式的结果, Source 即为该方式
+// Details 的 fallback 记录之前失败的方式及原因
+func (c *Chain) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	var failed []string
+	for _, source := range c.sources {
+		sourceCtx, cancel := context.WithTimeout(ctx, source.Timeout)
+		result, err := source.GetAddr(sourceCtx)
+		cancel()
+		if err == nil && result != nil && result.Addr != "" {
+			if len(failed) > 0 {
+				if result.Details == nil {
+					result.Details = make(map[string]string)
+				}
+				result.Details["fallback"] = strings.Join(failed, "; ")
+				c.logger.Infof("Got %s from %s after %d ip sources failed", result.Addr, source, len(failed))
+			}
+			return result, nil
+		}
+		if err == nil {
+			err = ErrAddrNotFound
+		}
+		c.logger.Debugf("Failed to get address from %s, trying the next ip source: %s", source, err)
+		failed = append(failed, fmt.Sprintf("%s: %s", source, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return &iIPSource.Result{
+		Source:  c.String(),
+		Details: map[string]string{"fallback": strings.Join(failed, "; ")},
+	}, fmt.Errorf("%w: %s", ErrAllSourcesFailed, strings.Join(failed, "; "))
+}
+
+// Watch 监听所有支持的方式的地址变化
+func (c *Chain) Watch(ctx context.Context) (<-chan struct{}, error) {
+	var chans []<-chan struct{}
+	for _, source := range c.sources {
+		if changes, err := Watch(ctx, source.IIPSource); err == nil {
+			chans = append(chans, changes)
+		}
+	}
+	if len(chans) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrWatchNotSupported, c)
+	}
+	return Merge(ctx, chans...), nil
+}
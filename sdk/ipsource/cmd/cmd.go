@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/internal/util"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	Type = "cmd"
+	// DefaultTimeout 命令的超时
+	DefaultTimeout = 30 * time.Second
+)
+
+var (
+	ErrCmdNotConfigured = errors.New("cmd not configured")
+	ErrExitStatus       = errors.New("command exited with non-zero status")
+	ErrTimeout          = errors.New("command timed out")
+)
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// Cmd 执行命令, 从标准输出中获取地址
+type Cmd struct {
+	family iIPSource.Family
+	// argv 执行的程序及参数
+	argv    []string
+	env     []string
+	dir     string
+	timeout time.Duration
+	parse   parser
+	logger  logger.ILogger
+}
+
+// New 创建, CmdOptions 为空时使用默认的 shell 执行 Cmd 并查找第一个地址
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	opts := conf.CmdOptions
+	if opts == nil {
+		opts = &config.CmdOptions{}
+	}
+	c := &Cmd{
+		family:  family,
+		argv:    opts.Args,
+		env:     opts.Env,
+		dir:     opts.Dir,
+		timeout: DefaultTimeout,
+		logger:  log,
+	}
+	if len(c.argv) == 0 {
+		if conf.Cmd == "" {
+			return nil, ErrCmdNotConfigured
+		}
+		c.argv = shellCommand(opts.Shell, conf.Cmd)
+	}
+	if opts.Timeout > 0 {
+		c.timeout = time.Duration(opts.Timeout) * time.Second
+	}
+	var err error
+	if c.parse, err = newParser(opts.Parse); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// shellCommand 使用 shell 执行命令, 未指定时 Windows 为 powershell, 其它系统为 bash, 没有时为 sh
+func shellCommand(shell string, command string) []string {
+	if shell == "" {
+		switch {
+		case runtime.GOOS == "windows":
+			shell = "powershell"
+		default:
+			// If Bash does not exist, use sh
+			shell = "bash"
+			if _, err := exec.LookPath(shell); err != nil {
+				shell = "sh"
+			}
+		}
+	}
+	switch strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe") {
+	case "powershell", "pwsh":
+		return []string{shell, "-NoProfile", "-Command", command}
+	case "cmd":
+		return []string{shell, "/C", command}
+	default:
+		return []string{shell, "-c", command}
+	}
+}
+
+func (c *Cmd) String() string {
+	return Type
+}
+
+// GetAddr 执行命令, Details 包含执行的命令、标准输出和标准错误
+func (c *Cmd) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	execCmd := exec.CommandContext(ctx, c.argv[0], c.argv[1:]...)
+	execCmd.Dir = c.dir
+	if len(c.env) > 0 {
+		execCmd.Env = append(os.Environ(), c.env...)
+	}
+	// 子进程仍占用输出时不一直等待
+	execCmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	execCmd.Stdout = &stdout
+	execCmd.Stderr = &stderr
+
+	result := &iIPSource.Result{
+		Source:  Type,
+		Details: map[string]string{"command": execCmd.String()},
+	}
+	err := execCmd.Run()
+	result.Details["stdout"] = util.Truncate(stdout.String(), 256)
+	if stderr.Len() > 0 {
+		result.Details["stderr"] = util.Truncate(stderr.String(), 256)
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("%w after %s: %s", ErrTimeout, c.timeout, execCmd)
+	case errors.As(err, &exitErr):
+		result.Details["exitCode"] = fmt.Sprint(exitErr.ExitCode())
+		err = fmt.Errorf("%w %d: %s", ErrExitStatus, exitErr.ExitCode(), execCmd)
+	case err != nil:
+		err = fmt.Errorf("failed to execute command %s: %w", execCmd, err)
+	}
+	if err != nil {
+		c.logger.Warnf("Failed to get %s from command: %s", c.family, err)
+		return result, err
+	}
+
+	if result.Addr, err = c.parse(c.family, stdout.String()); err != nil {
+		return result, fmt.Errorf("failed to get %s from command output: %w", c.family, err)
+	}
+	c.logger.Debugf("Got %s %s from command %s", c.family, result.Addr, execCmd)
+	return result, nil
+}
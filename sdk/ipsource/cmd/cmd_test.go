@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// TestCmdGetAddr 测试从命令输出中获取地址
+func TestCmdGetAddr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("需要 sh")
+	}
+	source, err := New(iIPSource.IPv6, &config.IPSource{Cmd: "echo ip: 2408:8000::1"}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := source.GetAddr(context.Background())
+	if err != nil || result.Addr != "2408:8000::1" {
+		t.Errorf("期待 2408:8000::1，得到 %+v %v", result, err)
+	}
+
+	source, _ = New(iIPSource.IPv4, &config.IPSource{Cmd: "echo nothing; exit 3"}, xlogger.Nop())
+	result, err = source.GetAddr(context.Background())
+	if !errors.Is(err, ErrExitStatus) || result.Details["stdout"] != "nothing\n" || result.Details["exitCode"] != "3" {
+		t.Errorf("期待 ErrExitStatus 并记录输出，得到 %+v %v", result, err)
+	}
+}
+
+// TestCmdOptions 测试超时、不经过 shell 执行、环境变量和输出的解析
+func TestCmdOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("需要 sh")
+	}
+	tests := []struct {
+		family iIPSource.Family
+		opts   *config.CmdOptions
+		cmd    string
+		want   string
+	}{
+		// 标准错误中的地址不应被使用
+		{iIPSource.IPv4, &config.CmdOptions{}, "echo 10.0.0.1 >&2; echo 203.0.113.1", "203.0.113.1"},
+		{iIPSource.IPv4, &config.CmdOptions{Shell: "sh", Env: []string{"WAN_IP=198.51.100.2"}}, "echo $WAN_IP", "198.51.100.2"},
+		{iIPSource.IPv4, &config.CmdOptions{Args: []string{"printf", "a\\n192.0.2.1\\n192.0.2.2\\n"}, Parse: "line:-2"}, "", "192.0.2.1"},
+		{iIPSource.IPv4, &config.CmdOptions{Parse: `regex:wan=(\S+)`}, "echo lan=192.168.1.1 wan=192.0.2.3", "192.0.2.3"},
+		{iIPSource.IPv6, &config.CmdOptions{Parse: "json:data.ips.1"}, `echo '{"data":{"ips":["2001:db8::1","2408:8000::2"]}}'`, "2408:8000::2"},
+		{iIPSource.IPv4, &config.CmdOptions{Dir: "/", Args: []string{"sh", "-c", "[ $(pwd) = / ] && echo 192.0.2.4"}}, "", "192.0.2.4"},
+	}
+	for _, tt := range tests {
+		source, err := New(tt.family, &config.IPSource{Cmd: tt.cmd, CmdOptions: tt.opts}, xlogger.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := source.GetAddr(context.Background())
+		if err != nil || result.Addr != tt.want {
+			t.Errorf("%q 期待 %s，得到 %+v %v", tt.cmd, tt.want, result, err)
+		}
+	}
+
+	source, _ := New(iIPSource.IPv4, &config.IPSource{Cmd: "sleep 10", CmdOptions: &config.CmdOptions{Timeout: 1}}, xlogger.Nop())
+	if _, err := source.GetAddr(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("期待 ErrTimeout，得到 %v", err)
+	}
+	source, _ = New(iIPSource.IPv4, &config.IPSource{Cmd: "echo 2001:db8::1", CmdOptions: &config.CmdOptions{Parse: "line:1"}}, xlogger.Nop())
+	if _, err := source.GetAddr(context.Background()); err == nil {
+		t.Error("不是 IPv4 地址应返回错误")
+	}
+	if _, err := New(iIPSource.IPv4, &config.IPSource{Cmd: "true", CmdOptions: &config.CmdOptions{Parse: "xml:a"}}, xlogger.Nop()); !errors.Is(err, ErrInvalidParse) {
+		t.Errorf("期待 ErrInvalidParse，得到 %v", err)
+	}
+}
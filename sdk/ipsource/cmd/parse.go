@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 从输出中获取地址的方式
+const (
+	ParseRegex = "regex"
+	ParseLine  = "line"
+	ParseJSON  = "json"
+)
+
+var (
+	ErrInvalidParse = errors.New("invalid cmd parse")
+)
+
+// parser 从标准输出中获取地址
+type parser func(family iIPSource.Family, out string) (string, error)
+
+// newParser 解析 regex:表达式、line:n 或 json:路径, 为空时查找第一个地址
+func newParser(s string) (parser, error) {
+	if s == "" {
+		return findAddr, nil
+	}
+	kind, arg, _ := strings.Cut(s, ":")
+	switch strings.ToLower(kind) {
+	case ParseRegex:
+		reg, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidParse, err)
+		}
+		return func(family iIPSource.Family, out string) (string, error) {
+			match := reg.FindStringSubmatch(out)
+			if match == nil {
+				return "", fmt.Errorf("%w: no match for %s", ipsource.ErrAddrNotFound, reg)
+			}
+			if len(match) > 1 {
+				return ipsource.ParseAddr(family, match[1])
+			}
+			return ipsource.ParseAddr(family, match[0])
+		}, nil
+	case ParseLine:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("%w: line number %q", ErrInvalidParse, arg)
+		}
+		return func(family iIPSource.Family, out string) (string, error) {
+			lines := strings.Split(strings.TrimRight(out, "\r\n"), "\n")
+			i := n - 1
+			if n < 0 {
+				i = len(lines) + n
+			}
+			if i < 0 || i >= len(lines) {
+				return "", fmt.Errorf("%w: line %d of %d", ipsource.ErrAddrNotFound, n, len(lines))
+			}
+			return ipsource.ParseAddr(family, lines[i])
+		}, nil
+	case ParseJSON:
+		if arg == "" {
+			return nil, fmt.Errorf("%w: empty json path", ErrInvalidParse)
+		}
+		return func(family iIPSource.Family, out string) (string, error) {
+			value, err := ipsource.LookupJSON([]byte(out), arg)
+			if err != nil {
+				return "", err
+			}
+			return ipsource.ParseAddr(family, value)
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q, want regex:, line: or json:", ErrInvalidParse, s)
+}
+
+func findAddr(family iIPSource.Family, out string) (string, error) {
+	if addr := ipsource.FindAddr(family, out); addr != "" {
+		return addr, nil
+	}
+	return "", ipsource.ErrAddrNotFound
+}
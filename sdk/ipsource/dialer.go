@@ -0,0 +1,84 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/internal/util"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrInvalidBind      = errors.New("invalid bind")
+	ErrBindNotSupported = errors.New("binding to interface not supported")
+)
+
+// Dialer 从指定的网卡或源地址发起连接, 使策略路由下每条线路的地址可以分别检测
+// 为 nil 时使用默认路由
+type Dialer struct {
+	iface string
+	ip    net.IP
+}
+
+// NewDialer 根据 BindInterface/BindAddr 创建, 都未配置时返回 nil
+func NewDialer(family iIPSource.Family, conf *config.IPSource) (*Dialer, error) {
+	iface, addr := strings.TrimSpace(conf.BindInterface), strings.TrimSpace(conf.BindAddr)
+	if iface == "" && addr == "" {
+		return nil, nil
+	}
+	d := &Dialer{iface: iface}
+	if iface != "" && !bindSupported {
+		return nil, fmt.Errorf("%w: %s", ErrBindNotSupported, iface)
+	}
+	if addr != "" {
+		d.ip = net.ParseIP(addr)
+		if d.ip == nil || (d.ip.To4() != nil) != (family == iIPSource.IPv4) {
+			return nil, fmt.Errorf("%w: %q is not %s", ErrInvalidBind, addr, family)
+		}
+	}
+	return d, nil
+}
+
+func (d *Dialer) String() string {
+	if d == nil {
+		return ""
+	}
+	if d.ip == nil {
+		return d.iface
+	}
+	if d.iface == "" {
+		return d.ip.String()
+	}
+	return d.iface + "/" + d.ip.String()
+}
+
+// DialContext 与 net.Dialer.DialContext 相同, 连接从指定的网卡或源地址发起
+// 超时、KeepAlive 和 DNS 解析器与其它 HTTP Client 相同
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	nd := util.NewDialer()
+	if d != nil {
+		if d.iface != "" {
+			nd.Control = bindToDevice(d.iface)
+		}
+		if d.ip != nil {
+			if strings.HasPrefix(network, "udp") {
+				nd.LocalAddr = &net.UDPAddr{IP: d.ip}
+			} else {
+				nd.LocalAddr = &net.TCPAddr{IP: d.ip}
+			}
+		}
+	}
+	return nd.DialContext(ctx, network, address)
+}
+
+// HTTPClient 不使用代理、按地址类型连接的 HTTP Client
+func (d *Dialer) HTTPClient(family iIPSource.Family) *http.Client {
+	if d == nil {
+		return util.CreateNoProxyHTTPClient(Network(family))
+	}
+	return util.CreateNoProxyDialHTTPClient(Network(family), d.DialContext)
+}
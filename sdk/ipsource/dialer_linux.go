@@ -0,0 +1,18 @@
+package ipsource
+
+import "syscall"
+
+const bindSupported = true
+
+// bindToDevice 使用 SO_BINDTODEVICE 将 socket 绑定到网卡, 内核 5.7 之前需要 CAP_NET_RAW
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if ctrlErr := c.Control(func(fd uintptr) {
+			err = syscall.BindToDevice(int(fd), iface)
+		}); ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package ipsource
+
+import "syscall"
+
+const bindSupported = false
+
+func bindToDevice(string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	DefaultTimeout = 2 * time.Second
+	// DefaultAttempts UDP 查询的次数
+	DefaultAttempts = 3
+)
+
+// client 直接向指定服务器查询的 DNS 客户端, 不使用系统的解析器
+type client struct {
+	// udp/tcp 使用的网络, 如 udp4/tcp4
+	udp string
+	tcp string
+	// dialer 发起连接的网卡或源地址
+	dialer   *ipsource.Dialer
+	timeout  time.Duration
+	attempts int
+}
+
+// exchange 通过 UDP 查询, 超时重试, 响应被截断时改用 TCP
+func (c *client) exchange(ctx context.Context, server string, q question) ([]answer, error) {
+	var err error
+	for i := 0; i < c.attempts; i++ {
+		var answers []answer
+		answers, err = c.exchangeUDP(ctx, server, q)
+		if errors.Is(err, ErrTruncated) {
+			return c.exchangeTCP(ctx, server, q)
+		}
+		var netErr net.Error
+		if err == nil || ctx.Err() != nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+			return answers, err
+		}
+	}
+	return nil, fmt.Errorf("no response after %d attempts: %w", c.attempts, err)
+}
+
+func (c *client) exchangeUDP(ctx context.Context, server string, q question) ([]answer, error) {
+	conn, id, err := c.dial(ctx, c.udp, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query, err := newQuery(id, q)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, c.readErr(ctx, err)
+		}
+		answers, ok, err := parseResponse(buf[:n], id, q)
+		if ok {
+			return answers, err
+		}
+	}
+}
+
+// exchangeTCP 消息前有两个字节的长度
+func (c *client) exchangeTCP(ctx context.Context, server string, q question) ([]answer, error) {
+	conn, id, err := c.dial(ctx, c.tcp, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query, err := newQuery(id, q)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(query)))); err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err = io.ReadFull(conn, length[:]); err != nil {
+		return nil, c.readErr(ctx, err)
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return nil, c.readErr(ctx, err)
+	}
+	answers, ok, err := parseResponse(buf, id, q)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected response id", ErrInvalidMessage)
+	}
+	return answers, err
+}
+
+// dial 连接服务器并生成随机的查询ID, ctx 取消时中止读写
+func (c *client) dial(ctx context.Context, network, server string) (net.Conn, uint16, error) {
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, 0, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	conn, err := c.dialer.DialContext(dialCtx, network, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	return &ctxConn{Conn: conn, stop: stopOnDone(ctx, conn)}, binary.BigEndian.Uint16(id[:]), nil
+}
+
+func (c *client) readErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// stopOnDone ctx 取消时使连接的读写立即返回, 调用返回的函数停止监听
+func stopOnDone(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+type ctxConn struct {
+	net.Conn
+	stop func()
+}
+
+func (c *ctxConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
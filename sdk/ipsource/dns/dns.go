@@ -0,0 +1,184 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net"
+	"regexp"
+	"strings"
+)
+
+const (
+	Type          = "dns"
+	DefaultPort   = "53"
+	DefaultPreset = "opendns"
+)
+
+var (
+	ErrUnknownPreset = errors.New("unknown dns preset")
+	ErrInvalidQuery  = errors.New("invalid dns query")
+)
+
+// preset 预设的查询, 服务器使用IP以免依赖系统的解析器
+type preset struct {
+	server4, server6 string
+	name             string
+	type4, type6     string
+	class            string
+}
+
+var presets = map[string]preset{
+	"opendns":    {"208.67.222.222", "2620:119:35::35", "myip.opendns.com", "A", "AAAA", "IN"},
+	"google":     {"216.239.32.10", "2001:4860:4802:32::a", "o-o.myaddr.l.google.com", "TXT", "TXT", "IN"},
+	"cloudflare": {"1.1.1.1", "2606:4700:4700::1111", "whoami.cloudflare", "TXT", "TXT", "CH"},
+}
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// DNS 向指定服务器查询特殊的域名, 从回答中得到地址, 始终使用与地址相同类型的网络
+type DNS struct {
+	family iIPSource.Family
+	server string
+	q      question
+	match  *regexp.Regexp
+	client *client
+	logger logger.ILogger
+}
+
+// New 创建, 配置的字段覆盖预设
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	query := config.DNSQuery{}
+	if conf.DNSQuery != nil {
+		query = *conf.DNSQuery
+	}
+	if query.Preset == "" && query.Server == "" && query.Name == "" {
+		query.Preset = DefaultPreset
+	}
+	p := preset{class: "IN", type4: "A", type6: "AAAA"}
+	if query.Preset != "" {
+		var ok bool
+		if p, ok = presets[strings.ToLower(query.Preset)]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPreset, query.Preset)
+		}
+	}
+	server, typ := p.server4, p.type4
+	if family == iIPSource.IPv6 {
+		server, typ = p.server6, p.type6
+	}
+	name, class := p.name, p.class
+	override(&server, query.Server)
+	override(&name, query.Name)
+	override(&typ, query.Type)
+	override(&class, query.Class)
+	if server == "" || name == "" {
+		return nil, fmt.Errorf("%w: server and name are required", ErrInvalidQuery)
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), DefaultPort)
+	}
+
+	dialer, err := ipsource.NewDialer(family, conf)
+	if err != nil {
+		return nil, err
+	}
+	d := &DNS{
+		family: family,
+		server: server,
+		q:      question{name: name, typ: types[strings.ToUpper(typ)], class: classes[strings.ToUpper(class)]},
+		client: &client{
+			udp:      ipsource.UDPNetwork(family),
+			tcp:      ipsource.Network(family),
+			dialer:   dialer,
+			timeout:  DefaultTimeout,
+			attempts: DefaultAttempts,
+		},
+		logger: log,
+	}
+	if d.q.typ == 0 || d.q.class == 0 {
+		return nil, fmt.Errorf("%w: unsupported type %s or class %s", ErrInvalidQuery, typ, class)
+	}
+	if query.Match != "" {
+		if d.match, err = regexp.Compile(query.Match); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidQuery, err)
+		}
+	}
+	return d, nil
+}
+
+func override(v *string, s string) {
+	if s = strings.TrimSpace(s); s != "" {
+		*v = s
+	}
+}
+
+func (d *DNS) String() string {
+	return Type
+}
+
+// GetAddr 查询并返回回答中第一个与地址类型相同的地址
+func (d *DNS) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result := &iIPSource.Result{
+		Source:  Type + ":" + d.q.name + "@" + d.server,
+		Details: make(map[string]string),
+	}
+	if bind := d.client.dialer.String(); bind != "" {
+		result.Details["bind"] = bind
+	}
+	answers, err := d.client.exchange(ctx, d.server, d.q)
+	if err != nil {
+		d.logger.Debugf("Failed to query %s from %s: %s", d.q.name, d.server, err)
+		result.Details[d.server] = err.Error()
+		return result, fmt.Errorf("failed to get %s from dns: %w", d.family, err)
+	}
+	var values []string
+	for _, a := range answers {
+		v, err := a.values()
+		if err != nil {
+			result.Details[d.server] = err.Error()
+			return result, fmt.Errorf("failed to get %s from dns: %w", d.family, err)
+		}
+		values = append(values, v...)
+	}
+	for _, v := range values {
+		if addr := d.parse(v); addr != "" {
+			result.Addr = addr
+			return result, nil
+		}
+	}
+	result.Details[d.server] = fmt.Sprintf("no %s in answers: %q", d.family, values)
+	return result, fmt.Errorf("failed to get %s from dns: %w", d.family, ipsource.ErrAddrNotFound)
+}
+
+// parse 从回答中取得地址, 有 match 时使用匹配的内容或第一个分组
+func (d *DNS) parse(v string) string {
+	if d.match != nil {
+		m := d.match.FindStringSubmatch(v)
+		switch {
+		case m == nil:
+			return ""
+		case len(m) > 1:
+			v = m[1]
+		default:
+			v = m[0]
+		}
+	}
+	ip := net.ParseIP(strings.TrimSpace(v))
+	if ip == nil {
+		if v = ipsource.FindAddr(d.family, v); v == "" {
+			return ""
+		}
+		ip = net.ParseIP(v)
+	}
+	if ip == nil || (ip.To4() != nil) != (d.family == iIPSource.IPv4) {
+		return ""
+	}
+	return ip.String()
+}
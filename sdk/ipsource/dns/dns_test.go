@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// reply 构造响应, 回答的域名使用压缩指针, 前面带一条 CNAME
+func reply(query []byte, flags uint16, typ uint16, rdata ...[]byte) []byte {
+	b := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(b[2:], flagQR|flags)
+	binary.BigEndian.PutUint16(b[6:], uint16(len(rdata)+1))
+	class := binary.BigEndian.Uint16(query[len(query)-2:])
+	rr := func(typ uint16, data []byte) {
+		b = append(b, 0xc0, headerSize)
+		b = binary.BigEndian.AppendUint16(b, typ)
+		b = binary.BigEndian.AppendUint16(b, class)
+		b = append(b, 0, 0, 0, 60)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+		b = append(b, data...)
+	}
+	rr(5, []byte{3, 'f', 'o', 'o', 0})
+	for _, data := range rdata {
+		rr(typ, data)
+	}
+	return b
+}
+
+func txt(s ...string) []byte {
+	var b []byte
+	for _, v := range s {
+		b = append(b, byte(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+// TestDNSGetAddr 测试 A 记录查询
+func TestDNSGetAddr(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// 先回复一个其它ID的响应
+			other := reply(buf[:n], 0, TypeA, []byte{198, 51, 100, 1})
+			other[0] ^= 0xff
+			_, _ = conn.WriteTo(other, addr)
+			_, _ = conn.WriteTo(reply(buf[:n], 0, TypeA, []byte{203, 0, 113, 7}), addr)
+		}
+	}()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{DNSQuery: &config.DNSQuery{
+		Preset: "opendns",
+		Server: conn.LocalAddr().String(),
+	}}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "203.0.113.7" || result.Source != Type+":myip.opendns.com@"+conn.LocalAddr().String() {
+		t.Errorf("结果不正确：%+v", result)
+	}
+}
+
+// TestDNSTruncated 测试 UDP 响应被截断时改用 TCP, 并从 TXT 记录中匹配地址
+func TestDNSTruncated(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := net.ListenPacket("udp4", ln.Addr().String())
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err == nil {
+			_, _ = conn.WriteTo(reply(buf[:n], flagTC, TypeTXT), addr)
+		}
+	}()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var length [2]byte
+		_, _ = io.ReadFull(c, length[:])
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		_, _ = io.ReadFull(c, query)
+		resp := reply(query, 0, TypeTXT, txt("edns0-client-subnet 10.0.0.0/24"), txt("client=", "192.0.2.9"))
+		_, _ = c.Write(binary.BigEndian.AppendUint16(nil, uint16(len(resp))))
+		_, _ = c.Write(resp)
+	}()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{DNSQuery: &config.DNSQuery{
+		Preset: "google",
+		Server: ln.Addr().String(),
+		Match:  `client=(\S+)`,
+	}}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "192.0.2.9" {
+		t.Errorf("结果不正确：%+v", result)
+	}
+}
+
+// TestNewDNS 测试预设和配置校验
+func TestNewDNS(t *testing.T) {
+	source, err := New(iIPSource.IPv6, &config.IPSource{}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := source.(*DNS); d.server != "[2620:119:35::35]:53" || d.q.typ != TypeAAAA || d.client.udp != "udp6" {
+		t.Errorf("默认预设不正确：%+v", d)
+	}
+	source, _ = New(iIPSource.IPv4, &config.IPSource{DNSQuery: &config.DNSQuery{Preset: "cloudflare"}}, xlogger.Nop())
+	if d := source.(*DNS); d.q.class != ClassCH || d.q.typ != TypeTXT {
+		t.Errorf("cloudflare 预设不正确：%+v", d.q)
+	}
+	if _, err = New(iIPSource.IPv4, &config.IPSource{DNSQuery: &config.DNSQuery{Preset: "none"}}, xlogger.Nop()); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("期待 ErrUnknownPreset，得到 %v", err)
+	}
+	if _, err = New(iIPSource.IPv4, &config.IPSource{DNSQuery: &config.DNSQuery{Server: "127.0.0.1", Name: "a", Type: "MX"}}, xlogger.Nop()); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("期待 ErrInvalidQuery，得到 %v", err)
+	}
+}
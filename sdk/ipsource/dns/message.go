@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RFC 1035 的消息格式, 只支持查询公网地址需要的部分
+const (
+	headerSize = 12
+
+	TypeA    uint16 = 1
+	TypeTXT  uint16 = 16
+	TypeAAAA uint16 = 28
+
+	ClassIN uint16 = 1
+	ClassCH uint16 = 3
+
+	flagQR = 1 << 15
+	flagTC = 1 << 9
+	flagRD = 1 << 8
+)
+
+var (
+	ErrInvalidMessage = errors.New("dns: invalid message")
+	ErrTruncated      = errors.New("dns: truncated response")
+)
+
+var (
+	types   = map[string]uint16{"A": TypeA, "TXT": TypeTXT, "AAAA": TypeAAAA}
+	classes = map[string]uint16{"IN": ClassIN, "CH": ClassCH}
+	rcodes  = map[int]string{1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED"}
+)
+
+// question 查询的问题
+type question struct {
+	name  string
+	typ   uint16
+	class uint16
+}
+
+// answer 与问题类型相同的回答
+type answer struct {
+	typ  uint16
+	data []byte
+}
+
+// newQuery 构造期望递归的查询
+func newQuery(id uint16, q question) ([]byte, error) {
+	b := make([]byte, headerSize, 512)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], flagRD)
+	binary.BigEndian.PutUint16(b[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(q.name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("dns: invalid name %q", q.name)
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, q.typ)
+	b = binary.BigEndian.AppendUint16(b, q.class)
+	return b, nil
+}
+
+// parseResponse 解析响应中与问题类型相同的回答
+// 不是该查询的响应时 ok 为 false, 应继续等待
+func parseResponse(b []byte, id uint16, q question) (answers []answer, ok bool, err error) {
+	if len(b) < headerSize || binary.BigEndian.Uint16(b[0:]) != id {
+		return nil, false, nil
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	if flags&flagQR == 0 {
+		return nil, false, nil
+	}
+	if flags&flagTC != 0 {
+		return nil, true, ErrTruncated
+	}
+	if rcode := int(flags & 0xf); rcode != 0 {
+		name, found := rcodes[rcode]
+		if !found {
+			name = fmt.Sprintf("RCODE%d", rcode)
+		}
+		return nil, true, fmt.Errorf("dns: %s %s", q.name, name)
+	}
+	qdCount := int(binary.BigEndian.Uint16(b[4:]))
+	anCount := int(binary.BigEndian.Uint16(b[6:]))
+
+	off := headerSize
+	for i := 0; i < qdCount; i++ {
+		if off, err = skipName(b, off); err != nil {
+			return nil, true, err
+		}
+		off += 4
+	}
+	for i := 0; i < anCount; i++ {
+		if off, err = skipName(b, off); err != nil {
+			return nil, true, err
+		}
+		if off+10 > len(b) {
+			return nil, true, ErrInvalidMessage
+		}
+		typ := binary.BigEndian.Uint16(b[off:])
+		class := binary.BigEndian.Uint16(b[off+2:])
+		length := int(binary.BigEndian.Uint16(b[off+8:]))
+		off += 10
+		if off+length > len(b) {
+			return nil, true, ErrInvalidMessage
+		}
+		// 跳过 CNAME 等其它记录
+		if typ == q.typ && class == q.class {
+			answers = append(answers, answer{typ: typ, data: b[off : off+length]})
+		}
+		off += length
+	}
+	return answers, true, nil
+}
+
+// skipName 跳过域名, 返回其后的偏移
+func skipName(b []byte, off int) (int, error) {
+	for {
+		if off >= len(b) {
+			return 0, ErrInvalidMessage
+		}
+		l := int(b[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			// 压缩指针
+			return off + 2, nil
+		case l&0xc0 != 0:
+			return 0, ErrInvalidMessage
+		}
+		off += 1 + l
+	}
+}
+
+// values 返回回答中的地址或文本
+func (a answer) values() ([]string, error) {
+	switch a.typ {
+	case TypeA, TypeAAAA:
+		if len(a.data) != net.IPv4len && len(a.data) != net.IPv6len {
+			return nil, ErrInvalidMessage
+		}
+		return []string{net.IP(a.data).String()}, nil
+	case TypeTXT:
+		// 同一条记录的多个字符串连接在一起
+		var (
+			txt  strings.Builder
+			data = a.data
+		)
+		for len(data) > 0 {
+			l := int(data[0])
+			if 1+l > len(data) {
+				return nil, ErrInvalidMessage
+			}
+			txt.Write(data[1 : 1+l])
+			data = data[1+l:]
+		}
+		return []string{txt.String()}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,181 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"net"
+	"strings"
+)
+
+// 预设的地址范围, 只能用于 deny
+const (
+	// PresetPublicOnly 私有、保留、CGNAT、文档、Teredo、6to4 等非公网地址
+	PresetPublicOnly = "public-only"
+	// PresetNoCGNAT 运营商级 NAT 的共享地址 100.64.0.0/10
+	PresetNoCGNAT = "no-cgnat"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid address filter")
+	ErrAddrRejected  = errors.New("address rejected")
+)
+
+var presets = map[string]map[iIPSource.Family][]string{
+	PresetPublicOnly: {
+		iIPSource.IPv4: {
+			"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+			"192.0.0.0/24", "192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24",
+			"203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+		},
+		iIPSource.IPv6: {
+			"::/128", "::1/128", "::ffff:0:0/96", "64:ff9b:1::/48", "100::/64", "2001::/32", "2001:db8::/32",
+			"2002::/16", "fc00::/7", "fe80::/10", "fec0::/10", "ff00::/8",
+		},
+	},
+	PresetNoCGNAT: {
+		iIPSource.IPv4: {"100.64.0.0/10"},
+	},
+}
+
+// rule 地址范围, name 为所属的预设
+type rule struct {
+	prefix *net.IPNet
+	name   string
+}
+
+func (r rule) String() string {
+	if r.name != "" {
+		return fmt.Sprintf("%s (%s)", r.prefix, r.name)
+	}
+	return r.prefix.String()
+}
+
+// Filter 检查获取到的地址是否在允许的范围内, 被拒绝时视为获取失败
+type Filter struct {
+	iIPSource.IIPSource
+	allow []rule
+	deny  []rule
+}
+
+// NewFilter 创建, allow/deny 为 CIDR 或单个IP, deny 中也可以使用预设 public-only/no-cgnat
+// 匹配 allow 的地址总是允许, 其次拒绝匹配 deny 的地址, allow 不为空时拒绝其它地址
+// allow 和 deny 都为空时直接返回 source
+func NewFilter(source iIPSource.IIPSource, family iIPSource.Family, allow, deny []string) (iIPSource.IIPSource, error) {
+	f := &Filter{IIPSource: source}
+	var err error
+	if f.allow, err = parseRules(family, allow, false); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseRules(family, deny, true); err != nil {
+		return nil, err
+	}
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return source, nil
+	}
+	return f, nil
+}
+
+func parseRules(family iIPSource.Family, items []string, preset bool) (rules []rule, err error) {
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if ranges, ok := presets[strings.ToLower(item)]; ok {
+			if !preset {
+				return nil, fmt.Errorf("%w: preset %s can only be used in deny", ErrInvalidFilter, item)
+			}
+			for _, cidr := range ranges[family] {
+				_, prefix, _ := net.ParseCIDR(cidr)
+				rules = append(rules, rule{prefix: prefix, name: strings.ToLower(item)})
+			}
+			continue
+		}
+		cidr := item
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, prefix, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFilter, item)
+		}
+		if (prefix.IP.To4() != nil) != (family == iIPSource.IPv4) {
+			return nil, fmt.Errorf("%w: %s is not %s", ErrInvalidFilter, item, family)
+		}
+		rules = append(rules, rule{prefix: prefix})
+	}
+	return
+}
+
+// GetAddr 获取地址并检查, 被拒绝时返回 ErrAddrRejected, Details 记录被拒绝的地址
+// 多地址模式下只去掉被拒绝的地址, 都被拒绝时才失败
+func (f *Filter) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result, err := f.IIPSource.GetAddr(ctx)
+	if err != nil || result == nil || result.Addr == "" {
+		return result, err
+	}
+	if result.Details == nil {
+		result.Details = make(map[string]string)
+	}
+	if len(result.Addrs) > 0 {
+		var (
+			accepted []string
+			rejected []string
+		)
+		for _, addr := range result.Addrs {
+			if err = f.Check(addr); err != nil {
+				rejected = append(rejected, addr)
+				continue
+			}
+			accepted = append(accepted, addr)
+		}
+		if len(rejected) > 0 {
+			result.Details["rejected"] = strings.Join(rejected, ",")
+		}
+		if len(accepted) == 0 {
+			result.Addr, result.Addrs = "", nil
+			return result, err
+		}
+		result.Addr, result.Addrs = accepted[0], accepted
+		return result, nil
+	}
+	if err = f.Check(result.Addr); err != nil {
+		result.Details["rejected"] = result.Addr
+		result.Addr = ""
+		return result, err
+	}
+	return result, nil
+}
+
+// Watch 监听被过滤的 source 的地址变化
+func (f *Filter) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return Watch(ctx, f.IIPSource)
+}
+
+// Check 检查地址, 被拒绝时返回原因
+func (f *Filter) Check(addr string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("%w: invalid address %q", ErrAddrRejected, addr)
+	}
+	for _, r := range f.allow {
+		if r.prefix.Contains(ip) {
+			return nil
+		}
+	}
+	for _, r := range f.deny {
+		if r.prefix.Contains(ip) {
+			return fmt.Errorf("%w: %s is denied by %s", ErrAddrRejected, addr, r)
+		}
+	}
+	if len(f.allow) > 0 {
+		return fmt.Errorf("%w: %s is not in the allow list", ErrAddrRejected, addr)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	ErrGatewayNotFound = errors.New("gateway not found")
+)
+
+// Resolve 返回配置的网关地址, 为空时自动检测默认网关
+func Resolve(gateway string) (net.IP, error) {
+	if gateway == "" {
+		return Detect()
+	}
+	ip := net.ParseIP(gateway).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid gateway %q", gateway)
+	}
+	return ip, nil
+}
+
+// Detect 返回默认网关的IPv4地址
+func Detect() (net.IP, error) {
+	if ip, err := defaultRoute(); err == nil {
+		return ip, nil
+	}
+	return guess()
+}
+
+// guess 无法读取路由表时, 假设网关是第一个私有地址所在网段的 .1
+func guess() (net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || !ipNet.IP.IsPrivate() {
+				continue
+			}
+			ip := ipNet.IP.To4().Mask(ipNet.Mask)
+			ip[3] |= 1
+			return ip, nil
+		}
+	}
+	return nil, ErrGatewayNotFound
+}
+
+// Exchange 向网关发送 UDP 请求, 未收到响应时按 rto 翻倍重传, 最多发送 attempts 次
+// parse 返回 ok 为 false 时忽略该响应继续等待
+func Exchange(ctx context.Context, conn net.Conn, req []byte, rto time.Duration, attempts int,
+	parse func(b []byte) (ok bool, err error)) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, 1100)
+	for i := 0; i < attempts; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(rto))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return err
+			}
+			if ok, err := parse(buf[:n]); ok {
+				return err
+			}
+		}
+		rto *= 2
+	}
+	return fmt.Errorf("no response from %s after %d requests", conn.RemoteAddr(), attempts)
+}
@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultRoute 从 /proc/net/route 读取默认路由的网关
+func defaultRoute() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseRoute(f)
+}
+
+// parseRoute 解析路由表, 地址为小端序的十六进制
+func parseRoute(r io.Reader) (net.IP, error) {
+	scanner := bufio.NewScanner(r)
+	// 跳过标题
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gw == 0 {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.LittleEndian.PutUint32(ip, uint32(gw))
+		return ip, nil
+	}
+	return nil, ErrGatewayNotFound
+}
@@ -0,0 +1,24 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseRoute 测试从路由表中读取默认网关
+func TestParseRoute(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0001A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+`
+	ip, err := parseRoute(strings.NewReader(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "192.168.1.1" {
+		t.Errorf("默认网关应为 192.168.1.1，得到 %s", ip)
+	}
+	if _, err = parseRoute(strings.NewReader(strings.SplitN(table, "\n", 3)[0])); err != ErrGatewayNotFound {
+		t.Errorf("没有默认路由时应返回 ErrGatewayNotFound，得到 %v", err)
+	}
+}
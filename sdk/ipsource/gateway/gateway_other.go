@@ -0,0 +1,10 @@
+//go:build !linux
+
+package gateway
+
+import "net"
+
+// defaultRoute 其它系统不读取路由表
+func defaultRoute() (net.IP, error) {
+	return nil, ErrGatewayNotFound
+}
@@ -0,0 +1,169 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/internal/util"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrIPSourceNotSupported = errors.New("ip source not supported")
+	ErrAddrNotFound         = errors.New("address not found")
+	ErrFamilyNotSupported   = errors.New("address family not supported")
+	ErrWatchNotSupported    = errors.New("watching address changes not supported")
+)
+
+// Ipv4Reg IPv4正则
+var Ipv4Reg = regexp.MustCompile(`((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])`)
+
+// Ipv6Reg IPv6正则
+var Ipv6Reg = regexp.MustCompile(`((([0-9A-Fa-f]{1,4}:){7}([0-9A-Fa-f]{1,4}|:))|(([0-9A-Fa-f]{1,4}:){6}(:[0-9A-Fa-f]{1,4}|((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3})|:))|(([0-9A-Fa-f]{1,4}:){5}(((:[0-9A-Fa-f]{1,4}){1,2})|:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3})|:))|(([0-9A-Fa-f]{1,4}:){4}(((:[0-9A-Fa-f]{1,4}){1,3})|((:[0-9A-Fa-f]{1,4})?:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){3}(((:[0-9A-Fa-f]{1,4}){1,4})|((:[0-9A-Fa-f]{1,4}){0,2}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){2}(((:[0-9A-Fa-f]{1,4}){1,5})|((:[0-9A-Fa-f]{1,4}){0,3}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){1}(((:[0-9A-Fa-f]{1,4}){1,6})|((:[0-9A-Fa-f]{1,4}){0,4}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(:(((:[0-9A-Fa-f]{1,4}){1,7})|((:[0-9A-Fa-f]{1,4}){0,5}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:)))`)
+
+// New 根据 getType 从注册表中创建获取IP的方式
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	newIPSource := registry.IPSources().Get(conf.GetType)
+	if newIPSource == nil {
+		return nil, fmt.Errorf("%w: %s %q", ErrIPSourceNotSupported, family, conf.GetType)
+	}
+	return newIPSource(family, conf, log)
+}
+
+// Watch 监听地址变化, source 未实现 IWatcher 时返回 ErrWatchNotSupported
+func Watch(ctx context.Context, source iIPSource.IIPSource) (<-chan struct{}, error) {
+	watcher, ok := source.(iIPSource.IWatcher)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWatchNotSupported, source)
+	}
+	return watcher.Watch(ctx)
+}
+
+// Merge 将多个地址变化的通知合并到一个 channel, 尚未处理的通知合并为一次
+func Merge(ctx context.Context, chans ...<-chan struct{}) <-chan struct{} {
+	merged := make(chan struct{}, 1)
+	for _, changes := range chans {
+		go func(changes <-chan struct{}) {
+			for {
+				select {
+				case <-changes:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case merged <- struct{}{}:
+				default:
+				}
+			}
+		}(changes)
+	}
+	return merged
+}
+
+// FindAddr 从文本中查找第一个指定类型的地址
+func FindAddr(family iIPSource.Family, s string) string {
+	if family == iIPSource.IPv6 {
+		return Ipv6Reg.FindString(s)
+	}
+	return Ipv4Reg.FindString(s)
+}
+
+// ParseAddr 解析选出的内容, 须是该类型的地址
+func ParseAddr(family iIPSource.Family, s string) (string, error) {
+	s = strings.TrimSpace(s)
+	ip := net.ParseIP(s)
+	if ip == nil || (ip.To4() != nil) != (family == iIPSource.IPv4) {
+		return "", fmt.Errorf("%w: %q is not %s", ErrAddrNotFound, util.Truncate(s, 64), family)
+	}
+	return ip.String(), nil
+}
+
+// LookupJSON 按以点分隔的路径查找 JSON 中的字符串, 数组使用下标, 如 data.ips.0
+func LookupJSON(data []byte, path string) (string, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", fmt.Errorf("invalid json: %w", err)
+	}
+	keys := strings.Split(path, ".")
+	for i, key := range keys {
+		notFound := fmt.Errorf("%w: json path %s not found", ErrAddrNotFound, strings.Join(keys[:i+1], "."))
+		switch node := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return "", notFound
+			}
+		case []any:
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 0 || n >= len(node) {
+				return "", notFound
+			}
+			v = node[n]
+		default:
+			return "", notFound
+		}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: json value %v is not a string", ErrAddrNotFound, v)
+	}
+	return s, nil
+}
+
+// Network 获取地址时使用的网络 tcp4/tcp6
+func Network(family iIPSource.Family) string {
+	if family == iIPSource.IPv6 {
+		return "tcp6"
+	}
+	return "tcp4"
+}
+
+// UDPNetwork 获取地址时使用的网络 udp4/udp6
+func UDPNetwork(family iIPSource.Family) string {
+	if family == iIPSource.IPv6 {
+		return "udp6"
+	}
+	return "udp4"
+}
+
+// SelectAddr 按匹配规则从多个地址中选择一个
+// match 为空时使用第一个地址, @n 表示第n个地址, 否则为正则表达式, 都不匹配时使用第一个地址
+func SelectAddr(addrs []string, match string) (string, error) {
+	if len(addrs) == 0 {
+		return "", ErrAddrNotFound
+	}
+	if match == "" {
+		return addrs[0], nil
+	}
+	// 匹配第几个地址
+	if len(match) > 1 && match[0] == '@' {
+		if num, err := strconv.Atoi(match[1:]); err == nil {
+			if num < 1 {
+				return "", fmt.Errorf("invalid match expression %s, minimum starts from 1", match)
+			}
+			if num <= len(addrs) {
+				return addrs[num-1], nil
+			}
+			return addrs[0], nil
+		}
+	}
+	// 正则表达式匹配
+	reg, err := regexp.Compile(match)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if reg.MatchString(addr) {
+			return addr, nil
+		}
+	}
+	return addrs[0], nil
+}
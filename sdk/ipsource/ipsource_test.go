@@ -0,0 +1,212 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// TestSelectAddr 测试从多个地址中选择
+func TestSelectAddr(t *testing.T) {
+	addrs := []string{"2408::1", "240e::2", "2001::3"}
+	tests := []struct {
+		match    string
+		expected string
+	}{
+		{"", "2408::1"},
+		{"@2", "240e::2"},
+		{"@9", "2408::1"},
+		{"^2001", "2001::3"},
+		{"^fe80", "2408::1"},
+	}
+	for _, tt := range tests {
+		addr, err := SelectAddr(addrs, tt.match)
+		if err != nil || addr != tt.expected {
+			t.Errorf("%q 期待 %s，得到 %s %v", tt.match, tt.expected, addr, err)
+		}
+	}
+	if _, err := SelectAddr(addrs, "@0"); err == nil {
+		t.Error("@0 应返回错误")
+	}
+	if _, err := SelectAddr(nil, ""); err == nil {
+		t.Error("没有地址应返回错误")
+	}
+}
+
+// TestFindAddr 测试从文本中查找地址
+func TestFindAddr(t *testing.T) {
+	if addr := FindAddr(iIPSource.IPv4, "当前 IP：1.2.3.4 来自于：中国"); addr != "1.2.3.4" {
+		t.Errorf("期待 1.2.3.4，得到 %s", addr)
+	}
+	if addr := FindAddr(iIPSource.IPv6, "ip=2408:8000::1\n"); addr != "2408:8000::1" {
+		t.Errorf("期待 2408:8000::1，得到 %s", addr)
+	}
+}
+
+type staticSource string
+
+func (s staticSource) String() string {
+	return "static"
+}
+
+func (s staticSource) GetAddr(context.Context) (*iIPSource.Result, error) {
+	return &iIPSource.Result{Addr: string(s), Source: "static"}, nil
+}
+
+// TestFilter 测试按 allow/deny 过滤地址
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		family   iIPSource.Family
+		allow    []string
+		deny     []string
+		addr     string
+		rejected bool
+	}{
+		{iIPSource.IPv4, nil, []string{PresetPublicOnly}, "100.72.1.2", true},
+		{iIPSource.IPv4, nil, []string{PresetPublicOnly}, "203.0.114.1", false},
+		{iIPSource.IPv4, nil, []string{PresetNoCGNAT}, "192.168.1.1", false},
+		{iIPSource.IPv4, []string{"192.168.1.0/24"}, []string{"public-only"}, "192.168.1.1", false},
+		{iIPSource.IPv4, []string{"198.51.100.7"}, nil, "198.51.100.8", true},
+		{iIPSource.IPv6, nil, []string{PresetPublicOnly}, "2001:0:4136:e378::1", true},
+		{iIPSource.IPv6, nil, []string{PresetPublicOnly}, "2002:c000:204::1", true},
+		{iIPSource.IPv6, nil, []string{PresetPublicOnly}, "fd00::1", true},
+		{iIPSource.IPv6, nil, []string{PresetPublicOnly, PresetNoCGNAT}, "2408:8000::1", false},
+		{iIPSource.IPv6, nil, []string{"2408::/16"}, "2408:8000::1", true},
+	}
+	for _, tt := range tests {
+		source, err := NewFilter(staticSource(tt.addr), tt.family, tt.allow, tt.deny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := source.GetAddr(context.Background())
+		if tt.rejected {
+			if !errors.Is(err, ErrAddrRejected) || result.Addr != "" || result.Details["rejected"] != tt.addr {
+				t.Errorf("%s 应被拒绝，得到 %+v %v", tt.addr, result, err)
+			}
+		} else if err != nil || result.Addr != tt.addr {
+			t.Errorf("%s 应被允许，得到 %+v %v", tt.addr, result, err)
+		}
+	}
+
+	if source, _ := NewFilter(staticSource("10.0.0.1"), iIPSource.IPv4, nil, nil); source != staticSource("10.0.0.1") {
+		t.Error("没有 allow/deny 时应返回原来的 source")
+	}
+	for _, bad := range [][2][]string{
+		{{PresetPublicOnly}, nil},
+		{nil, {"2001:db8::/32"}},
+		{nil, {"10.0.0.0/33"}},
+	} {
+		if _, err := NewFilter(staticSource(""), iIPSource.IPv4, bad[0], bad[1]); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%v 期待 ErrInvalidFilter，得到 %v", bad, err)
+		}
+	}
+}
+
+// slowSource 直到 ctx 结束才返回
+type slowSource struct{}
+
+func (slowSource) String() string {
+	return "slow"
+}
+
+func (slowSource) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestChain 测试按顺序尝试, 超时或被拒绝时尝试下一个
+func TestChain(t *testing.T) {
+	denied, err := NewFilter(staticSource("100.64.0.1"), iIPSource.IPv4, nil, []string{PresetNoCGNAT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := NewChain([]ChainSource{{IIPSource: slowSource{}}, {IIPSource: denied}, {IIPSource: staticSource("203.0.113.1")}}, 10*time.Millisecond, xlogger.Nop())
+	result, err := chain.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "203.0.113.1" || result.Source != "static" {
+		t.Errorf("结果不正确：%+v", result)
+	}
+	if fallback := result.Details["fallback"]; !strings.Contains(fallback, "slow: context deadline exceeded") || !strings.Contains(fallback, "static: address rejected") {
+		t.Errorf("应记录之前失败的方式，得到 %q", fallback)
+	}
+
+	chain = NewChain([]ChainSource{{IIPSource: slowSource{}}, {IIPSource: denied}}, 10*time.Millisecond, xlogger.Nop())
+	if result, err = chain.GetAddr(context.Background()); !errors.Is(err, ErrAllSourcesFailed) || result.Source != "slow,static" {
+		t.Errorf("期待 ErrAllSourcesFailed，得到 %+v %v", result, err)
+	}
+}
+
+// TestChainSourceTimeout 测试方式单独的超时, 慢的方式按自己的超时结束后尝试下一个
+func TestChainSourceTimeout(t *testing.T) {
+	chain := NewChain([]ChainSource{
+		{IIPSource: slowSource{}, Timeout: 10 * time.Millisecond},
+		{IIPSource: staticSource("203.0.113.1")},
+	}, time.Minute, xlogger.Nop())
+	start := time.Now()
+	result, err := chain.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("应使用方式单独的超时，耗时 %s", elapsed)
+	}
+	if result.Addr != "203.0.113.1" || !strings.Contains(result.Details["fallback"], "slow: context deadline exceeded") {
+		t.Errorf("结果不正确：%+v", result)
+	}
+}
+
+// TestParseAddr 测试地址类型的校验和 JSON 路径
+func TestParseAddr(t *testing.T) {
+	if addr, err := ParseAddr(iIPSource.IPv6, " 2408:8000:0::1\n"); err != nil || addr != "2408:8000::1" {
+		t.Errorf("期待 2408:8000::1，得到 %s %v", addr, err)
+	}
+	if _, err := ParseAddr(iIPSource.IPv6, "1.2.3.4"); !errors.Is(err, ErrAddrNotFound) {
+		t.Errorf("IPv4 地址不是 IPv6，得到 %v", err)
+	}
+	data := []byte(`{"data":{"ips":["1.2.3.4","5.6.7.8"],"n":1}}`)
+	if v, err := LookupJSON(data, "data.ips.1"); err != nil || v != "5.6.7.8" {
+		t.Errorf("期待 5.6.7.8，得到 %s %v", v, err)
+	}
+	for _, path := range []string{"data.ips.2", "data.n", "data.ip"} {
+		if _, err := LookupJSON(data, path); !errors.Is(err, ErrAddrNotFound) {
+			t.Errorf("%s 期待 ErrAddrNotFound，得到 %v", path, err)
+		}
+	}
+}
+
+// TestDialer 测试从指定源地址发起连接
+func TestDialer(t *testing.T) {
+	if d, err := NewDialer(iIPSource.IPv4, &config.IPSource{}); d != nil || err != nil {
+		t.Fatalf("未配置时应使用默认路由，得到 %v %v", d, err)
+	}
+	if _, err := NewDialer(iIPSource.IPv4, &config.IPSource{BindAddr: "::1"}); !errors.Is(err, ErrInvalidBind) {
+		t.Errorf("IPv4 绑定 IPv6 源地址应失败，得到 %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	d, err := NewDialer(iIPSource.IPv4, &config.IPSource{BindAddr: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := d.DialContext(context.Background(), UDPNetwork(iIPSource.IPv4), conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ip := c.LocalAddr().(*net.UDPAddr).IP.String(); ip != "127.0.0.1" || d.String() != "127.0.0.1" {
+		t.Errorf("应从 127.0.0.1 发起连接，得到 %s", ip)
+	}
+}
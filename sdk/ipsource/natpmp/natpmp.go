@@ -0,0 +1,105 @@
+package natpmp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/ipsource/gateway"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	Type = "natpmp"
+	Port = 5351
+)
+
+// RFC 6886 3.1 的重传参数, RFC 建议最多发送9次, 这里只发送4次以免等待过久
+const (
+	DefaultRTO = 250 * time.Millisecond
+	Attempts   = 4
+)
+
+// resultCodes RFC 6886 3.5 的结果码
+var resultCodes = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// NATPMP 向网关请求外部地址, 只支持IPv4
+type NATPMP struct {
+	gateway string
+	port    int
+	rto     time.Duration
+	logger  logger.ILogger
+}
+
+// New 创建, Gateway 为空时自动检测默认网关
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	if family != iIPSource.IPv4 {
+		return nil, fmt.Errorf("%w: %s %s", ipsource.ErrFamilyNotSupported, Type, family)
+	}
+	return &NATPMP{gateway: conf.Gateway, port: Port, rto: DefaultRTO, logger: log}, nil
+}
+
+func (n *NATPMP) String() string {
+	return Type
+}
+
+// GetAddr 发送外部地址请求
+func (n *NATPMP) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result := &iIPSource.Result{Details: make(map[string]string)}
+	gw, err := gateway.Resolve(n.gateway)
+	if err != nil {
+		result.Details["gateway"] = err.Error()
+		return result, fmt.Errorf("failed to get IPv4 from natpmp: %w", err)
+	}
+	server := net.JoinHostPort(gw.String(), strconv.Itoa(n.port))
+	result.Source = Type + ":" + server
+	ip, err := n.externalAddr(ctx, server)
+	if err != nil {
+		n.logger.Debugf("Failed to get IPv4 from NAT-PMP gateway %s: %s", server, err)
+		result.Details[server] = err.Error()
+		return result, fmt.Errorf("failed to get IPv4 from natpmp: %w", err)
+	}
+	result.Addr = ip.String()
+	return result, nil
+}
+
+func (n *NATPMP) externalAddr(ctx context.Context, server string) (ip net.IP, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// 版本 0, 操作码 0
+	err = gateway.Exchange(ctx, conn, []byte{0, 0}, n.rto, Attempts, func(b []byte) (bool, error) {
+		if len(b) < 12 || b[0] != 0 || b[1] != 128 {
+			return false, nil
+		}
+		if code := binary.BigEndian.Uint16(b[2:]); code != 0 {
+			msg, ok := resultCodes[code]
+			if !ok {
+				msg = "result code " + strconv.Itoa(int(code))
+			}
+			return true, fmt.Errorf("natpmp: %s", msg)
+		}
+		ip = net.IP(append([]byte(nil), b[8:12]...))
+		return true, nil
+	})
+	return ip, err
+}
@@ -0,0 +1,58 @@
+package natpmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// TestNATPMPGetAddr 测试重传和结果码
+func TestNATPMPGetAddr(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 16)
+		for i := 0; ; i++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// 丢弃第一个请求, 之后先成功再返回 network failure
+			if i == 0 || n != 2 {
+				continue
+			}
+			code := byte(0)
+			if i > 1 {
+				code = 3
+			}
+			_, _ = conn.WriteTo([]byte{0, 128, 0, code, 0, 0, 0, 1, 203, 0, 113, 7}, addr)
+		}
+	}()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{Gateway: "127.0.0.1"}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := source.(*NATPMP)
+	n.port = conn.LocalAddr().(*net.UDPAddr).Port
+	n.rto = 10 * time.Millisecond
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "203.0.113.7" || result.Source != Type+":"+conn.LocalAddr().String() {
+		t.Errorf("结果不正确：%+v", result)
+	}
+
+	if _, err = source.GetAddr(context.Background()); err == nil {
+		t.Error("期待 network failure 错误")
+	}
+}
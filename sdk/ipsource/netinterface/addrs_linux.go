@@ -0,0 +1,106 @@
+package netinterface
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+)
+
+// syscall 中没有的定义
+const (
+	ifaFlags         = 8     // IFA_FLAGS, 32位的标志
+	ifaFMngTmpAddr   = 0x100 // IFA_F_MANAGETEMPADDR
+	ifaCacheinfoSize = 16
+	infinityLifeTime = 0xffffffff
+)
+
+// interfaceAddrs 通过 netlink 获取网卡的地址及其标志和生存期
+func interfaceAddrs(name string, family iIPSource.Family) ([]Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	af := syscall.AF_INET
+	if family == iIPSource.IPv6 {
+		af = syscall.AF_INET6
+	}
+	tab, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, af)
+	if err != nil {
+		return nil, err
+	}
+	return parseAddrs(tab, iface.Index)
+}
+
+// parseAddrs 解析 RTM_NEWADDR 消息, 返回网卡 index 的地址
+func parseAddrs(tab []byte, index int) ([]Addr, error) {
+	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []Addr
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Type == syscall.NLMSG_DONE {
+			break
+		}
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		ifa := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		if int(ifa.Index) != index {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			return nil, err
+		}
+		addr := Addr{
+			PrefixLen:         int(ifa.Prefixlen),
+			PreferredLifetime: Forever,
+			ValidLifetime:     Forever,
+		}
+		flags := uint32(ifa.Flags)
+		var local net.IP
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.IFA_ADDRESS:
+				addr.IP = net.IP(attr.Value)
+			case syscall.IFA_LOCAL:
+				local = net.IP(attr.Value)
+			case ifaFlags:
+				if len(attr.Value) >= 4 {
+					flags = *(*uint32)(unsafe.Pointer(&attr.Value[0]))
+				}
+			case syscall.IFA_CACHEINFO:
+				if len(attr.Value) >= ifaCacheinfoSize {
+					addr.PreferredLifetime = lifetime(*(*uint32)(unsafe.Pointer(&attr.Value[0])))
+					addr.ValidLifetime = lifetime(*(*uint32)(unsafe.Pointer(&attr.Value[4])))
+				}
+			}
+		}
+		// 点对点网卡的 IFA_ADDRESS 是对端地址
+		if local != nil {
+			addr.IP = local
+		}
+		if addr.IP == nil {
+			continue
+		}
+		addr.Temporary = flags&syscall.IFA_F_TEMPORARY != 0
+		addr.Deprecated = flags&syscall.IFA_F_DEPRECATED != 0
+		addr.DADFailed = flags&syscall.IFA_F_DADFAILED != 0
+		addr.Tentative = flags&syscall.IFA_F_TENTATIVE != 0
+		addr.MngTmpAddr = flags&ifaFMngTmpAddr != 0
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func lifetime(sec uint32) time.Duration {
+	if sec == infinityLifeTime {
+		return Forever
+	}
+	return time.Duration(sec) * time.Second
+}
@@ -0,0 +1,76 @@
+package netinterface
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// newAddrMessage 构造 RTM_NEWADDR 消息, 使用本机字节序
+func newAddrMessage(index uint32, ip net.IP, prefixLen uint8, flags uint32, preferred, valid uint32) []byte {
+	u32 := func(v uint32) []byte {
+		b := make([]byte, 4)
+		*(*uint32)(unsafe.Pointer(&b[0])) = v
+		return b
+	}
+	attr := func(typ uint16, value []byte) []byte {
+		b := make([]byte, 4, 4+len(value)+3)
+		*(*uint16)(unsafe.Pointer(&b[0])) = uint16(4 + len(value))
+		*(*uint16)(unsafe.Pointer(&b[2])) = typ
+		b = append(b, value...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	body := []byte{syscall.AF_INET6, prefixLen, byte(flags), 0}
+	body = append(body, u32(index)...)
+	body = append(body, attr(syscall.IFA_ADDRESS, ip.To16())...)
+	body = append(body, attr(ifaFlags, u32(flags))...)
+	body = append(body, attr(syscall.IFA_CACHEINFO, append(append(u32(preferred), u32(valid)...), make([]byte, 8)...))...)
+
+	msg := make([]byte, syscall.NLMSG_HDRLEN)
+	*(*uint32)(unsafe.Pointer(&msg[0])) = uint32(len(msg) + len(body))
+	*(*uint16)(unsafe.Pointer(&msg[4])) = syscall.RTM_NEWADDR
+	return append(msg, body...)
+}
+
+// TestParseAddrs 测试解析地址的标志和生存期
+func TestParseAddrs(t *testing.T) {
+	tab := append(newAddrMessage(2, net.ParseIP("2001:db8::1"), 64, syscall.IFA_F_TEMPORARY, 3600, 7200),
+		newAddrMessage(3, net.ParseIP("2001:db8::2"), 64, 0, 0, 0)...)
+	tab = append(tab, newAddrMessage(2, net.ParseIP("2001:db8::3"), 56, ifaFMngTmpAddr|syscall.IFA_F_DEPRECATED, infinityLifeTime, infinityLifeTime)...)
+
+	addrs, err := parseAddrs(tab, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("应只返回网卡 2 的地址，得到 %v", addrs)
+	}
+	if a := addrs[0]; a.IP.String() != "2001:db8::1" || !a.Temporary || a.PreferredLifetime != time.Hour || a.ValidLifetime != 2*time.Hour {
+		t.Errorf("第一个地址不正确：%s", a)
+	}
+	if a := addrs[1]; a.PrefixLen != 56 || !a.MngTmpAddr || !a.Deprecated || a.Temporary || a.PreferredLifetime != Forever {
+		t.Errorf("第二个地址不正确：%s", a)
+	}
+}
+
+// TestRelated 测试只通知与网卡有关的地址变化
+func TestRelated(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip(err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(append(
+		newAddrMessage(uint32(lo.Index), net.ParseIP("::1"), 128, 0, 0, 0),
+		newAddrMessage(uint32(lo.Index)+1000, net.ParseIP("2001:db8::1"), 64, 0, 0, 0)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !related(&msgs[0], "lo") || related(&msgs[1], "lo") {
+		t.Error("应只通知网卡 lo 的地址变化")
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package netinterface
+
+import (
+	"net"
+
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/internal/util"
+)
+
+// interfaceAddrs 其它系统只能得到地址, 没有标志和生存期
+func interfaceAddrs(name string, family iIPSource.Family) ([]Addr, error) {
+	ipv4, ipv6, err := util.GetNetInterface()
+	if err != nil {
+		return nil, err
+	}
+	interfaces := ipv4
+	if family == iIPSource.IPv6 {
+		interfaces = ipv6
+	}
+	var addrs []Addr
+	for _, netInterface := range interfaces {
+		if netInterface.Name != name {
+			continue
+		}
+		for _, s := range netInterface.Address {
+			addrs = append(addrs, Addr{IP: net.ParseIP(s), PreferredLifetime: Forever, ValidLifetime: Forever})
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,127 @@
+package netinterface
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net"
+	"strings"
+)
+
+const (
+	Type = "netInterface"
+)
+
+var (
+	ErrInterfaceNotConfigured = errors.New("network interface not configured")
+)
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// NetInterface 从网卡获取全局单播地址
+type NetInterface struct {
+	family iIPSource.Family
+	name   string
+	policy *Policy
+	match  string
+	// multi 返回按策略选出的所有地址
+	multi  bool
+	logger logger.ILogger
+}
+
+// New 创建, AddrPolicy 为地址的选择策略, IPv6Reg 为按策略排序后的匹配规则, MultiAddr 时返回所有选出的地址
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	if conf.NetInterface == "" {
+		return nil, ErrInterfaceNotConfigured
+	}
+	policy, err := ParsePolicy(conf.AddrPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &NetInterface{
+		family: family,
+		name:   conf.NetInterface,
+		policy: policy,
+		match:  conf.IPv6Reg,
+		multi:  conf.MultiAddr,
+		logger: log,
+	}, nil
+}
+
+func (n *NetInterface) String() string {
+	return Type
+}
+
+// GetAddr 获取网卡地址, Details 包含网卡上的所有地址及其标志
+func (n *NetInterface) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result := &iIPSource.Result{
+		Source:  Type + ":" + n.name,
+		Details: map[string]string{"interface": n.name},
+	}
+	addrs, err := interfaceAddrs(n.name, n.family)
+	if err != nil {
+		return result, fmt.Errorf("failed to get %s from network interface %s: %w", n.family, n.name, err)
+	}
+	var (
+		global []Addr
+		all    []string
+	)
+	for _, a := range addrs {
+		if isGlobalUnicast(a.IP, n.family) {
+			global = append(global, a)
+			all = append(all, a.String())
+		}
+	}
+	result.Details["addresses"] = strings.Join(all, ", ")
+
+	var selected []string
+	for _, a := range n.policy.Apply(global) {
+		selected = append(selected, a.IP.String())
+	}
+	if len(selected) < len(global) {
+		result.Details["selected"] = strings.Join(selected, ",")
+	}
+	if len(selected) == 0 {
+		return result, fmt.Errorf("failed to get %s from network interface %s: %w", n.family, n.name, ipsource.ErrAddrNotFound)
+	}
+	if n.multi {
+		result.Addr, result.Addrs = selected[0], selected
+		n.logger.Debugf("Got %s %s from network interface %s", n.family, strings.Join(selected, ","), n.name)
+		return result, nil
+	}
+	if n.match != "" {
+		result.Details["match"] = n.match
+	}
+	result.Addr, err = ipsource.SelectAddr(selected, n.match)
+	if err != nil {
+		return result, err
+	}
+	n.logger.Debugf("Got %s %s from network interface %s", n.family, result.Addr, n.name)
+	return result, nil
+}
+
+// Watch 监听网卡的地址和状态变化, 只支持 Linux
+func (n *NetInterface) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return watch(ctx, n.name, n.family, n.logger)
+}
+
+// ipv6Unicast https://en.wikipedia.org/wiki/IPv6_address#General_allocation
+var _, ipv6Unicast, _ = net.ParseCIDR("2000::/3")
+
+// isGlobalUnicast 与 util.GetNetInterface 相同, IPv6 需为 2000::/3 中的地址
+func isGlobalUnicast(ip net.IP, family iIPSource.Family) bool {
+	if !ip.IsGlobalUnicast() {
+		return false
+	}
+	if family == iIPSource.IPv6 {
+		return ip.To4() == nil && ipv6Unicast.Contains(ip)
+	}
+	return ip.To4() != nil
+}
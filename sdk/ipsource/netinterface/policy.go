@@ -0,0 +1,157 @@
+package netinterface
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Forever 永久有效的地址的生存期
+const Forever = time.Duration(math.MaxInt64)
+
+// 选择策略
+const (
+	ExcludeTemporary               = "exclude-temporary"
+	ExcludeDeprecated              = "exclude-deprecated"
+	PreferStable                   = "prefer-stable"
+	PreferEUI64                    = "prefer-eui64"
+	PreferLongestPreferredLifetime = "prefer-longest-preferred-lifetime"
+	MatchPrefix                    = "match-prefix"
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid address policy")
+)
+
+// Addr 网卡上的地址, 非 Linux 系统没有标志和生存期
+type Addr struct {
+	IP        net.IP
+	PrefixLen int
+	// Temporary 隐私扩展生成的临时地址
+	Temporary bool
+	// MngTmpAddr 用于生成临时地址的稳定地址
+	MngTmpAddr bool
+	Deprecated bool
+	DADFailed  bool
+	Tentative  bool
+	// PreferredLifetime/ValidLifetime 剩余的生存期, 未知或永久时为 Forever
+	PreferredLifetime time.Duration
+	ValidLifetime     time.Duration
+}
+
+func (a Addr) String() string {
+	s := a.IP.String()
+	if a.PrefixLen > 0 {
+		s = fmt.Sprintf("%s/%d", s, a.PrefixLen)
+	}
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{a.Temporary, "temporary"},
+		{a.MngTmpAddr, "mngtmpaddr"},
+		{a.Deprecated, "deprecated"},
+		{a.DADFailed, "dadfailed"},
+		{a.Tentative, "tentative"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	if len(flags) > 0 {
+		s += " " + strings.Join(flags, ",")
+	}
+	if a.PreferredLifetime != Forever {
+		s += fmt.Sprintf(" preferred %s", a.PreferredLifetime)
+	}
+	return s
+}
+
+// EUI64 接口标识是否由 MAC 地址生成 (第 11、12 字节为 ff:fe)
+func (a Addr) EUI64() bool {
+	ip := a.IP.To16()
+	return a.IP.To4() == nil && ip != nil && ip[11] == 0xff && ip[12] == 0xfe
+}
+
+// Policy 地址选择策略, 先过滤再按偏好排序
+type Policy struct {
+	excludeTemporary  bool
+	excludeDeprecated bool
+	prefixes          []*net.IPNet
+	// prefers 按优先级排列, 返回 a 是否优于 b
+	prefers []func(a, b Addr) bool
+}
+
+// ParsePolicy 解析以逗号分隔的策略, 如 exclude-temporary,prefer-eui64,match-prefix=2001:db8::/48
+// prefer-* 按书写顺序决定优先级, 多个 match-prefix 匹配其中之一即可
+func ParsePolicy(s string) (*Policy, error) {
+	p := &Policy{}
+	for _, item := range strings.Split(s, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch strings.ToLower(name) {
+		case "":
+		case ExcludeTemporary:
+			p.excludeTemporary = true
+		case ExcludeDeprecated:
+			p.excludeDeprecated = true
+		case PreferStable:
+			p.prefers = append(p.prefers, func(a, b Addr) bool { return !a.Temporary && b.Temporary })
+		case PreferEUI64:
+			p.prefers = append(p.prefers, func(a, b Addr) bool { return a.EUI64() && !b.EUI64() })
+		case PreferLongestPreferredLifetime:
+			p.prefers = append(p.prefers, func(a, b Addr) bool { return a.PreferredLifetime > b.PreferredLifetime })
+		case MatchPrefix:
+			_, prefix, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidPolicy, err)
+			}
+			p.prefixes = append(p.prefixes, prefix)
+		default:
+			return nil, fmt.Errorf("%w: unknown %q", ErrInvalidPolicy, item)
+		}
+	}
+	return p, nil
+}
+
+// Apply 返回过滤并排序后的地址, DAD 失败和尚未完成 DAD 的地址总是被排除
+func (p *Policy) Apply(addrs []Addr) []Addr {
+	var selected []Addr
+	for _, a := range addrs {
+		if a.DADFailed || a.Tentative ||
+			(p.excludeTemporary && a.Temporary) ||
+			(p.excludeDeprecated && a.Deprecated) ||
+			!p.matchPrefix(a.IP) {
+			continue
+		}
+		selected = append(selected, a)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		for _, prefer := range p.prefers {
+			if prefer(selected[i], selected[j]) {
+				return true
+			}
+			if prefer(selected[j], selected[i]) {
+				return false
+			}
+		}
+		return false
+	})
+	return selected
+}
+
+func (p *Policy) matchPrefix(ip net.IP) bool {
+	if len(p.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
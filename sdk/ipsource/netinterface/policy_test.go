@@ -0,0 +1,56 @@
+package netinterface
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestPolicyApply 测试地址的过滤和排序
+func TestPolicyApply(t *testing.T) {
+	addrs := []Addr{
+		{IP: net.ParseIP("2001:db8:1::aaaa"), Temporary: true, PreferredLifetime: time.Hour},
+		{IP: net.ParseIP("2001:db8:1:0:211:22ff:fe33:4455"), MngTmpAddr: true, PreferredLifetime: 2 * time.Hour},
+		{IP: net.ParseIP("2001:db8:1::bbbb"), Deprecated: true, PreferredLifetime: 0},
+		{IP: net.ParseIP("2001:db8:2::1"), PreferredLifetime: Forever},
+		{IP: net.ParseIP("2001:db8:1::cccc"), DADFailed: true, PreferredLifetime: Forever},
+	}
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{"", []string{"2001:db8:1::aaaa", "2001:db8:1:0:211:22ff:fe33:4455", "2001:db8:1::bbbb", "2001:db8:2::1"}},
+		{"exclude-temporary,exclude-deprecated", []string{"2001:db8:1:0:211:22ff:fe33:4455", "2001:db8:2::1"}},
+		{"prefer-stable", []string{"2001:db8:1:0:211:22ff:fe33:4455", "2001:db8:1::bbbb", "2001:db8:2::1", "2001:db8:1::aaaa"}},
+		{"prefer-eui64,prefer-longest-preferred-lifetime", []string{"2001:db8:1:0:211:22ff:fe33:4455", "2001:db8:2::1", "2001:db8:1::aaaa", "2001:db8:1::bbbb"}},
+		{"match-prefix=2001:db8:2::/48, match-prefix=2001:db8:1::/48, exclude-temporary", []string{"2001:db8:1:0:211:22ff:fe33:4455", "2001:db8:1::bbbb", "2001:db8:2::1"}},
+		{"match-prefix=2001:db8:3::/48", nil},
+	}
+	for _, tt := range tests {
+		policy, err := ParsePolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range policy.Apply(addrs) {
+			got = append(got, a.IP.String())
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q 期待 %v，得到 %v", tt.policy, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q 期待 %v，得到 %v", tt.policy, tt.want, got)
+				break
+			}
+		}
+	}
+
+	for _, policy := range []string{"prefer-newest", "match-prefix=2001:db8::"} {
+		if _, err := ParsePolicy(policy); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%q 期待 ErrInvalidPolicy，得到 %v", policy, err)
+		}
+	}
+}
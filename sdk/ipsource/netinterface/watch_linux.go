@@ -0,0 +1,107 @@
+package netinterface
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+)
+
+// rtnetlink 的多播组, syscall 中没有定义
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// watch 订阅 rtnetlink 的地址和链路变化, 只通知与网卡 name 有关的消息
+func watch(ctx context.Context, name string, family iIPSource.Family, log logger.ILogger) (<-chan struct{}, error) {
+	groups := uint32(rtmgrpLink | rtmgrpIPv4IfAddr)
+	if family == iIPSource.IPv6 {
+		groups = rtmgrpLink | rtmgrpIPv6IfAddr
+	}
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// 非阻塞的 fd 由 runtime 轮询, Close 可以中止 Read
+	f := os.NewFile(uintptr(fd), "netlink")
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		_ = f.Close()
+	}()
+	go func() {
+		buf := make([]byte, os.Getpagesize()*4)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, os.ErrClosed) {
+					log.Warnf("Stopped watching network interface %s: %s", name, err)
+				}
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for i := range msgs {
+				if !related(&msgs[i], name) {
+					continue
+				}
+				log.Debugf("Network interface %s changed", name)
+				// 尚未处理的通知合并为一次
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+				break
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// related 消息是否与网卡 name 有关, PPP 等网卡重建后 index 会变化, 每次按名称查找
+func related(m *syscall.NetlinkMessage, name string) bool {
+	switch m.Header.Type {
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(m.Data) < syscall.SizeofIfAddrmsg {
+			return false
+		}
+		ifa := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		iface, err := net.InterfaceByName(name)
+		// 网卡已删除时仍通知, 以便发现地址失效
+		return err != nil || int(ifa.Index) == iface.Index
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		attrs, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			return false
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type == syscall.IFLA_IFNAME {
+				return string(trimNull(attr.Value)) == name
+			}
+		}
+	}
+	return false
+}
+
+func trimNull(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
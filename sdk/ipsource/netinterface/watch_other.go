@@ -0,0 +1,17 @@
+//go:build !linux
+
+package netinterface
+
+import (
+	"context"
+	"fmt"
+
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+)
+
+// watch 其它系统不支持, 只能定时获取
+func watch(_ context.Context, name string, _ iIPSource.Family, _ logger.ILogger) (<-chan struct{}, error) {
+	return nil, fmt.Errorf("%w: network interface %s", ipsource.ErrWatchNotSupported, name)
+}
@@ -0,0 +1,184 @@
+package pcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/ipsource/gateway"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	Type    = "pcp"
+	Port    = 5351
+	Version = 2
+
+	opAnnounce = 0
+	opMap      = 1
+	headerSize = 24
+	mapSize    = 36
+	protoUDP   = 17
+	// MapLifetime 获取地址时创建的临时映射的有效期, 获取后立即删除
+	MapLifetime = 60
+)
+
+// 重传参数, RFC 6887 8.1.1 的初始超时为3秒, 这里使用与 NAT-PMP 相同的较短间隔
+const (
+	DefaultRTO = 250 * time.Millisecond
+	Attempts   = 4
+)
+
+// resultCodes RFC 6887 7.4 的结果码
+var resultCodes = map[byte]string{
+	1:  "UNSUPP_VERSION",
+	2:  "NOT_AUTHORIZED",
+	3:  "MALFORMED_REQUEST",
+	4:  "UNSUPP_OPCODE",
+	5:  "UNSUPP_OPTION",
+	6:  "MALFORMED_OPTION",
+	7:  "NETWORK_FAILURE",
+	8:  "NO_RESOURCES",
+	9:  "UNSUPP_PROTOCOL",
+	10: "USER_EX_QUOTA",
+	11: "CANNOT_PROVIDE_EXTERNAL",
+	12: "ADDRESS_MISMATCH",
+	13: "EXCESSIVE_REMOTE_PEERS",
+}
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// PCP 先用 ANNOUNCE 确认网关支持 PCP, 再创建临时的 MAP 映射得到外部地址, 只支持IPv4
+type PCP struct {
+	gateway string
+	port    int
+	rto     time.Duration
+	logger  logger.ILogger
+}
+
+// New 创建, Gateway 为空时自动检测默认网关
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	if family != iIPSource.IPv4 {
+		return nil, fmt.Errorf("%w: %s %s", ipsource.ErrFamilyNotSupported, Type, family)
+	}
+	return &PCP{gateway: conf.Gateway, port: Port, rto: DefaultRTO, logger: log}, nil
+}
+
+func (p *PCP) String() string {
+	return Type
+}
+
+// GetAddr 获取外部地址
+func (p *PCP) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result := &iIPSource.Result{Details: make(map[string]string)}
+	gw, err := gateway.Resolve(p.gateway)
+	if err != nil {
+		result.Details["gateway"] = err.Error()
+		return result, fmt.Errorf("failed to get IPv4 from pcp: %w", err)
+	}
+	server := net.JoinHostPort(gw.String(), strconv.Itoa(p.port))
+	result.Source = Type + ":" + server
+	ip, err := p.externalAddr(ctx, server)
+	if err != nil {
+		p.logger.Debugf("Failed to get IPv4 from PCP server %s: %s", server, err)
+		result.Details[server] = err.Error()
+		return result, fmt.Errorf("failed to get IPv4 from pcp: %w", err)
+	}
+	result.Addr = ip.String()
+	return result, nil
+}
+
+func (p *PCP) externalAddr(ctx context.Context, server string) (net.IP, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr)
+
+	if _, err = p.request(ctx, conn, opAnnounce, 0, header(opAnnounce, 0, local.IP), Attempts); err != nil {
+		return nil, fmt.Errorf("announce: %w", err)
+	}
+
+	var nonce [12]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	resp, err := p.request(ctx, conn, opMap, mapSize, mapRequest(MapLifetime, local, nonce), Attempts)
+	if err != nil {
+		return nil, fmt.Errorf("map: %w", err)
+	}
+	ip := net.IP(append([]byte(nil), resp[headerSize+20:headerSize+36]...))
+	// 删除临时映射, 失败时等待其过期
+	_, _ = p.request(ctx, conn, opMap, mapSize, mapRequest(0, local, nonce), 1)
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("external address %s is not IPv4", ip)
+	}
+	return ip.To4(), nil
+}
+
+// header 请求头, 客户端地址使用 IPv4 映射的 IPv6 地址
+func header(op byte, lifetime uint32, client net.IP) []byte {
+	b := make([]byte, headerSize)
+	b[0] = Version
+	b[1] = op
+	binary.BigEndian.PutUint32(b[4:], lifetime)
+	copy(b[8:], client.To16())
+	return b
+}
+
+func mapRequest(lifetime uint32, local *net.UDPAddr, nonce [12]byte) []byte {
+	b := header(opMap, lifetime, local.IP)
+	payload := make([]byte, mapSize)
+	copy(payload, nonce[:])
+	payload[12] = protoUDP
+	binary.BigEndian.PutUint16(payload[16:], uint16(local.Port))
+	// 不建议外部端口和地址
+	copy(payload[20:], net.IPv4zero.To16())
+	return append(b, payload...)
+}
+
+// request 发送请求, 返回操作码匹配的成功响应, MAP 请求的 nonce 也要匹配
+func (p *PCP) request(ctx context.Context, conn net.Conn, op byte, payloadSize int, req []byte, attempts int) ([]byte, error) {
+	var resp []byte
+	err := gateway.Exchange(ctx, conn, req, p.rto, attempts, func(b []byte) (bool, error) {
+		if len(b) < headerSize || b[1] != 0x80|op {
+			return false, nil
+		}
+		if err := resultErr(b); err != nil {
+			return true, err
+		}
+		if len(b) < headerSize+payloadSize ||
+			(payloadSize > 0 && string(b[headerSize:headerSize+12]) != string(req[headerSize:headerSize+12])) {
+			return false, nil
+		}
+		resp = append([]byte(nil), b...)
+		return true, nil
+	})
+	return resp, err
+}
+
+// resultErr 响应的错误, 只支持 NAT-PMP 的网关返回版本 0 和 UNSUPP_VERSION
+func resultErr(b []byte) error {
+	if code := b[3]; code != 0 {
+		msg, ok := resultCodes[code]
+		if !ok {
+			msg = "result code " + strconv.Itoa(int(code))
+		}
+		return fmt.Errorf("pcp: %s", msg)
+	}
+	if b[0] != Version {
+		return fmt.Errorf("pcp: unsupported version %d", b[0])
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pcp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// TestPCPGetAddr 测试 ANNOUNCE、MAP 和删除映射
+func TestPCPGetAddr(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	lifetimes := make(chan uint32, 3)
+	go func() {
+		buf := make([]byte, 1100)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			if req[0] != Version || net.IP(req[8:24]).String() != "127.0.0.1" {
+				t.Errorf("请求头不正确：%v", req[:headerSize])
+				continue
+			}
+			resp := make([]byte, n)
+			copy(resp, req)
+			resp[1] |= 0x80
+			copy(resp[8:], make([]byte, 16))
+			if req[1] == opMap {
+				lifetimes <- binary.BigEndian.Uint32(req[4:])
+				copy(resp[headerSize+20:], net.ParseIP("203.0.113.7").To16())
+				// 先回复其它 nonce 的响应
+				other := append([]byte(nil), resp...)
+				other[headerSize] ^= 0xff
+				_, _ = conn.WriteTo(other, addr)
+			}
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{Gateway: "127.0.0.1"}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := source.(*PCP)
+	p.port = conn.LocalAddr().(*net.UDPAddr).Port
+	p.rto = 10 * time.Millisecond
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err, result.Details)
+	}
+	if result.Addr != "203.0.113.7" {
+		t.Errorf("结果不正确：%+v", result)
+	}
+	if l := <-lifetimes; l != MapLifetime {
+		t.Errorf("映射的有效期应为 %d，得到 %d", MapLifetime, l)
+	}
+	if l := <-lifetimes; l != 0 {
+		t.Errorf("获取地址后应删除映射，得到有效期 %d", l)
+	}
+}
+
+// TestResultErr 测试只支持 NAT-PMP 的网关
+func TestResultErr(t *testing.T) {
+	if err := resultErr([]byte{0, 0x80, 0, 1}); err == nil || err.Error() != "pcp: UNSUPP_VERSION" {
+		t.Errorf("期待 UNSUPP_VERSION，得到 %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package stun
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// RFC 5389/8489 的消息格式
+const (
+	headerSize  = 20
+	magicCookie = 0x2112A442
+
+	typeBindingRequest  = 0x0001
+	typeBindingSuccess  = 0x0101
+	typeBindingError    = 0x0111
+	attrMappedAddress   = 0x0001
+	attrErrorCode       = 0x0009
+	attrXorMappedAddr   = 0x0020
+	familyIPv4          = 0x01
+	familyIPv6          = 0x02
+	transactionIDLength = 12
+)
+
+var (
+	ErrInvalidMessage = errors.New("stun: invalid message")
+	ErrNoMappedAddr   = errors.New("stun: no mapped address in response")
+)
+
+type transactionID [transactionIDLength]byte
+
+func newTransactionID() (id transactionID, err error) {
+	_, err = rand.Read(id[:])
+	return
+}
+
+// bindingRequest 不带属性的 Binding 请求
+func bindingRequest(id transactionID) []byte {
+	b := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(b[0:], typeBindingRequest)
+	binary.BigEndian.PutUint32(b[4:], magicCookie)
+	copy(b[8:], id[:])
+	return b
+}
+
+// parseResponse 解析 Binding 响应, 返回映射的地址
+// 不是该事务的响应时 ok 为 false, 应继续等待
+func parseResponse(b []byte, id transactionID) (ip net.IP, ok bool, err error) {
+	if len(b) < headerSize || b[0]&0xc0 != 0 || binary.BigEndian.Uint32(b[4:]) != magicCookie {
+		return nil, false, nil
+	}
+	if [transactionIDLength]byte(b[8:headerSize]) != id {
+		return nil, false, nil
+	}
+	typ := binary.BigEndian.Uint16(b[0:])
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length%4 != 0 || headerSize+length > len(b) {
+		return nil, true, ErrInvalidMessage
+	}
+
+	var mapped net.IP
+	attrs := b[headerSize : headerSize+length]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+attrLen > len(attrs) {
+			return nil, true, ErrInvalidMessage
+		}
+		value := attrs[4 : 4+attrLen]
+		switch attrType {
+		case attrXorMappedAddr:
+			if ip, err = decodeAddr(value, b[4:headerSize]); err != nil {
+				return nil, true, err
+			}
+			if typ == typeBindingSuccess {
+				return ip, true, nil
+			}
+		case attrMappedAddress:
+			// RFC 3489 的服务器只返回 MAPPED-ADDRESS
+			if mapped, err = decodeAddr(value, nil); err != nil {
+				return nil, true, err
+			}
+		case attrErrorCode:
+			if typ == typeBindingError && len(value) >= 4 {
+				code := int(value[2]&0x7)*100 + int(value[3])
+				return nil, true, fmt.Errorf("stun: error response %d %s", code, value[4:])
+			}
+		}
+		// 属性按4字节对齐
+		attrs = attrs[4+(attrLen+3)&^3:]
+	}
+	if typ != typeBindingSuccess {
+		return nil, true, fmt.Errorf("stun: unexpected message type %#04x", typ)
+	}
+	if mapped == nil {
+		return nil, true, ErrNoMappedAddr
+	}
+	return mapped, true, nil
+}
+
+// decodeAddr 解析地址属性, xor 为 magic cookie 和事务ID, 为空时不做异或
+func decodeAddr(v []byte, xor []byte) (net.IP, error) {
+	if len(v) < 4 {
+		return nil, ErrInvalidMessage
+	}
+	var size int
+	switch v[1] {
+	case familyIPv4:
+		size = net.IPv4len
+	case familyIPv6:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("%w: address family %d", ErrInvalidMessage, v[1])
+	}
+	if len(v) < 4+size {
+		return nil, ErrInvalidMessage
+	}
+	ip := make(net.IP, size)
+	copy(ip, v[4:4+size])
+	if xor != nil {
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	return ip, nil
+}
@@ -0,0 +1,159 @@
+package stun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	Type        = "stun"
+	DefaultPort = "3478"
+	// DefaultServers 未配置服务器时使用
+	DefaultServers = "stun.cloudflare.com:3478,stun.l.google.com:19302"
+)
+
+// RFC 5389 7.2.1 的重传参数
+const (
+	DefaultRTO = 500 * time.Millisecond
+	// Rc 最多发送请求的次数
+	Rc = 7
+	// Rm 最后一次请求后等待 Rm 倍的初始 RTO
+	Rm = 16
+)
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// STUN 依次向每个 STUN 服务器发送 Binding 请求, 使用响应中的映射地址
+type STUN struct {
+	family  iIPSource.Family
+	servers []string
+	// dialer 发起连接的网卡或源地址
+	dialer *ipsource.Dialer
+	// rto 初始重传超时
+	rto    time.Duration
+	logger logger.ILogger
+}
+
+// New 创建, 多个服务器以逗号分隔, 未指定端口时使用 3478, BindInterface/BindAddr 指定请求的出口网卡或源地址
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	servers := conf.STUN
+	if strings.TrimSpace(servers) == "" {
+		servers = DefaultServers
+	}
+	dialer, err := ipsource.NewDialer(family, conf)
+	if err != nil {
+		return nil, err
+	}
+	s := &STUN{family: family, dialer: dialer, rto: DefaultRTO, logger: log}
+	for _, server := range strings.Split(servers, ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), DefaultPort)
+		}
+		s.servers = append(s.servers, server)
+	}
+	return s, nil
+}
+
+func (s *STUN) String() string {
+	return Type
+}
+
+// GetAddr 返回第一个响应的服务器得到的地址, Details 记录之前每个服务器失败的原因
+func (s *STUN) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result := &iIPSource.Result{Details: make(map[string]string)}
+	if bind := s.dialer.String(); bind != "" {
+		result.Details["bind"] = bind
+	}
+	for _, server := range s.servers {
+		ip, err := s.binding(ctx, server)
+		if err != nil {
+			s.logger.Debugf("Failed to get %s from stun server %s: %s", s.family, server, err)
+			result.Details[server] = err.Error()
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		result.Addr = ip.String()
+		result.Source = Type + ":" + server
+		return result, nil
+	}
+	return result, fmt.Errorf("failed to get %s from stun: %w", s.family, ipsource.ErrAddrNotFound)
+}
+
+// binding 发送 Binding 请求并按 RTO 重传, 直到收到响应
+func (s *STUN) binding(ctx context.Context, server string) (net.IP, error) {
+	conn, err := s.dialer.DialContext(ctx, ipsource.UDPNetwork(s.family), server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// ctx 取消时中止读取
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	id, err := newTransactionID()
+	if err != nil {
+		return nil, err
+	}
+	req := bindingRequest(id)
+	buf := make([]byte, 1500)
+	rto := s.rto
+	for i := 0; i < Rc; i++ {
+		if _, err = conn.Write(req); err != nil {
+			return nil, err
+		}
+		wait := rto
+		if i == Rc-1 {
+			wait = s.rto * Rm
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, err
+			}
+			ip, ok, err := parseResponse(buf[:n], id)
+			if !ok {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if (ip.To4() != nil) != (s.family == iIPSource.IPv4) {
+				return nil, fmt.Errorf("mapped address %s is not %s", ip, s.family)
+			}
+			return ip, nil
+		}
+		rto *= 2
+	}
+	return nil, fmt.Errorf("no response after %d requests", Rc)
+}
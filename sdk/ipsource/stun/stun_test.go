@@ -0,0 +1,100 @@
+package stun
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// response 构造带 XOR-MAPPED-ADDRESS 的成功响应
+func response(req []byte, ip net.IP) []byte {
+	family, addr := byte(familyIPv6), ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		family, addr = familyIPv4, ip4
+	}
+	value := append([]byte{0, family, 0, 0}, addr...)
+	for i := range addr {
+		value[4+i] ^= req[4+i]
+	}
+	b := make([]byte, headerSize+4, headerSize+4+len(value))
+	binary.BigEndian.PutUint16(b[0:], typeBindingSuccess)
+	binary.BigEndian.PutUint16(b[2:], uint16(4+len(value)))
+	copy(b[4:headerSize], req[4:headerSize])
+	binary.BigEndian.PutUint16(b[headerSize:], attrXorMappedAddr)
+	binary.BigEndian.PutUint16(b[headerSize+2:], uint16(len(value)))
+	return append(b, value...)
+}
+
+// TestSTUNGetAddr 测试重传和忽略其它事务的响应
+func TestSTUNGetAddr(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for i := 0; ; i++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// 丢弃第一个请求, 测试重传
+			if i == 0 {
+				continue
+			}
+			other := append([]byte(nil), buf[:n]...)
+			other[8] ^= 0xff
+			_, _ = conn.WriteTo(response(other, net.ParseIP("198.51.100.1")), addr)
+			_, _ = conn.WriteTo(response(buf[:n], net.ParseIP("203.0.113.7")), addr)
+		}
+	}()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{STUN: "127.0.0.1:1, " + conn.LocalAddr().String()}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.(*STUN).rto = 10 * time.Millisecond
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "203.0.113.7" || result.Source != Type+":"+conn.LocalAddr().String() {
+		t.Errorf("结果不正确：%+v", result)
+	}
+	if result.Details["127.0.0.1:1"] == "" {
+		t.Errorf("期待记录失败的服务器，得到 %v", result.Details)
+	}
+}
+
+// TestParseResponse 测试解析 IPv6 和错误响应
+func TestParseResponse(t *testing.T) {
+	id, _ := newTransactionID()
+	req := bindingRequest(id)
+	ip, ok, err := parseResponse(response(req, net.ParseIP("2001:db8::1")), id)
+	if !ok || err != nil || ip.String() != "2001:db8::1" {
+		t.Errorf("解析 IPv6 响应失败：%s %v %v", ip, ok, err)
+	}
+
+	if _, ok, _ = parseResponse(response(req, net.ParseIP("2001:db8::1")), transactionID{}); ok {
+		t.Error("其它事务的响应应被忽略")
+	}
+
+	errResp := append(bindingRequest(id), 0, attrErrorCode, 0, 8, 0, 0, 4, 20, 'B', 'a', 'd', '!')
+	binary.BigEndian.PutUint16(errResp[0:], typeBindingError)
+	binary.BigEndian.PutUint16(errResp[2:], 12)
+	if _, ok, err = parseResponse(errResp, id); !ok || err == nil {
+		t.Errorf("期待错误响应，得到 %v %v", ok, err)
+	}
+
+	source, _ := New(iIPSource.IPv6, &config.IPSource{STUN: "[2001:db8::2], stun.example.com"}, xlogger.Nop())
+	if servers := source.(*STUN).servers; servers[0] != "[2001:db8::2]:3478" || servers[1] != "stun.example.com:3478" {
+		t.Errorf("默认端口不正确：%v", servers)
+	}
+}
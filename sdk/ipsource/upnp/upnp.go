@@ -0,0 +1,279 @@
+package upnp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/internal/util"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/ipsource/gateway"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Type = "upnp"
+	// SSDPAddr SSDP 组播地址
+	SSDPAddr = "239.255.255.250:1900"
+	// DiscoverTimeout 等待 SSDP 响应的时间
+	DiscoverTimeout = 2 * time.Second
+	searchTarget    = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+)
+
+var (
+	ErrDeviceNotFound  = errors.New("upnp: internet gateway device not found")
+	ErrServiceNotFound = errors.New("upnp: WANIPConnection or WANPPPConnection service not found")
+)
+
+// serviceTypes 按优先级排列的 WAN 连接服务
+var serviceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// UPnP 通过 SSDP 发现路由器, 调用 WAN 连接服务的 GetExternalIPAddress 获取外部地址, 只支持IPv4
+type UPnP struct {
+	// gateway 路由器地址或设备描述的URL
+	gateway string
+	// ssdp SSDP 请求发送到的地址
+	ssdp   string
+	client *http.Client
+	logger logger.ILogger
+}
+
+// New 创建, Gateway 为设备描述的URL时不再发现设备, 为IP时只接受该路由器的响应
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	if family != iIPSource.IPv4 {
+		return nil, fmt.Errorf("%w: %s %s", ipsource.ErrFamilyNotSupported, Type, family)
+	}
+	return &UPnP{
+		gateway: conf.Gateway,
+		ssdp:    SSDPAddr,
+		client:  util.CreateNoProxyHTTPClient("tcp4"),
+		logger:  log,
+	}, nil
+}
+
+func (u *UPnP) String() string {
+	return Type
+}
+
+// GetAddr 获取外部地址, Details 记录设备描述和控制的URL
+func (u *UPnP) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	result := &iIPSource.Result{Details: make(map[string]string)}
+	fail := func(step string, err error) (*iIPSource.Result, error) {
+		u.logger.Debugf("Failed to get IPv4 from UPnP %s: %s", step, err)
+		result.Details[step] = err.Error()
+		return result, fmt.Errorf("failed to get IPv4 from upnp: %w", err)
+	}
+
+	location := u.gateway
+	if !strings.Contains(location, "://") {
+		var err error
+		if location, err = u.discover(ctx); err != nil {
+			return fail("discover", err)
+		}
+	}
+	result.Details["location"] = location
+	controlURL, serviceType, err := u.describe(ctx, location)
+	if err != nil {
+		return fail("describe", err)
+	}
+	result.Details["controlURL"] = controlURL
+	result.Source = Type + ":" + controlURL
+	ip, err := u.externalAddr(ctx, controlURL, serviceType)
+	if err != nil {
+		return fail("control", err)
+	}
+	result.Addr = ip
+	return result, nil
+}
+
+// discover 发送 M-SEARCH, 返回网关的设备描述URL
+// 未配置网关时优先使用默认网关的响应, 没有时使用第一个响应
+func (u *UPnP) discover(ctx context.Context) (string, error) {
+	var want net.IP
+	if u.gateway != "" {
+		var err error
+		if want, err = gateway.Resolve(u.gateway); err != nil {
+			return "", err
+		}
+	} else {
+		want, _ = gateway.Detect()
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	dst, err := net.ResolveUDPAddr("udp4", u.ssdp)
+	if err != nil {
+		return "", err
+	}
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + SSDPAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + searchTarget + "\r\n\r\n"
+	if _, err = conn.WriteTo([]byte(req), dst); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(DiscoverTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+	var first string
+	buf := make([]byte, 2048)
+	for ctx.Err() == nil {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" {
+			continue
+		}
+		if want == nil || from.(*net.UDPAddr).IP.Equal(want) {
+			return location, nil
+		}
+		// 配置了网关时只接受该网关的响应
+		if first == "" && u.gateway == "" {
+			first = location
+		}
+	}
+	if first != "" {
+		return first, nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return "", ErrDeviceNotFound
+}
+
+type device struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []device `xml:"deviceList>device"`
+}
+
+// find 在设备及其子设备中查找服务的控制URL
+func (d *device) find(serviceType string) string {
+	for _, s := range d.Services {
+		if s.ServiceType == serviceType {
+			return s.ControlURL
+		}
+	}
+	for i := range d.Devices {
+		if controlURL := d.Devices[i].find(serviceType); controlURL != "" {
+			return controlURL
+		}
+	}
+	return ""
+}
+
+// describe 读取设备描述, 返回 WAN 连接服务的控制URL和服务类型
+func (u *UPnP) describe(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("device description: %s", resp.Status)
+	}
+	var root struct {
+		URLBase string `xml:"URLBase"`
+		Device  device `xml:"device"`
+	}
+	if err = xml.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return "", "", fmt.Errorf("device description: %w", err)
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if root.URLBase != "" {
+		if base, err = base.Parse(root.URLBase); err != nil {
+			return "", "", err
+		}
+	}
+	for _, serviceType := range serviceTypes {
+		if controlURL := root.Device.find(serviceType); controlURL != "" {
+			ref, err := base.Parse(controlURL)
+			if err != nil {
+				return "", "", err
+			}
+			return ref.String(), serviceType, nil
+		}
+	}
+	return "", "", ErrServiceNotFound
+}
+
+// externalAddr 调用 GetExternalIPAddress
+func (u *UPnP) externalAddr(ctx context.Context, controlURL, serviceType string) (string, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"></u:GetExternalIPAddress></s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var envelope struct {
+		Addr  string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+		Error struct {
+			Code        int    `xml:"errorCode"`
+			Description string `xml:"errorDescription"`
+		} `xml:"Body>Fault>detail>UPnPError"`
+	}
+	if err = xml.Unmarshal(data, &envelope); err != nil {
+		return "", fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: UPnP error %d %s", resp.Status, envelope.Error.Code, envelope.Error.Description)
+	}
+	ip := net.ParseIP(strings.TrimSpace(envelope.Addr))
+	if ip == nil || ip.To4() == nil || ip.IsUnspecified() {
+		return "", fmt.Errorf("invalid external address %q", envelope.Addr)
+	}
+	return ip.String(), nil
+}
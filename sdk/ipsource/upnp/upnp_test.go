@@ -0,0 +1,115 @@
+package upnp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+const description = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+func newRouter(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootDesc.xml":
+			fmt.Fprint(w, description)
+		case "/ctl/IPConn":
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` ||
+				!strings.Contains(string(body), "GetExternalIPAddress") {
+				t.Errorf("SOAP 请求不正确：%s %s", r.Header.Get("SOAPAction"), body)
+			}
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+				`<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewExternalIPAddress>203.0.113.7</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// TestUPnPGetAddr 测试通过 SSDP 发现路由器并获取外部地址
+func TestUPnPGetAddr(t *testing.T) {
+	router := newRouter(t)
+	defer router.Close()
+	ssdp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ssdp.Close()
+	go func() {
+		buf := make([]byte, 2048)
+		n, addr, err := ssdp.ReadFrom(buf)
+		if err != nil || !strings.Contains(string(buf[:n]), "ssdp:discover") {
+			return
+		}
+		_, _ = ssdp.WriteTo([]byte("HTTP/1.1 200 OK\r\nST: "+searchTarget+"\r\nLOCATION: "+router.URL+"/rootDesc.xml\r\n\r\n"), addr)
+	}()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{Gateway: "127.0.0.1"}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.(*UPnP).ssdp = ssdp.LocalAddr().String()
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err, result.Details)
+	}
+	if result.Addr != "203.0.113.7" || result.Source != Type+":"+router.URL+"/ctl/IPConn" {
+		t.Errorf("结果不正确：%+v", result)
+	}
+}
+
+// TestUPnPFault 测试设备描述的URL和 SOAP 错误
+func TestUPnPFault(t *testing.T) {
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rootDesc.xml" {
+			fmt.Fprint(w, description)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><detail>`+
+			`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>501</errorCode><errorDescription>Action Failed</errorDescription></UPnPError>`+
+			`</detail></s:Fault></s:Body></s:Envelope>`)
+	}))
+	defer router.Close()
+
+	source, _ := New(iIPSource.IPv4, &config.IPSource{Gateway: router.URL + "/rootDesc.xml"}, xlogger.Nop())
+	result, err := source.GetAddr(context.Background())
+	if err == nil || !strings.Contains(result.Details["control"], "501 Action Failed") {
+		t.Errorf("期待 UPnP 错误，得到 %v %v", err, result.Details)
+	}
+	if _, err = New(iIPSource.IPv6, &config.IPSource{}, xlogger.Nop()); err == nil {
+		t.Error("不应支持 IPv6")
+	}
+}
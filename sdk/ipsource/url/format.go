@@ -0,0 +1,85 @@
+package url
+
+import (
+	"errors"
+	"fmt"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/internal/util"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"regexp"
+	"strings"
+)
+
+// 响应格式
+const (
+	FormatPlain = "plain"
+	FormatJSON  = "json"
+	FormatKV    = "kv"
+	FormatRegex = "regex"
+	// GroupName regex 格式中地址的分组名称
+	GroupName = "ip"
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid url response format")
+)
+
+// parser 从响应中获取地址
+type parser func(family iIPSource.Family, body string) (string, error)
+
+// newParser 解析 plain、json:路径、kv:键 或 regex:表达式, 为空时查找第一个地址
+func newParser(format string) (parser, error) {
+	if format == "" {
+		return func(family iIPSource.Family, body string) (string, error) {
+			if addr := ipsource.FindAddr(family, body); addr != "" {
+				return ipsource.ParseAddr(family, addr)
+			}
+			return "", fmt.Errorf("%w in response: %q", ipsource.ErrAddrNotFound, util.Truncate(body, 64))
+		}, nil
+	}
+	kind, arg, _ := strings.Cut(format, ":")
+	switch strings.ToLower(kind) {
+	case FormatPlain:
+		return ipsource.ParseAddr, nil
+	case FormatJSON:
+		if arg == "" {
+			return nil, fmt.Errorf("%w: empty json path", ErrInvalidFormat)
+		}
+		return func(family iIPSource.Family, body string) (string, error) {
+			value, err := ipsource.LookupJSON([]byte(body), arg)
+			if err != nil {
+				return "", err
+			}
+			return ipsource.ParseAddr(family, value)
+		}, nil
+	case FormatKV:
+		if arg == "" {
+			return nil, fmt.Errorf("%w: empty key", ErrInvalidFormat)
+		}
+		return func(family iIPSource.Family, body string) (string, error) {
+			for _, line := range strings.Split(body, "\n") {
+				if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == arg {
+					return ipsource.ParseAddr(family, value)
+				}
+			}
+			return "", fmt.Errorf("%w: key %s not found", ipsource.ErrAddrNotFound, arg)
+		}, nil
+	case FormatRegex:
+		reg, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, err)
+		}
+		group := reg.SubexpIndex(GroupName)
+		if group < 0 {
+			return nil, fmt.Errorf("%w: %s has no group named %s", ErrInvalidFormat, arg, GroupName)
+		}
+		return func(family iIPSource.Family, body string) (string, error) {
+			match := reg.FindStringSubmatch(body)
+			if match == nil {
+				return "", fmt.Errorf("%w: no match for %s", ipsource.ErrAddrNotFound, reg)
+			}
+			return ipsource.ParseAddr(family, match[group])
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q, want plain, json:, kv: or regex:", ErrInvalidFormat, format)
+}
@@ -0,0 +1,376 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/internal/util"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"github.com/jxo-me/ddns/sdk/registry"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Type = "url"
+
+	PolicyFirst    = "first"
+	PolicyMajority = "majority"
+
+	DefaultTimeout = 10 * time.Second
+	// MaxStrikes 连续失败或与结果不一致的次数达到后暂时不再请求该URL
+	MaxStrikes = 3
+	// DropRounds 暂停请求的轮数, 之后重新尝试
+	DropRounds = 10
+)
+
+var (
+	ErrURLNotConfigured = errors.New("url not configured")
+	ErrInvalidPolicy    = errors.New("invalid url policy")
+	ErrNoConsensus      = errors.New("no consensus")
+)
+
+func init() {
+	registry.MustRegisterIPSource(Type, New)
+}
+
+// URL 并发请求所有URL, 按策略从返回内容中的地址选出结果
+type URL struct {
+	family iIPSource.Family
+	urls   []string
+	// bind 发起连接的网卡或源地址
+	bind string
+	// endpoints 每个URL的请求方式和响应格式
+	endpoints map[string]*endpoint
+	policy    string
+	// quorum 至少多少个URL返回相同地址, 为 0 时为过半数
+	quorum  int
+	timeout time.Duration
+	client  *http.Client
+	logger  logger.ILogger
+
+	mu      sync.Mutex
+	round   int
+	strikes map[string]int
+	dropped map[string]int // dropped 暂停请求到第几轮
+}
+
+// endpoint 单个URL的请求方式和响应格式
+type endpoint struct {
+	method string
+	header http.Header
+	body   string
+	parse  parser
+}
+
+// vote 单个URL的结果
+type vote struct {
+	url  string
+	addr string
+	err  error
+}
+
+// New 创建, URL 中多个URL以逗号分隔, 查找响应中的第一个地址; URLs 中的URL可以指定响应格式、请求方法和请求头
+// BindInterface/BindAddr 指定请求的出口网卡或源地址
+// URLPolicy 为 first(按顺序第一个有效的地址)、majority(过半数的URL一致) 或数字N(至少N个URL一致)
+func New(family iIPSource.Family, conf *config.IPSource, log logger.ILogger) (iIPSource.IIPSource, error) {
+	dialer, err := ipsource.NewDialer(family, conf)
+	if err != nil {
+		return nil, err
+	}
+	u := &URL{
+		family:    family,
+		endpoints: make(map[string]*endpoint),
+		bind:      dialer.String(),
+		policy:    strings.ToLower(strings.TrimSpace(conf.URLPolicy)),
+		timeout:   DefaultTimeout,
+		client:    dialer.HTTPClient(family),
+		logger:    log,
+		strikes:   make(map[string]int),
+		dropped:   make(map[string]int),
+	}
+	var sources []*config.URLSource
+	for _, url := range strings.Split(conf.URL, ",") {
+		sources = append(sources, &config.URLSource{URL: url})
+	}
+	sources = append(sources, conf.URLs...)
+	for _, source := range sources {
+		if source == nil || strings.TrimSpace(source.URL) == "" {
+			continue
+		}
+		url := strings.TrimSpace(source.URL)
+		if _, ok := u.endpoints[url]; ok {
+			continue
+		}
+		e, err := newEndpoint(source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		u.urls = append(u.urls, url)
+		u.endpoints[url] = e
+	}
+	urls := u.urls
+	if len(urls) == 0 {
+		return nil, ErrURLNotConfigured
+	}
+	switch u.policy {
+	case "":
+		u.policy = PolicyFirst
+	case PolicyFirst, PolicyMajority:
+	default:
+		n, err := strconv.Atoi(u.policy)
+		if err != nil || n < 1 || n > len(urls) {
+			return nil, fmt.Errorf("%w %q: first, majority or a number from 1 to %d", ErrInvalidPolicy, conf.URLPolicy, len(urls))
+		}
+		u.quorum = n
+	}
+	if conf.URLTimeout > 0 {
+		u.timeout = time.Duration(conf.URLTimeout) * time.Second
+	}
+	return u, nil
+}
+
+// newEndpoint 解析请求方法、请求头和响应格式
+func newEndpoint(source *config.URLSource) (*endpoint, error) {
+	e := &endpoint{
+		method: strings.ToUpper(strings.TrimSpace(source.Method)),
+		header: make(http.Header),
+		body:   source.Body,
+	}
+	if e.method == "" {
+		e.method = http.MethodGet
+	}
+	for _, line := range source.Headers {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q", line)
+		}
+		e.header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	var err error
+	if e.parse, err = newParser(strings.TrimSpace(source.Format)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (u *URL) String() string {
+	return Type
+}
+
+// GetAddr 并发请求URL并按策略选出地址, Details 记录每个URL返回的地址或失败原因
+func (u *URL) GetAddr(ctx context.Context) (*iIPSource.Result, error) {
+	urls := u.active()
+	votes := u.query(ctx, urls)
+
+	result := &iIPSource.Result{Details: make(map[string]string)}
+	for _, v := range votes {
+		if v.err != nil {
+			result.Details[v.url] = v.err.Error()
+		} else {
+			result.Details[v.url] = v.addr
+		}
+	}
+	if u.bind != "" {
+		result.Details["bind"] = u.bind
+	}
+	addr, voters, err := u.elect(urls, votes)
+	u.punish(votes, addr)
+	if err != nil {
+		u.logger.Warnf("Failed to get %s from url: %s, votes: %s", u.family, err, tally(votes))
+		return result, fmt.Errorf("failed to get %s from url: %w", u.family, err)
+	}
+	u.logger.Debugf("Got %s %s from url, votes: %s", u.family, addr, tally(votes))
+	result.Addr = addr
+	result.Source = Type + ":" + strings.Join(voters, ",")
+	return result, nil
+}
+
+// active 返回本轮要请求的URL, 暂停的URL过多时请求所有URL
+func (u *URL) active() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.round++
+	var urls []string
+	for _, url := range u.urls {
+		if u.dropped[url] < u.round {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) < u.quorum || len(urls) == 0 {
+		return u.urls
+	}
+	return urls
+}
+
+// query 并发请求, 按URL顺序返回结果
+// first 策略下得到按顺序第一个有效的地址后取消其余的请求, 未完成的URL不在结果中
+func (u *URL) query(ctx context.Context, urls []string) []vote {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		done  = make(chan int, len(urls))
+		votes = make([]vote, len(urls))
+	)
+	for i, url := range urls {
+		go func(i int, url string) {
+			reqCtx, reqCancel := context.WithTimeout(ctx, u.timeout)
+			defer reqCancel()
+			addr, err := u.request(reqCtx, url)
+			if err != nil {
+				u.logger.Debugf("Failed to get %s from %s: %s", u.family, url, err)
+			}
+			votes[i] = vote{url: url, addr: addr, err: err}
+			done <- i
+		}(i, url)
+	}
+
+	finished := make([]bool, len(urls))
+	for range urls {
+		finished[<-done] = true
+		if u.policy != PolicyFirst {
+			continue
+		}
+		// 之前的URL都已失败时, 第一个有效的地址即为结果
+		for i := range urls {
+			if !finished[i] {
+				break
+			}
+			if votes[i].err == nil {
+				cancel()
+				var completed []vote
+				for j := range urls {
+					if finished[j] {
+						completed = append(completed, votes[j])
+					}
+				}
+				return completed
+			}
+		}
+	}
+	return votes
+}
+
+// elect 按策略选出地址, 返回地址和投票给它的URL
+func (u *URL) elect(urls []string, votes []vote) (string, []string, error) {
+	counts := make(map[string][]string)
+	var order []string
+	for _, v := range votes {
+		if v.err != nil {
+			continue
+		}
+		if _, ok := counts[v.addr]; !ok {
+			order = append(order, v.addr)
+		}
+		counts[v.addr] = append(counts[v.addr], v.url)
+	}
+	if len(order) == 0 {
+		return "", nil, ipsource.ErrAddrNotFound
+	}
+	if u.policy == PolicyFirst {
+		for _, v := range votes {
+			if v.err == nil {
+				return v.addr, []string{v.url}, nil
+			}
+		}
+	}
+
+	// 得票最多的地址, 票数相同时没有结果
+	best, tie := order[0], false
+	for _, addr := range order[1:] {
+		switch n := len(counts[addr]); {
+		case n > len(counts[best]):
+			best, tie = addr, false
+		case n == len(counts[best]):
+			tie = true
+		}
+	}
+	need := u.quorum
+	if u.policy == PolicyMajority {
+		need = len(urls)/2 + 1
+	}
+	if tie || len(counts[best]) < need {
+		return "", nil, fmt.Errorf("%w: %s has %d of %d votes, need %d", ErrNoConsensus, best, len(counts[best]), len(urls), need)
+	}
+	return best, counts[best], nil
+}
+
+// punish 记录失败或与结果不一致的URL, 连续达到 MaxStrikes 次后暂停请求
+func (u *URL) punish(votes []vote, addr string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, v := range votes {
+		// 没有结果时无法判断谁不一致, 只记录失败
+		if v.err == nil && (addr == "" || v.addr == addr) {
+			u.strikes[v.url] = 0
+			continue
+		}
+		if errors.Is(v.err, context.Canceled) {
+			continue
+		}
+		u.strikes[v.url]++
+		if u.strikes[v.url] >= MaxStrikes {
+			u.logger.Warnf("Dropping %s for %d rounds after %d failed or disagreeing responses", v.url, DropRounds, u.strikes[v.url])
+			u.dropped[v.url] = u.round + DropRounds
+			u.strikes[v.url] = 0
+		}
+	}
+}
+
+// tally 每个地址及投票给它的URL, 用于日志
+func tally(votes []vote) string {
+	counts := make(map[string][]string)
+	for _, v := range votes {
+		key := v.addr
+		if v.err != nil {
+			key = "failed"
+		}
+		counts[key] = append(counts[key], v.url)
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+" <- "+strings.Join(counts[k], ","))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (u *URL) request(ctx context.Context, url string) (string, error) {
+	e := u.endpoints[url]
+	var body io.Reader
+	if e.body != "" {
+		body = strings.NewReader(e.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, e.method, url, body)
+	if err != nil {
+		return "", err
+	}
+	for key, values := range e.header {
+		req.Header[key] = values
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("%s: %q", resp.Status, util.Truncate(string(data), 64))
+	}
+	return e.parse(u.family, string(data))
+}
@@ -0,0 +1,159 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+// TestURLGetAddr 测试第一个URL失败时使用下一个URL
+func TestURLGetAddr(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "no address")
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "当前 IP：1.2.3.4")
+	}))
+	defer good.Close()
+
+	source, err := New(iIPSource.IPv4, &config.IPSource{URL: bad.URL + ", " + good.URL}, xlogger.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "1.2.3.4" || result.Source != Type+":"+good.URL {
+		t.Errorf("结果不正确：%+v", result)
+	}
+	if result.Details[bad.URL] == "" {
+		t.Errorf("期待记录 %s 的失败原因，得到 %v", bad.URL, result.Details)
+	}
+
+	if _, err = New(iIPSource.IPv4, &config.IPSource{URL: " , "}, xlogger.Nop()); err == nil {
+		t.Error("未配置URL应返回错误")
+	}
+}
+
+// TestURLConsensus 测试过半数和N个一致的策略, 以及暂停总是不一致的URL
+func TestURLConsensus(t *testing.T) {
+	newServer := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+	}
+	a, b, hijacked := newServer("1.2.3.4"), newServer("ip: 1.2.3.4"), newServer("6.6.6.6")
+	defer a.Close()
+	defer b.Close()
+	defer hijacked.Close()
+	urls := hijacked.URL + "," + a.URL + "," + b.URL
+
+	for _, policy := range []string{"majority", "2"} {
+		source, err := New(iIPSource.IPv4, &config.IPSource{URL: urls, URLPolicy: policy}, xlogger.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := source.GetAddr(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Addr != "1.2.3.4" || result.Source != Type+":"+a.URL+","+b.URL || result.Details[hijacked.URL] != "6.6.6.6" {
+			t.Errorf("%s 策略的结果不正确：%+v", policy, result)
+		}
+	}
+
+	source, _ := New(iIPSource.IPv4, &config.IPSource{URL: urls, URLPolicy: "3"}, xlogger.Nop())
+	if _, err := source.GetAddr(context.Background()); !errors.Is(err, ErrNoConsensus) {
+		t.Errorf("期待 ErrNoConsensus，得到 %v", err)
+	}
+
+	source, _ = New(iIPSource.IPv4, &config.IPSource{URL: urls, URLPolicy: "majority"}, xlogger.Nop())
+	for i := 0; i < MaxStrikes; i++ {
+		_, _ = source.GetAddr(context.Background())
+	}
+	result, err := source.GetAddr(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Details[hijacked.URL]; ok {
+		t.Errorf("总是不一致的URL应暂停请求：%v", result.Details)
+	}
+
+	if _, err = New(iIPSource.IPv4, &config.IPSource{URL: urls, URLPolicy: "4"}, xlogger.Nop()); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("期待 ErrInvalidPolicy，得到 %v", err)
+	}
+}
+
+// TestURLFormat 测试响应格式、请求方法和请求头
+func TestURLFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"version":"1.2.3.4","client":{"ip":"203.0.113.5"}}`)
+		case "/trace":
+			fmt.Fprint(w, "fl=1.1.1.1\nh=example.com\nip=203.0.113.6\nts=1700000000.1\n")
+		case "/html":
+			fmt.Fprint(w, `<p>v1.2.3.4 lan 192.168.1.2</p><span id="ip">198.51.100.5</span>`)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		family iIPSource.Family
+		source *config.URLSource
+		want   string
+	}{
+		{iIPSource.IPv4, &config.URLSource{URL: server.URL + "/json", Method: "post", Headers: []string{"Authorization: Bearer token"}, Format: "json:client.ip"}, "203.0.113.5"},
+		{iIPSource.IPv4, &config.URLSource{URL: server.URL + "/trace", Format: "kv:ip"}, "203.0.113.6"},
+		{iIPSource.IPv4, &config.URLSource{URL: server.URL + "/html", Format: `regex:id="ip">(?P<ip>[^<]+)<`}, "198.51.100.5"},
+		// 选出的内容不是地址, 或请求失败
+		{iIPSource.IPv4, &config.URLSource{URL: server.URL + "/trace", Format: "plain"}, ""},
+		{iIPSource.IPv4, &config.URLSource{URL: server.URL + "/trace", Format: "kv:h"}, ""},
+		{iIPSource.IPv4, &config.URLSource{URL: server.URL + "/json", Format: "json:client.ip"}, ""},
+	}
+	for _, tt := range tests {
+		source, err := New(tt.family, &config.IPSource{URLs: []*config.URLSource{tt.source}}, xlogger.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := source.GetAddr(context.Background())
+		if result.Addr != tt.want || (tt.want == "") != (err != nil) {
+			t.Errorf("%s 期待 %q，得到 %+v %v", tt.source.URL, tt.want, result, err)
+		}
+	}
+
+	for _, format := range []string{"xml", "regex:(\\S+)", "json:"} {
+		_, err := New(iIPSource.IPv4, &config.IPSource{URLs: []*config.URLSource{{URL: server.URL, Format: format}}}, xlogger.Nop())
+		if !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%q 期待 ErrInvalidFormat，得到 %v", format, err)
+		}
+	}
+}
+
+// TestDefaultParser 测试未设置格式时查找到的地址同样校验并规范化
+func TestDefaultParser(t *testing.T) {
+	parse, err := newParser("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := parse(iIPSource.IPv6, "ip: 2001:DB8:0:0::5\n"); err != nil || addr != "2001:db8::5" {
+		t.Errorf("期待 2001:db8::5，得到 %q %v", addr, err)
+	}
+	if addr, err := parse(iIPSource.IPv4, "ip: 203.0.113.05"); !errors.Is(err, ipsource.ErrAddrNotFound) {
+		t.Errorf("有前导零的地址应被拒绝，得到 %q %v", addr, err)
+	}
+}
@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jxo-me/ddns/core/ipsource"
+	reg "github.com/jxo-me/ddns/core/registry"
+)
+
+var (
+	ErrInvalidIPSource = errors.New("registry: invalid ip source")
+)
+
+// IPSourceRegistry 获取IP方式的注册表, 以类型(getType)为键
+type IPSourceRegistry struct {
+	registry[ipsource.NewIPSource]
+}
+
+var (
+	ipSourceReg reg.IRegistry[ipsource.NewIPSource] = new(IPSourceRegistry)
+)
+
+// IPSources 全局的获取IP方式注册表
+func IPSources() reg.IRegistry[ipsource.NewIPSource] {
+	return ipSourceReg
+}
+
+// RegisterIPSource 注册获取IP的方式, 新的方式可在自己模块的 init 中调用
+func RegisterIPSource(typ string, newIPSource ipsource.NewIPSource) error {
+	if typ == "" || newIPSource == nil {
+		return ErrInvalidIPSource
+	}
+	if err := ipSourceReg.Register(typ, newIPSource); err != nil {
+		return fmt.Errorf("%w: ip source %s", err, typ)
+	}
+	return nil
+}
+
+// MustRegisterIPSource 与 RegisterIPSource 相同, 类型重复或无效时 panic, 用于 init 中
+func MustRegisterIPSource(typ string, newIPSource ipsource.NewIPSource) {
+	if err := RegisterIPSource(typ, newIPSource); err != nil {
+		panic(err)
+	}
+}
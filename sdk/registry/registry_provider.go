@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jxo-me/ddns/core/ddns"
+	reg "github.com/jxo-me/ddns/core/registry"
+)
+
+var (
+	ErrInvalidProvider = errors.New("registry: invalid provider")
+)
+
+// ProviderRegistry 服务商注册表, 以服务商代码(dns.name)为键
+type ProviderRegistry struct {
+	registry[*ddns.Provider]
+}
+
+var (
+	providerReg reg.IRegistry[*ddns.Provider] = new(ProviderRegistry)
+)
+
+// Providers 全局的服务商注册表
+func Providers() reg.IRegistry[*ddns.Provider] {
+	return providerReg
+}
+
+// RegisterProvider 注册服务商, 第三方服务商可在自己模块的 init 中调用
+func RegisterProvider(code string, newDDNS ddns.NewDDNS, capabilities ddns.Capabilities) error {
+	if code == "" || newDDNS == nil {
+		return ErrInvalidProvider
+	}
+	if err := providerReg.Register(code, &ddns.Provider{
+		Code:         code,
+		New:          newDDNS,
+		Capabilities: capabilities,
+	}); err != nil {
+		return fmt.Errorf("%w: provider %s", err, code)
+	}
+	return nil
+}
+
+// MustRegisterProvider 与 RegisterProvider 相同, 代码重复或无效时 panic, 用于 init 中
+// 避免第三方服务商与内置服务商的代码相同时被静默忽略
+func MustRegisterProvider(code string, newDDNS ddns.NewDDNS, capabilities ddns.Capabilities) {
+	if err := RegisterProvider(code, newDDNS, capabilities); err != nil {
+		panic(err)
+	}
+}
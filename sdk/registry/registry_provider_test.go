@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jxo-me/ddns/config"
+	"github.com/jxo-me/ddns/core/ddns"
+	"github.com/jxo-me/ddns/core/logger"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+)
+
+type testProvider struct {
+	domains xddns.Domains
+}
+
+func (p *testProvider) String() string   { return "test" }
+func (p *testProvider) Endpoint() string { return "" }
+func (p *testProvider) Init(dnsConf *config.DDnsConfig, domains xddns.Domains, log logger.ILogger) {
+	p.domains = domains
+}
+func (p *testProvider) AddUpdateDomainRecords(ctx context.Context) xddns.Domains {
+	return p.domains
+}
+
+// TestRegisterProvider 测试注册服务商
+func TestRegisterProvider(t *testing.T) {
+	newDDNS := func() ddns.IDDNS { return &testProvider{} }
+	if err := RegisterProvider("test", newDDNS, ddns.Capabilities{IPv4: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer Providers().Unregister("test")
+
+	if err := RegisterProvider("test", newDDNS, ddns.Capabilities{}); !errors.Is(err, ErrDup) {
+		t.Errorf("重复注册应返回 ErrDup，得到 %v", err)
+	}
+	if err := RegisterProvider("", newDDNS, ddns.Capabilities{}); !errors.Is(err, ErrInvalidProvider) {
+		t.Errorf("空代码应返回 ErrInvalidProvider，得到 %v", err)
+	}
+
+	provider := Providers().Get("test")
+	if provider == nil || !provider.Capabilities.IPv4 {
+		t.Fatalf("未找到注册的服务商：%+v", provider)
+	}
+	// 每次创建独立的实例
+	if provider.New() == provider.New() {
+		t.Error("New 应返回新的实例")
+	}
+}
+
+// TestMustRegisterProvider 测试重复注册时 panic
+func TestMustRegisterProvider(t *testing.T) {
+	newDDNS := func() ddns.IDDNS { return &testProvider{} }
+	MustRegisterProvider("test", newDDNS, ddns.Capabilities{})
+	defer Providers().Unregister("test")
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrDup) {
+			t.Errorf("重复注册应 panic ErrDup，得到 %v", err)
+		}
+	}()
+	MustRegisterProvider("test", newDDNS, ddns.Capabilities{})
+}
+
+type legacyProvider struct {
+	testProvider
+}
+
+func (p *legacyProvider) AddUpdateDomainRecords() xddns.Domains {
+	return p.domains
+}
+
+// TestRegisterLegacyProvider 测试没有 ctx 参数的服务商通过 FromLegacy 注册
+func TestRegisterLegacyProvider(t *testing.T) {
+	MustRegisterProvider("legacy", func() ddns.IDDNS { return ddns.FromLegacy(&legacyProvider{}) }, ddns.Capabilities{IPv4: true})
+	defer Providers().Unregister("legacy")
+
+	d := Providers().Get("legacy").New()
+	d.Init(&config.DDnsConfig{}, xddns.Domains{Ipv4Addr: "192.0.2.1"}, nil)
+	if domains := d.AddUpdateDomainRecords(context.Background()); domains.Ipv4Addr != "192.0.2.1" || d.String() != "test" {
+		t.Errorf("转换后的服务商结果不正确：%s %+v", d, domains)
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"github.com/jxo-me/ddns/config"
+	"github.com/jxo-me/ddns/core/event"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+	"math/rand"
+	"time"
+)
+
+// 失败的类型
+const (
+	PolicyDetection = "detection"
+	PolicyProvider  = "provider"
+)
+
+const (
+	DefaultRetry = 30 * time.Second
+	// DefaultMaxRetry 退避的最长间隔, 可以超过正常运行的间隔, 以减少服务商限流时的请求
+	DefaultMaxRetry   = time.Hour
+	DefaultMultiplier = 2
+	DefaultThreshold  = xddns.DefaultFailThreshold
+	// MinRetry 加入随机后的最短间隔, 避免频繁请求
+	MinRetry = time.Second
+)
+
+// backoff 一种失败的重试策略
+// 连续失败未达到 threshold 次时按 retry 重试, 之后间隔为 0 到 retry*multiplier^n 之间的随机值, 不超过 max
+type backoff struct {
+	policy     string
+	retry      time.Duration
+	max        time.Duration
+	multiplier float64
+	threshold  int
+	// failures 连续失败的次数
+	failures int
+	// jitter 返回 [0, d] 之间的随机值
+	jitter func(d time.Duration) time.Duration
+}
+
+// newBackoff 未配置的项使用默认值
+func newBackoff(policy string, conf *config.Backoff) *backoff {
+	b := &backoff{
+		policy:     policy,
+		retry:      DefaultRetry,
+		max:        DefaultMaxRetry,
+		multiplier: DefaultMultiplier,
+		threshold:  DefaultThreshold,
+		jitter:     fullJitter,
+	}
+	if conf != nil {
+		if conf.Retry > 0 {
+			b.retry = time.Duration(conf.Retry) * time.Second
+		}
+		if conf.Max > 0 {
+			b.max = time.Duration(conf.Max) * time.Second
+		}
+		if conf.Multiplier >= 1 {
+			b.multiplier = conf.Multiplier
+		}
+		if conf.Threshold > 0 {
+			b.threshold = conf.Threshold
+		}
+	}
+	return b
+}
+
+// record 记录本次运行是否失败, 返回下次重试的间隔, 未失败时为 0
+// 未达到阈值时的重试间隔不超过正常运行的间隔, 退避的间隔只受 max 限制, 可以超过正常运行的间隔
+// 刚达到阈值时返回 BackoffEntered 事件, 退避后恢复时返回 Recovered 事件
+func (b *backoff) record(failed bool, interval time.Duration) (time.Duration, *event.Event) {
+	if !failed {
+		failures := b.failures
+		b.failures = 0
+		if failures >= b.threshold {
+			return 0, &event.Event{Type: event.Recovered, Policy: b.policy, Failures: failures}
+		}
+		return 0, nil
+	}
+	delay := b.retry
+	if delay > interval {
+		delay = interval
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return delay, nil
+	}
+	for i := b.threshold; i <= b.failures && delay < b.max; i++ {
+		delay = time.Duration(float64(delay) * b.multiplier)
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	if delay = b.jitter(delay); delay < MinRetry {
+		delay = MinRetry
+	}
+	if b.failures == b.threshold {
+		return delay, &event.Event{Type: event.BackoffEntered, Policy: b.policy, Failures: b.failures, Retry: delay}
+	}
+	return delay, nil
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// schedule 按运行结果计算下次运行的间隔, 获取IP失败和服务商更新失败分别退避
+type schedule struct {
+	detection *backoff
+	provider  *backoff
+}
+
+func newSchedule(conf *config.Schedule) *schedule {
+	if conf == nil {
+		conf = &config.Schedule{}
+	}
+	return &schedule{
+		detection: newBackoff(PolicyDetection, conf.Detection),
+		provider:  newBackoff(PolicyProvider, conf.Provider),
+	}
+}
+
+// next 返回下次运行的间隔和要发布的事件, 都未失败时为 interval, 两种都失败时使用较长的间隔
+func (sc *schedule) next(domains *xddns.Domains, interval time.Duration) (time.Duration, []*event.Event) {
+	var (
+		delay  time.Duration
+		events []*event.Event
+	)
+	for _, r := range []struct {
+		b      *backoff
+		failed bool
+	}{
+		{sc.detection, detectionFailed(domains)},
+		{sc.provider, providerFailed(domains)},
+	} {
+		d, e := r.b.record(r.failed, interval)
+		if e != nil {
+			events = append(events, e)
+		}
+		if d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		delay = interval
+	}
+	return delay, events
+}
+
+// detectionFailed 是否有获取IP失败的
+func detectionFailed(domains *xddns.Domains) bool {
+	detections := []*iIPSource.Result{domains.Ipv4Detection, domains.Ipv6Detection}
+	for _, named := range []map[string]*iIPSource.Result{domains.Ipv4Detections, domains.Ipv6Detections} {
+		for _, detection := range named {
+			detections = append(detections, detection)
+		}
+	}
+	for _, detection := range detections {
+		if detection != nil && detection.Addr == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// providerFailed 是否有服务商更新失败的, 不包括获取IP失败的域名
+func providerFailed(domains *xddns.Domains) bool {
+	for _, group := range []struct {
+		family  iIPSource.Family
+		domains []*xddns.Domain
+	}{
+		{iIPSource.IPv4, domains.Ipv4Domains},
+		{iIPSource.IPv6, domains.Ipv6Domains},
+	} {
+		for _, domain := range group.domains {
+			detection := domains.Detection(group.family, domain)
+			if domain.Result.Failed() && detection != nil && detection.Addr != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
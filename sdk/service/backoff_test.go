@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	"github.com/jxo-me/ddns/core/event"
+)
+
+// TestBackoff 测试重试、指数退避的上限和恢复
+func TestBackoff(t *testing.T) {
+	b := newBackoff(PolicyProvider, &config.Backoff{Retry: 10, Max: 60, Threshold: 2})
+	b.jitter = func(d time.Duration) time.Duration { return d }
+	interval := 5 * time.Minute
+
+	tests := []struct {
+		delay time.Duration
+		typ   event.Type
+	}{
+		{10 * time.Second, ""},
+		{20 * time.Second, event.BackoffEntered},
+		{40 * time.Second, ""},
+		{60 * time.Second, ""},
+		{60 * time.Second, ""},
+	}
+	for i, tt := range tests {
+		delay, e := b.record(true, interval)
+		var typ event.Type
+		if e != nil {
+			typ = e.Type
+		}
+		if delay != tt.delay || typ != tt.typ {
+			t.Errorf("第 %d 次失败应在 %s 后重试，事件 %q，得到 %s %q", i+1, tt.delay, tt.typ, delay, typ)
+		}
+	}
+	if delay, e := b.record(false, interval); delay != 0 || e == nil || e.Type != event.Recovered || e.Failures != 5 {
+		t.Errorf("退避后成功应发布 Recovered，得到 %s %+v", delay, e)
+	}
+	if _, e := b.record(false, interval); e != nil {
+		t.Errorf("未失败时不应发布事件，得到 %+v", e)
+	}
+
+	// 未达到阈值时的重试间隔不超过正常运行的间隔, 退避的间隔可以超过, 直到 max
+	interval = 3 * time.Second
+	for i, expected := range []time.Duration{3 * time.Second, 6 * time.Second, 12 * time.Second} {
+		if delay, _ := b.record(true, interval); delay != expected {
+			t.Errorf("第 %d 次失败应在 %s 后重试，得到 %s", i+1, expected, delay)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		b.record(true, interval)
+	}
+	if delay, _ := b.record(true, interval); delay != 60*time.Second {
+		t.Errorf("退避的间隔应为 max 60s，得到 %s", delay)
+	}
+}
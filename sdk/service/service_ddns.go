@@ -1,120 +1,382 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/jxo-me/ddns/config"
 	"github.com/jxo-me/ddns/consts"
 	iCache "github.com/jxo-me/ddns/core/cache"
 	"github.com/jxo-me/ddns/core/ddns"
+	"github.com/jxo-me/ddns/core/event"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
 	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/core/service"
 	"github.com/jxo-me/ddns/internal/util"
 	"github.com/jxo-me/ddns/sdk/cache"
-	"github.com/jxo-me/ddns/sdk/hook"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+	"github.com/jxo-me/ddns/sdk/ipsource"
+	"net/http"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 )
 
+// DefaultDebounce 地址变化后等待多久再更新, 期间的多次变化只更新一次
+const DefaultDebounce = 2 * time.Second
+
+var (
+	ErrServiceStopped = errors.New("service: stopped")
+	ErrInvalidState   = errors.New("service: invalid state")
+)
+
 type DDNSService struct {
 	DDNS               ddns.IDDNS
 	IpCache            [2]iCache.IIpCache
+	IPSources          [2]iIPSource.IIPSource      // IPv4/IPv6 获取IP的方式, 未启用时为 nil
+	NamedSources       [2]map[string]*xddns.Source // IPv4/IPv6 按名称引用的获取IP的方式
+	Capabilities       *ddns.Capabilities          // 服务商支持的能力, 不支持的记录类型的域名被跳过; 为空时不检查
 	Conf               *config.DDnsConfig
 	Delay              time.Duration
+	Debounce           time.Duration // Debounce 地址变化后等待多久再更新
 	ForceCompareGlobal bool
-	stop               chan chan struct{}
-	status             *int32 // status is the current timer status.
+	schedule           *schedule    // schedule 失败后的重试策略
+	state              atomic.Int32 // state 当前的 service.State
 	logger             logger.ILogger
+	bus                event.IBus // bus 发布事件, 为空时不发布
+	ctx                context.Context
+	cancel             context.CancelFunc // cancel 中止进行中的请求
 }
 
+// String 返回服务名称, 同一服务商的多个账号以此区分
 func (s *DDNSService) String() string {
+	if s.Conf != nil && s.Conf.Name != "" {
+		return s.Conf.Name
+	}
 	return s.DDNS.String()
 }
 
-func NewDDNSService(d ddns.IDDNS, log logger.ILogger, conf *config.DDnsConfig) *DDNSService {
-	st := consts.StatusRunning
+func NewDDNSService(d ddns.IDDNS, sources [2]iIPSource.IIPSource, bus event.IBus, log logger.ILogger, conf *config.DDnsConfig) *DDNSService {
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &DDNSService{
 		DDNS:               d,
-		stop:               make(chan chan struct{}),
+		IPSources:          sources,
 		ForceCompareGlobal: true,
-		status:             &st,
 		logger:             log,
+		bus:                bus,
 		Delay:              time.Second * time.Duration(conf.Delay),
+		Debounce:           DefaultDebounce,
 		Conf:               conf,
+		schedule:           newSchedule(conf.Schedule),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+	if conf.Schedule != nil && conf.Schedule.Interval > 0 {
+		s.Delay = time.Second * time.Duration(conf.Schedule.Interval)
 	}
 
 	return s
 }
 
-func (s *DDNSService) Run() {
+// Run 获取IP并更新一次, 返回每个域名的更新结果
+func (s *DDNSService) Run(ctx context.Context) xddns.Domains {
 	if s.ForceCompareGlobal {
 		s.IpCache = [2]iCache.IIpCache{&cache.IpCache{}, &cache.IpCache{}}
 	}
-	s.DDNS.Init(s.Conf, s.IpCache[0], s.IpCache[1], s.logger)
-	domains := s.DDNS.AddUpdateDomainRecords()
-	// webhook
-	if s.Conf.Webhook != nil {
-		webhook := hook.NewHook(s.Conf.Webhook.WebhookURL, s.Conf.Webhook.WebhookRequestBody,
-			s.Conf.Webhook.WebhookHeaders, s.logger)
-		v4Status, v6Status := webhook.ExecHook(&domains)
-		// 重置单个cache
-		if v4Status == consts.UpdatedFailed {
-			s.IpCache[0] = &cache.IpCache{}
-		}
-		if v6Status == consts.UpdatedFailed {
-			s.IpCache[1] = &cache.IpCache{}
+	domains := s.update(ctx, xddns.Domains{
+		Ipv4Cache:     s.IpCache[0],
+		Ipv6Cache:     s.IpCache[1],
+		Ipv4Sources:   s.NamedSources[0],
+		Ipv6Sources:   s.NamedSources[1],
+		FailThreshold: s.schedule.detection.threshold,
+		Logger:        s.logger,
+	})
+	s.publishResults(&domains)
+	// 有更新失败的, 重置单个cache, 下次与服务商比较; 保留获取IP失败的次数, 达到阈值后每次失败都标记
+	for i, group := range [][]*xddns.Domain{domains.Ipv4Domains, domains.Ipv6Domains} {
+		if xddns.DomainsStatus(group) == consts.UpdatedFailed {
+			s.IpCache[i] = &cache.IpCache{TimesFailedIP: s.IpCache[i].GetFailedTimes()}
 		}
 	}
 
 	s.ForceCompareGlobal = false
+	return domains
+}
+
+// Plan 预览模式, 获取IP并查询服务商现有记录, 不新增或修改, 也不触发 webhook
+func (s *DDNSService) Plan(ctx context.Context) xddns.Domains {
+	// 使用新的缓存, 不影响正常运行时的比较
+	return s.update(ctx, xddns.Domains{
+		Ipv4Cache:   &cache.IpCache{},
+		Ipv6Cache:   &cache.IpCache{},
+		Ipv4Sources: planSources(s.NamedSources[0]),
+		Ipv6Sources: planSources(s.NamedSources[1]),
+		DryRun:      true,
+		Logger:      s.logger,
+	})
+}
+
+// planSources 使用新的缓存, 不影响获取失败的次数
+func planSources(sources map[string]*xddns.Source) map[string]*xddns.Source {
+	plan := make(map[string]*xddns.Source, len(sources))
+	for name, source := range sources {
+		plan[name] = &xddns.Source{IPSource: source.IPSource, Cache: &cache.IpCache{}}
+	}
+	return plan
+}
+
+// update 获取IP并交给服务商处理, 服务商不支持的记录类型不获取IP, 其域名记录为跳过且不交给服务商
+func (s *DDNSService) update(ctx context.Context, domains xddns.Domains) xddns.Domains {
+	ipv4Source, ipv6Source := s.IPSources[0], s.IPSources[1]
+	ipv4, ipv6 := s.supports()
+	if !ipv4 {
+		ipv4Source = nil
+	}
+	if !ipv6 {
+		ipv6Source = nil
+	}
+	domains.GetNewIp(ctx, s.Conf, ipv4Source, ipv6Source)
+	var unsupported [2][]*xddns.Domain
+	if !ipv4 {
+		unsupported[0], domains.Ipv4Domains = domains.Ipv4Domains, nil
+		xddns.SkipDomains(unsupported[0], "IPv4 records not supported by "+s.DDNS.String())
+	}
+	if !ipv6 {
+		unsupported[1], domains.Ipv6Domains = domains.Ipv6Domains, nil
+		xddns.SkipDomains(unsupported[1], "IPv6 records not supported by "+s.DDNS.String())
+	}
+	s.DDNS.Init(s.Conf, domains, s.logger)
+	domains = s.DDNS.AddUpdateDomainRecords(ctx)
+	if !ipv4 {
+		domains.Ipv4Domains = unsupported[0]
+	}
+	if !ipv6 {
+		domains.Ipv6Domains = unsupported[1]
+	}
+	return domains
+}
+
+// supports 服务商是否支持A/AAAA记录
+func (s *DDNSService) supports() (ipv4, ipv6 bool) {
+	if s.Capabilities == nil {
+		return true, true
+	}
+	return s.Capabilities.IPv4, s.Capabilities.IPv6
+}
+
+// publish 发布事件
+func (s *DDNSService) publish(e *event.Event) {
+	if s.bus == nil {
+		return
+	}
+	e.Service = s.String()
+	s.bus.Publish(e)
+}
+
+// publishResults 发布获取IP、每个域名的更新结果和运行完成事件
+func (s *DDNSService) publishResults(domains *xddns.Domains) {
+	families := []struct {
+		family     iIPSource.Family
+		detection  *iIPSource.Result
+		detections map[string]*iIPSource.Result
+	}{
+		{iIPSource.IPv4, domains.Ipv4Detection, domains.Ipv4Detections},
+		{iIPSource.IPv6, domains.Ipv6Detection, domains.Ipv6Detections},
+	}
+	for _, f := range families {
+		s.publishDetection(f.family, f.detection)
+		// 按名称引用的方式的结果, 按名称排序
+		names := make([]string, 0, len(f.detections))
+		for name := range f.detections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s.publishDetection(f.family, f.detections[name])
+		}
+	}
+	for _, result := range domains.Results() {
+		s.publish(&event.Event{Type: resultEventType(result), Result: result})
+	}
+	s.publish(&event.Event{Type: event.RunCompleted, Domains: domains})
+}
+
+// publishDetection 发布获取IP的结果, 未获取时不发布
+func (s *DDNSService) publishDetection(family iIPSource.Family, detection *iIPSource.Result) {
+	switch {
+	case detection == nil:
+	case detection.Addr != "":
+		s.publish(&event.Event{Type: event.IPDetected, Family: family, Detection: detection})
+	default:
+		s.publish(&event.Event{Type: event.IPDetectionFailed, Family: family, Detection: detection})
+	}
+}
+
+// resultEventType 域名更新结果对应的事件类型
+func resultEventType(result *xddns.UpdateResult) event.Type {
+	switch {
+	case result.Failed():
+		return event.UpdateFailed
+	case result.Status != consts.UpdatedSuccess:
+		return event.RecordUnchanged
+	case result.Action == xddns.ActionCreate:
+		return event.RecordCreated
+	default:
+		return event.RecordUpdated
+	}
 }
 
+// Worker 定时获取IP并更新, 直到 Stop
+// 获取IP的方式支持监听地址变化时, 变化后立即更新, 定时更新作为兜底; 失败后按重试策略提前重试或退避
 func (s *DDNSService) Worker() error {
+	// 崩溃后重启时停止上次的监听
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
 	var (
-		timerIntervalTicker = time.NewTicker(s.Delay)
+		timer    = time.NewTimer(s.Delay)
+		changes  = s.watch(ctx)
+		debounce <-chan time.Time
 	)
-	defer timerIntervalTicker.Stop()
+	defer timer.Stop()
 	for {
 		select {
-		case <-timerIntervalTicker.C:
-			// Check the timer status.
-			switch atomic.LoadInt32(s.status) {
-			case consts.StatusRunning:
-				s.logger.Debugf("%s DDNS service is running!", s.DDNS.String())
-				// Timer proceeding.
-				s.Run()
-			case consts.StatusStopped:
-				s.logger.Debugf("%s DDNS service has been stopped!", s.DDNS.String())
-				// Do nothing.
-			case consts.StatusClosed:
-				// Timer exits.
-				s.logger.Debugf("%s DDNS service is closed!", s.DDNS.String())
+		case <-timer.C:
+			switch s.State() {
+			case service.StateRunning:
+				s.logger.Debugf("%s DDNS service is running!", s.String())
+				s.runAndSchedule(timer)
+			case service.StatePaused:
+				s.logger.Debugf("%s DDNS service is paused!", s.String())
+				timer.Reset(s.Delay)
+			}
+		case <-changes:
+			// 重新计时, 等待连续的变化结束
+			debounce = time.After(s.Debounce)
+		case <-debounce:
+			debounce = nil
+			if s.State() == service.StateRunning {
+				s.logger.Infof("%s address changed, updating now", s.String())
+				if !timer.Stop() {
+					<-timer.C
+				}
+				s.runAndSchedule(timer)
 			}
-		// call to stop polling
-		case confirm := <-s.stop:
-			close(confirm)
-			s.logger.Debugf("%s DDNS service has been manually stopped!", s.DDNS.String())
+		case <-s.ctx.Done():
+			s.logger.Debugf("%s DDNS service has been stopped!", s.String())
+			s.publish(&event.Event{Type: event.ServiceStopped})
 			return nil
 		}
 	}
 }
 
+// runAndSchedule 运行一次, 按结果设置下次运行的时间并发布进入退避或恢复的事件, timer 须已停止或触发
+func (s *DDNSService) runAndSchedule(timer *time.Timer) {
+	domains := s.Run(s.ctx)
+	delay, events := s.schedule.next(&domains, s.Delay)
+	for _, e := range events {
+		e.Domains = &domains
+		switch e.Type {
+		case event.BackoffEntered:
+			s.logger.Warnf("%s %s failed %d times in a row, backing off, next retry in %s", s.String(), e.Policy, e.Failures, e.Retry)
+		case event.Recovered:
+			s.logger.Infof("%s %s recovered after %d failures", s.String(), e.Policy, e.Failures)
+		}
+		s.publish(e)
+	}
+	if delay != s.Delay {
+		s.logger.Debugf("%s next run in %s", s.String(), delay)
+	}
+	timer.Reset(delay)
+}
+
+// watch 监听 IPv4/IPv6 的地址变化, 合并到一个 channel, 都不支持时返回 nil; ctx 取消时停止监听
+func (s *DDNSService) watch(ctx context.Context) <-chan struct{} {
+	sources := s.IPSources[:]
+	for _, named := range s.NamedSources {
+		for _, source := range named {
+			sources = append(sources, source.IPSource)
+		}
+	}
+	var chans []<-chan struct{}
+	for _, source := range sources {
+		if source == nil {
+			continue
+		}
+		changes, err := ipsource.Watch(ctx, source)
+		if err != nil {
+			s.logger.Debugf("Polling every %s: %s", s.Delay, err)
+			continue
+		}
+		chans = append(chans, changes)
+	}
+	if len(chans) == 0 {
+		return nil
+	}
+	return ipsource.Merge(ctx, chans...)
+}
+
+// Start 等待网络连接后启动服务, 阻塞直到 Stop; 崩溃后可再次调用
 func (s *DDNSService) Start() error {
-	// 等待网络连接
-	s.waitForNetworkConnected()
+	// 暂停状态下重启仍保持暂停
+	if !s.transit(service.StateStarting, service.StateReady, service.StateStarting, service.StateRunning) &&
+		s.State() != service.StatePaused {
+		return fmt.Errorf("%w: %s", ErrServiceStopped, s)
+	}
+	// 等待网络连接, Stop 时立即返回
+	s.waitForNetworkConnected(s.ctx)
+	if s.ctx.Err() != nil {
+		return nil
+	}
+	s.transit(service.StateRunning, service.StateStarting)
 	// 启动服务
+	s.publish(&event.Event{Type: event.ServiceStarted})
 	return s.Worker()
 }
 
+// Stop 停止服务并中止进行中的请求, 不等待 Start 返回
 func (s *DDNSService) Stop() error {
-	st := consts.StatusStopped
-	s.status = &st
-	confirm := make(chan struct{})
-	s.stop <- confirm
+	if service.State(s.state.Swap(int32(service.StateStopped))) == service.StateStopped {
+		return nil
+	}
+	// 中止进行中的请求, 不必等待 http.Client 超时
+	s.cancel()
+	return nil
+}
 
+// Pause 暂停定时更新, 正在进行的更新不受影响
+func (s *DDNSService) Pause() error {
+	if !s.transit(service.StatePaused, service.StateStarting, service.StateRunning) {
+		return fmt.Errorf("%w: cannot pause %s service %s", ErrInvalidState, s.State(), s)
+	}
 	return nil
 }
 
+// Resume 恢复暂停的服务
+func (s *DDNSService) Resume() error {
+	if !s.transit(service.StateRunning, service.StatePaused) {
+		return fmt.Errorf("%w: cannot resume %s service %s", ErrInvalidState, s.State(), s)
+	}
+	return nil
+}
+
+// State 返回服务状态
+func (s *DDNSService) State() service.State {
+	return service.State(s.state.Load())
+}
+
+// transit 当前状态为 from 之一时切换到 to
+func (s *DDNSService) transit(to service.State, from ...service.State) bool {
+	for _, f := range from {
+		if s.state.CompareAndSwap(int32(f), int32(to)) {
+			return true
+		}
+	}
+	return false
+}
+
 // waitForNetworkConnected 等待网络连接后继续
-func (s *DDNSService) waitForNetworkConnected() {
+func (s *DDNSService) waitForNetworkConnected(ctx context.Context) {
 	// 延时 5 秒
 	timeout := time.Second * consts.NetworkConnectedTimeout
 	// 等待网络连接
@@ -123,8 +385,16 @@ func (s *DDNSService) waitForNetworkConnected() {
 	addr := s.DDNS.Endpoint()
 	if addr != "" {
 		for {
+			if ctx.Err() != nil {
+				return
+			}
 			client := util.CreateHTTPClient()
-			resp, err := client.Get(addr)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+			if err != nil {
+				s.logger.Debugf("Invalid endpoint %s: %s", addr, err)
+				return
+			}
+			resp, err := client.Do(req)
 			if err != nil {
 				// 如果 err 包含回环地址（[::1]:53）则表示没有 DNS 服务器，设置 DNS 服务器
 				if strings.Contains(err.Error(), loopbackServer) && !find {
@@ -138,7 +408,11 @@ func (s *DDNSService) waitForNetworkConnected() {
 
 				s.logger.Debugf("Waiting for network connection: %s. Try again in %s...", err, timeout)
 				// 等待 5 秒后重试
-				time.Sleep(timeout)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(timeout):
+				}
 				continue
 			}
 			s.logger.Debugf("The network is connected: %s", addr)
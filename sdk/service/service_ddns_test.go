@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	"github.com/jxo-me/ddns/core/ddns"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/service"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+)
+
+type watchingSource chan struct{}
+
+func (w watchingSource) String() string { return "watching" }
+func (w watchingSource) GetAddr(context.Context) (*iIPSource.Result, error) {
+	return &iIPSource.Result{Addr: "192.0.2.1"}, nil
+}
+func (w watchingSource) Watch(context.Context) (<-chan struct{}, error) {
+	return w, nil
+}
+
+// TestWorkerWatch 测试地址变化后立即更新, 连续的变化只更新一次
+func TestWorkerWatch(t *testing.T) {
+	d := &fakeDDNS{}
+	changes := make(watchingSource)
+	s := newTestService(d)
+	s.IPSources[0] = changes
+	s.Delay = time.Hour
+	s.Debounce = 20 * time.Millisecond
+	done := make(chan error)
+	go func() { done <- s.Start() }()
+	defer func() {
+		_ = s.Stop()
+		<-done
+	}()
+
+	for i := 0; i < 5; i++ {
+		changes <- struct{}{}
+	}
+	waitFor(t, "地址变化后没有更新", func() bool { return atomic.LoadInt32(&d.calls) == 1 })
+	time.Sleep(5 * s.Debounce)
+	if calls := atomic.LoadInt32(&d.calls); calls != 1 {
+		t.Errorf("连续的变化应只更新一次，得到 %d 次", calls)
+	}
+
+	_ = s.Pause()
+	changes <- struct{}{}
+	time.Sleep(5 * s.Debounce)
+	if calls := atomic.LoadInt32(&d.calls); calls != 1 {
+		t.Errorf("暂停时不应更新，得到 %d 次", calls)
+	}
+}
+
+type ctxWatchingSource struct {
+	watchingSource
+	ctx chan context.Context
+}
+
+func (w ctxWatchingSource) Watch(ctx context.Context) (<-chan struct{}, error) {
+	w.ctx <- ctx
+	return w.watchingSource, nil
+}
+
+// TestWorkerPanicStopsWatch 测试 Worker 崩溃后停止监听, 重启时不泄漏
+func TestWorkerPanicStopsWatch(t *testing.T) {
+	d := &fakeDDNS{panics: 1}
+	source := ctxWatchingSource{watchingSource: make(watchingSource), ctx: make(chan context.Context, 1)}
+	s := newTestService(d)
+	s.IPSources[0] = source
+	s.transit(service.StateRunning, service.StateReady)
+	defer func() { _ = s.Stop() }()
+
+	func() {
+		defer func() { _ = recover() }()
+		_ = s.Worker()
+	}()
+	select {
+	case ctx := <-source.ctx:
+		if ctx.Err() == nil {
+			t.Error("Worker 崩溃后应停止监听")
+		}
+	default:
+		t.Fatal("没有开始监听")
+	}
+}
+
+// TestRunUnsupportedFamily 测试服务商不支持的记录类型的域名被跳过, 不获取IP也不交给服务商
+func TestRunUnsupportedFamily(t *testing.T) {
+	d := &fakeDDNS{}
+	s := newTestService(d)
+	s.Conf.Ipv6 = &config.Ipv6{Enable: true, Domains: []string{"www.example.com"}}
+	s.IPSources[1] = watchingSource(nil)
+	s.Capabilities = &ddns.Capabilities{IPv4: true}
+
+	domains := s.Run(context.Background())
+	if len(d.domains.Ipv6Domains) != 0 {
+		t.Errorf("不支持的域名不应交给服务商，得到 %d 个", len(d.domains.Ipv6Domains))
+	}
+	if domains.Ipv6Detection != nil {
+		t.Errorf("不支持的记录类型不应获取IP，得到 %+v", domains.Ipv6Detection)
+	}
+	results := domains.Results()
+	if len(results) != 1 || results[0].Action != xddns.ActionSkip || !strings.Contains(results[0].Reason, "IPv6 records not supported") {
+		t.Errorf("应记录跳过的结果，得到 %+v", results)
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/core/service"
+)
+
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+)
+
+var (
+	ErrDupService        = errors.New("supervisor: duplicate service")
+	ErrServiceNotFound   = errors.New("supervisor: service not found")
+	ErrSupervisorStopped = errors.New("supervisor: stopped")
+	errWorkerExited      = errors.New("worker exited")
+)
+
+// WorkerStatus 被管理服务的状态
+type WorkerStatus struct {
+	Name  string        `json:"name"`
+	State service.State `json:"state"`
+	// Restarts 崩溃后重启的次数
+	Restarts int `json:"restarts"`
+	// LastError 最近一次崩溃的原因
+	LastError string `json:"lastError,omitempty"`
+}
+
+type worker struct {
+	svc        service.IDDNSService
+	restarting bool
+	restarts   int
+	lastError  string
+}
+
+// Supervisor 在各自的 goroutine 中运行服务, 服务崩溃后按退避时间重启
+type Supervisor struct {
+	// MinBackoff 第一次重启前的等待时间, 之后每次翻倍, 最长 MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	mu      sync.Mutex
+	workers map[string]*worker
+	names   []string
+	done    chan struct{}
+	wg      sync.WaitGroup
+	logger  logger.ILogger
+}
+
+func NewSupervisor(log logger.ILogger) *Supervisor {
+	return &Supervisor{
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		workers:    make(map[string]*worker),
+		done:       make(chan struct{}),
+		logger:     log,
+	}
+}
+
+// Start 开始管理并启动服务
+func (sv *Supervisor) Start(svc service.IDDNSService) error {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	select {
+	case <-sv.done:
+		return ErrSupervisorStopped
+	default:
+	}
+	name := svc.String()
+	if _, ok := sv.workers[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDupService, name)
+	}
+	w := &worker{svc: svc}
+	sv.workers[name] = w
+	sv.names = append(sv.names, name)
+	sv.wg.Add(1)
+	go sv.supervise(w)
+	return nil
+}
+
+// Stop 停止所有服务并等待其退出
+func (sv *Supervisor) Stop() {
+	sv.mu.Lock()
+	select {
+	case <-sv.done:
+		sv.mu.Unlock()
+		sv.wg.Wait()
+		return
+	default:
+	}
+	close(sv.done)
+	sv.mu.Unlock()
+
+	for _, w := range sv.list() {
+		if err := w.svc.Stop(); err != nil {
+			sv.logger.Errorf("service %s stop: %s", w.svc, err)
+		}
+	}
+	sv.wg.Wait()
+}
+
+// Pause 暂停服务
+func (sv *Supervisor) Pause(name string) error {
+	w, err := sv.get(name)
+	if err != nil {
+		return err
+	}
+	return w.svc.Pause()
+}
+
+// Resume 恢复暂停的服务
+func (sv *Supervisor) Resume(name string) error {
+	w, err := sv.get(name)
+	if err != nil {
+		return err
+	}
+	return w.svc.Resume()
+}
+
+// Status 返回服务的状态
+func (sv *Supervisor) Status(name string) (WorkerStatus, error) {
+	w, err := sv.get(name)
+	if err != nil {
+		return WorkerStatus{}, err
+	}
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	return sv.status(w), nil
+}
+
+// Statuses 按启动顺序返回所有服务的状态
+func (sv *Supervisor) Statuses() []WorkerStatus {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	statuses := make([]WorkerStatus, 0, len(sv.names))
+	for _, name := range sv.names {
+		statuses = append(statuses, sv.status(sv.workers[name]))
+	}
+	return statuses
+}
+
+func (sv *Supervisor) status(w *worker) WorkerStatus {
+	st := WorkerStatus{
+		Name:      w.svc.String(),
+		State:     w.svc.State(),
+		Restarts:  w.restarts,
+		LastError: w.lastError,
+	}
+	if w.restarting && st.State != service.StateStopped {
+		st.State = service.StateRestarting
+	}
+	return st
+}
+
+func (sv *Supervisor) get(name string) (*worker, error) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	w, ok := sv.workers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+	}
+	return w, nil
+}
+
+func (sv *Supervisor) list() []*worker {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	workers := make([]*worker, 0, len(sv.names))
+	for _, name := range sv.names {
+		workers = append(workers, sv.workers[name])
+	}
+	return workers
+}
+
+// supervise 运行服务, 非正常退出时按退避时间重启, 直到服务停止
+func (sv *Supervisor) supervise(w *worker) {
+	defer sv.wg.Done()
+	backoff := sv.MinBackoff
+	for {
+		started := time.Now()
+		err := sv.run(w)
+		if w.svc.State() == service.StateStopped {
+			return
+		}
+		// 运行足够久后重新计算退避时间
+		if time.Since(started) > sv.MaxBackoff {
+			backoff = sv.MinBackoff
+		}
+		sv.logger.Errorf("service %s crashed: %s, restart in %s", w.svc, err, backoff)
+		sv.mu.Lock()
+		w.restarting = true
+		w.lastError = err.Error()
+		sv.mu.Unlock()
+
+		select {
+		case <-sv.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		sv.mu.Lock()
+		w.restarting = false
+		w.restarts++
+		sv.mu.Unlock()
+		if backoff *= 2; backoff > sv.MaxBackoff {
+			backoff = sv.MaxBackoff
+		}
+	}
+}
+
+// run 运行服务直到退出, 将 panic 转为错误
+func (sv *Supervisor) run(w *worker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			sv.logger.Debugf("service %s panic: %v\n%s", w.svc, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	sv.logger.Info("service " + w.svc.String() + " start")
+	if err = w.svc.Start(); err == nil {
+		err = errWorkerExited
+	}
+	return
+}
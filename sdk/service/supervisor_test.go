@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jxo-me/ddns/config"
+	iIPSource "github.com/jxo-me/ddns/core/ipsource"
+	"github.com/jxo-me/ddns/core/logger"
+	"github.com/jxo-me/ddns/core/service"
+	xddns "github.com/jxo-me/ddns/sdk/ddns"
+	xlogger "github.com/jxo-me/ddns/sdk/logger"
+)
+
+type fakeDDNS struct {
+	endpoint string
+	calls    int32
+	panics   int32 // 前 panics 次调用 panic
+	domains  xddns.Domains
+}
+
+func (f *fakeDDNS) String() string   { return "fake" }
+func (f *fakeDDNS) Endpoint() string { return f.endpoint }
+func (f *fakeDDNS) Init(dnsConf *config.DDnsConfig, domains xddns.Domains, log logger.ILogger) {
+	f.domains = domains
+}
+func (f *fakeDDNS) AddUpdateDomainRecords(ctx context.Context) xddns.Domains {
+	if atomic.AddInt32(&f.calls, 1) <= f.panics {
+		panic("boom")
+	}
+	return f.domains
+}
+
+func newTestService(d *fakeDDNS) *DDNSService {
+	s := NewDDNSService(d, [2]iIPSource.IIPSource{}, nil, xlogger.Nop(), &config.DDnsConfig{Name: "test", Delay: 1})
+	s.Delay = 5 * time.Millisecond
+	return s
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSupervisorRestart 测试崩溃后重启、暂停和恢复
+func TestSupervisorRestart(t *testing.T) {
+	d := &fakeDDNS{panics: 1}
+	sv := NewSupervisor(xlogger.Nop())
+	sv.MinBackoff = 10 * time.Millisecond
+	if err := sv.Start(newTestService(d)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Start(newTestService(d)); !errors.Is(err, ErrDupService) {
+		t.Errorf("重复的服务应返回 ErrDupService，得到 %v", err)
+	}
+
+	waitFor(t, "崩溃后没有重启", func() bool {
+		st, _ := sv.Status("test")
+		return st.Restarts == 1 && st.State == service.StateRunning && atomic.LoadInt32(&d.calls) > 2
+	})
+	if st, _ := sv.Status("test"); st.LastError != "panic: boom" {
+		t.Errorf("LastError 应为 panic: boom，得到 %q", st.LastError)
+	}
+
+	if err := sv.Pause("test"); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := sv.Status("test"); st.State != service.StatePaused {
+		t.Errorf("暂停后状态应为 paused，得到 %s", st.State)
+	}
+	time.Sleep(20 * time.Millisecond)
+	calls := atomic.LoadInt32(&d.calls)
+	time.Sleep(20 * time.Millisecond)
+	if got := atomic.LoadInt32(&d.calls); got != calls {
+		t.Errorf("暂停后仍在更新: %d -> %d", calls, got)
+	}
+	if err := sv.Resume("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Resume("test"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("重复恢复应返回 ErrInvalidState，得到 %v", err)
+	}
+	waitFor(t, "恢复后没有更新", func() bool { return atomic.LoadInt32(&d.calls) > calls })
+
+	sv.Stop()
+	if st, _ := sv.Status("test"); st.State != service.StateStopped {
+		t.Errorf("停止后状态应为 stopped，得到 %s", st.State)
+	}
+	if _, err := sv.Status("none"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("未知服务应返回 ErrServiceNotFound，得到 %v", err)
+	}
+}
+
+// TestSupervisorStopWhileWaitingNetwork 测试等待网络连接时可以停止
+func TestSupervisorStopWhileWaitingNetwork(t *testing.T) {
+	s := newTestService(&fakeDDNS{endpoint: "http://127.0.0.1:1"})
+	sv := NewSupervisor(xlogger.Nop())
+	_ = sv.Start(s)
+	waitFor(t, "服务没有开始等待网络连接", func() bool { return s.State() == service.StateStarting })
+
+	stopped := make(chan struct{})
+	go func() {
+		sv.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("等待网络连接时 Stop 被阻塞")
+	}
+	if err := s.Start(); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("停止后再启动应返回 ErrServiceStopped，得到 %v", err)
+	}
+}
+
+// TestWorkerStatusJSON 测试状态序列化为名称
+func TestWorkerStatusJSON(t *testing.T) {
+	data, err := json.Marshal(WorkerStatus{Name: "test", State: service.StateRestarting})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"test","state":"restarting","restarts":0}`; string(data) != want {
+		t.Errorf("期待 %s，得到 %s", want, data)
+	}
+}